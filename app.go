@@ -12,28 +12,50 @@ import (
 func main() {
 
 	// Recogemos el valor de los argumentos
-	if len(os.Args) == 2 {
-
-		argMode := os.Args[1]
-		if argMode == "client" {
-			client.Start()
-		} else if argMode == "server" {
-			server.Launch()
-		} else {
-			fmt.Printf("El comando de lanzamiento indicado no es válido.\n")
-		}
+	if len(os.Args) < 2 {
+		fmt.Printf("El número de parámetros introducido no es correcto.\n")
+		return
+	}
 
-	} else if (len(os.Args)) == 4 {
+	argMode := os.Args[1]
+	args := os.Args[2:]
 
-		argMode := os.Args[1]
-		if argMode == "logger" {
-			argInput := os.Args[2]
-			argOutput := os.Args[3]
-			utils.LaunchLogger(argInput, argOutput)
-		} else {
-			fmt.Printf("El comando de lanzamiento indicado no es válido.\n")
+	switch {
+	case argMode == "client" && len(args) == 0:
+		client.Start()
+	case argMode == "server" && len(args) == 0:
+		server.Launch()
+	case argMode == "logger" && len(args) == 2:
+		argInput := args[0]
+		argOutput := args[1]
+		utils.LaunchLogger(argInput, argOutput)
+	case argMode == "logs":
+		utils.LaunchLogs(args)
+	case argMode == "entry":
+		client.LaunchEntry(args)
+	case argMode == "list":
+		client.LaunchList(args)
+	case argMode == "search":
+		client.LaunchSearch(args)
+	case argMode == "get":
+		client.LaunchGet(args)
+	case argMode == "health":
+		client.LaunchHealth(args)
+	case argMode == "generate":
+		client.LaunchGenerate(args)
+	case argMode == "import":
+		client.LaunchImport(args)
+	case argMode == "export":
+		client.LaunchExport(args)
+	case argMode == "admin":
+		server.LaunchAdmin(args)
+	case argMode == "audit" && len(args) == 1 && args[0] == "verify":
+		if !server.VerifyAudit() {
+			os.Exit(1)
 		}
-	} else {
+	case argMode == "client" || argMode == "server" || argMode == "logger" || argMode == "audit":
 		fmt.Printf("El número de parámetros introducido no es correcto.\n")
+	default:
+		fmt.Printf("El comando de lanzamiento indicado no es válido.\n")
 	}
 }
@@ -3,20 +3,35 @@ package client
 import (
 	"crypto/tls"
 	"net/http"
+	"runtime"
 
 	"github.com/bertus193/gestorSDS/config"
 )
 
 var baseURL = config.SecureURL + config.SecureServerPort
 
-// Start Inicio del cliente
-func Start() {
+// userAgentTransport identifica al cliente en cada petición, el servidor
+// lo usa para reconocer los dispositivos desde los que se inicia sesión
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", config.AppName+" cliente ("+runtime.GOOS+"/"+runtime.GOARCH+")")
+	return t.base.RoundTrip(req)
+}
+
+// newHTTPClient crea el cliente http utilizado en la aplicación
+func newHTTPClient() *http.Client {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
-	// Cliente http utilizado en la aplicación
-	client := &http.Client{Transport: tr}
+	return &http.Client{Transport: &userAgentTransport{base: tr}}
+}
 
+// Start Inicio del cliente
+func Start() {
 	// Lanzamiento de la interfaz
-	startUI(client)
+	startUI(newHTTPClient())
 }
@@ -0,0 +1,369 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/model"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// Los adjuntos se cifran por bloques, cada uno con su nonce delante, para
+// subirlos por partes y descifrarlos a medida que se descargan. Cada bloque
+// cifrado ocupa una parte completa de config.AttachmentChunkSize
+const nonceAdjunto = 24
+
+var bloqueAdjunto = config.AttachmentChunkSize - nonceAdjunto
+
+// adjuntoEntrada es un adjunto de una entrada con el nombre ya descifrado
+type adjuntoEntrada struct {
+	ID       string
+	Nombre   string
+	Tamano   int64 // Tamaño del fichero original
+	Fecha    time.Time
+	Completo bool
+}
+
+// tamanoCifrado es lo que ocupa un fichero de n bytes una vez cifrado
+func tamanoCifrado(n int64) int64 {
+	bloques := (n + int64(bloqueAdjunto) - 1) / int64(bloqueAdjunto)
+	return n + bloques*nonceAdjunto
+}
+
+// tamanoOriginal es lo que ocupaba el fichero antes de cifrarlo
+func tamanoOriginal(cifrado int64) int64 {
+	bloques := (cifrado + int64(config.AttachmentChunkSize) - 1) / int64(config.AttachmentChunkSize)
+	return cifrado - bloques*nonceAdjunto
+}
+
+// formatoTamano muestra un tamaño en bytes de forma legible
+func formatoTamano(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// Petición al servidor de los adjuntos de una entrada, ordenados por nombre
+func listarAdjuntos(client *http.Client, entryID string) ([]adjuntoEntrada, error) {
+
+	var attachmentsResult []adjuntoEntrada
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("id", entryID)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/adjuntos", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			default:
+				errResult = errors.New("unknown")
+			}
+
+		} else {
+			// Leemos la respuesta
+			if contents, errRead := ioutil.ReadAll(response.Body); errRead != nil {
+				errResult = errors.New("unable to read")
+			} else {
+				adjuntos := make(map[string]model.Adjunto)
+				// Recuperamos el objeto del mensaje original
+				if errJSON := json.Unmarshal(contents, &adjuntos); errJSON != nil {
+					errResult = errors.New("unable to unmarshal")
+				} else {
+					for attachmentID, adjunto := range adjuntos {
+						attachmentsResult = append(attachmentsResult, adjuntoEntrada{
+							ID:       attachmentID,
+							Nombre:   descifrarValor(adjunto.Nombre),
+							Tamano:   tamanoOriginal(adjunto.Tamano),
+							Fecha:    adjunto.Fecha,
+							Completo: adjunto.Completo(),
+						})
+					}
+					sort.Slice(attachmentsResult, func(i, j int) bool {
+						return attachmentsResult[i].Nombre < attachmentsResult[j].Nombre
+					})
+				}
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return attachmentsResult, errResult
+}
+
+// subirAdjunto cifra y sube un fichero como adjunto de la entrada, por
+// partes. Si la subida no termina, el adjunto se elimina para liberar la cuota
+func subirAdjunto(client *http.Client, entryID string, ruta string, progreso func(subido int64, total int64)) (string, error) {
+	fichero, err := os.Open(ruta)
+	if err != nil {
+		return "", errors.New("unable to read")
+	}
+	defer fichero.Close()
+
+	info, err := fichero.Stat()
+	if err != nil || info.IsDir() {
+		return "", errors.New("unable to read")
+	}
+	total := tamanoCifrado(info.Size())
+
+	attachmentID, err := crearAdjunto(client, entryID, cifrarValor(filepath.Base(ruta)), total)
+	if err != nil {
+		return "", err
+	}
+
+	var subido int64
+	bloque := make([]byte, bloqueAdjunto)
+	for subido < total {
+		n, errRead := io.ReadFull(fichero, bloque)
+		if errRead != nil && errRead != io.ErrUnexpectedEOF {
+			err = errors.New("unable to read")
+			break
+		}
+		nonce, _ := utils.GenerateRandomBytes(nonceAdjunto)
+		parte := append(nonce, utils.CipherSalsa20(bloque[:n], keyData, nonce)...)
+		if subido, err = subirParteAdjunto(client, attachmentID, subido, parte); err != nil {
+			break
+		}
+		if progreso != nil {
+			progreso(subido, total)
+		}
+	}
+
+	if err != nil {
+		eliminarAdjunto(client, attachmentID)
+		return "", err
+	}
+	return attachmentID, nil
+}
+
+// Petición al servidor para crear un adjunto (vacío) reservando su tamaño
+func crearAdjunto(client *http.Client, entryID string, nombre string, tamano int64) (string, error) {
+
+	var idResult string
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("id", entryID)
+	data.Set("nombre", nombre)
+	data.Set("tamano", strconv.FormatInt(tamano, 10))
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/adjuntos/nuevo", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (201 - Created)
+		if response.StatusCode != 201 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("not found")
+			case 413: // (413 - Request Entity Too Large)
+				errResult = errors.New("quota exceeded")
+			default:
+				errResult = errors.New("unknown")
+			}
+		} else {
+			bodyBytes, _ := ioutil.ReadAll(response.Body)
+			idResult = string(bodyBytes)
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return idResult, errResult
+}
+
+// Petición al servidor para añadir una parte (cifrada) al contenido de un
+// adjunto. Devuelve los bytes que ha recibido el servidor hasta ahora
+func subirParteAdjunto(client *http.Client, attachmentID string, offset int64, parte []byte) (int64, error) {
+
+	var subidoResult int64
+	var errResult error
+
+	params := url.Values{}
+	params.Set("token", sessionToken)
+	params.Set("adjunto", attachmentID)
+	params.Set("offset", strconv.FormatInt(offset, 10))
+
+	// Realizamos la petición
+	response, err := client.Post(baseURL+"/adjuntos/subir?"+params.Encode(), "application/octet-stream", bytes.NewReader(parte))
+	if err == nil {
+		bodyBytes, _ := ioutil.ReadAll(response.Body)
+
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("not found")
+			case 409: // (409 - Conflict)
+				errResult = errors.New("invalid offset")
+			case 400, 413: // (400 - Bad Request, 413 - Request Entity Too Large)
+				errResult = errors.New("invalid size")
+			default:
+				errResult = errors.New("unknown")
+			}
+		} else {
+			subidoResult, _ = strconv.ParseInt(string(bodyBytes), 10, 64)
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return subidoResult, errResult
+}
+
+// Petición al servidor del contenido de un adjunto, que se descifra a medida
+// que se recibe y se guarda en el fichero indicado (que no debe existir)
+func descargarAdjunto(client *http.Client, attachmentID string, destino string) error {
+
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("adjunto", attachmentID)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/adjuntos/descargar", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("not found")
+			case 409: // (409 - Conflict)
+				errResult = errors.New("incomplete")
+			default:
+				errResult = errors.New("unknown")
+			}
+
+		} else if fichero, errCreate := os.OpenFile(destino, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600); errCreate != nil {
+			errResult = errors.New("unable to write")
+		} else {
+			defer fichero.Close()
+
+			// Desciframos bloque a bloque sin cargar el adjunto entero en memoria
+			bloque := make([]byte, config.AttachmentChunkSize)
+			for errResult == nil {
+				n, errRead := io.ReadFull(response.Body, bloque)
+				if errRead == io.EOF {
+					break
+				} else if (errRead != nil && errRead != io.ErrUnexpectedEOF) || n <= nonceAdjunto {
+					errResult = errors.New("unable to read")
+				} else if _, errWrite := fichero.Write(utils.CipherSalsa20(bloque[nonceAdjunto:n], keyData, bloque[:nonceAdjunto])); errWrite != nil {
+					errResult = errors.New("unable to write")
+				}
+			}
+			if errResult != nil {
+				// No dejamos un fichero a medias
+				os.Remove(destino)
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return errResult
+}
+
+// Petición al servidor para eliminar un adjunto
+func eliminarAdjunto(client *http.Client, attachmentID string) error {
+
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("adjunto", attachmentID)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/adjuntos/eliminar", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("not found")
+			default:
+				errResult = errors.New("unknown")
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return errResult
+}
+
+// buscarAdjunto devuelve el adjunto con el nombre indicado
+func buscarAdjunto(adjuntos []adjuntoEntrada, nombre string) (adjuntoEntrada, bool) {
+	for _, adjunto := range adjuntos {
+		if adjunto.Nombre == nombre {
+			return adjunto, true
+		}
+	}
+	return adjuntoEntrada{}, false
+}
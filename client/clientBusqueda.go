@@ -0,0 +1,172 @@
+package client
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bertus193/gestorSDS/model"
+)
+
+// Peso de cada campo en la puntuación de una búsqueda
+const (
+	pesoTitulo   = 10
+	pesoEtiqueta = 6
+	pesoCampo    = 5
+	pesoURL      = 4
+	pesoNota     = 2
+)
+
+// resultadoBusqueda es una entrada que coincide con la búsqueda
+type resultadoBusqueda struct {
+	ID           string
+	Entrada      model.VaultEntry
+	Puntuacion   int
+	Coincidencia string // Campo en el que mejor coincide
+}
+
+// campoBusqueda es cada texto de una entrada en el que se busca
+type campoBusqueda struct {
+	Etiqueta string
+	Texto    string
+	Peso     int
+}
+
+// quitarAcentos permite encontrar "contraseña" buscando "contrasena"
+var quitarAcentos = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u",
+	"à", "a", "è", "e", "ì", "i", "ò", "o", "ù", "u", "ñ", "n", "ç", "c")
+
+// normalizarBusqueda pasa el texto a minúsculas y sin acentos
+func normalizarBusqueda(texto string) string {
+	return quitarAcentos.Replace(strings.ToLower(texto))
+}
+
+// camposBusqueda devuelve los textos de la entrada en los que se busca:
+// título, etiquetas, URLs y los campos no secretos del tipo (usuario,
+// SSID), además del texto de las notas. Nunca se busca en las contraseñas
+func camposBusqueda(org organizacion, entry model.VaultEntry) []campoBusqueda {
+	campos := []campoBusqueda{{"Título", entry.Title, pesoTitulo}}
+	for _, etiqueta := range org.nombresEtiquetas(entry.Tags) {
+		campos = append(campos, campoBusqueda{"Etiqueta", etiqueta, pesoEtiqueta})
+	}
+	for _, url := range entry.URLs {
+		campos = append(campos, campoBusqueda{"URL", url, pesoURL})
+	}
+	if esquema, ok := model.BuscarTipoEntrada(entry.Type); ok {
+		for _, campo := range esquema.Campos {
+			if !campo.Buscable || entry.Fields[campo.Nombre] == "" {
+				continue
+			}
+			peso := pesoCampo
+			if campo.Multilinea {
+				peso = pesoNota
+			}
+			campos = append(campos, campoBusqueda{campo.Etiqueta, entry.Fields[campo.Nombre], peso})
+		}
+	}
+	return campos
+}
+
+// puntuacionTexto indica cuánto se parece el texto al término buscado (ya
+// normalizado): coincidencia exacta, al principio, al principio de una
+// palabra, en cualquier parte o, como mínimo, con las letras en orden
+// (búsqueda aproximada, "gml" encuentra "gmail"). 0 si no coincide
+func puntuacionTexto(termino string, texto string) int {
+	texto = normalizarBusqueda(texto)
+	if termino == "" || texto == "" {
+		return 0
+	}
+
+	switch pos := strings.Index(texto, termino); {
+	case texto == termino:
+		return 100
+	case pos == 0:
+		return 80
+	case pos > 0:
+		// Al principio de una palabra puntúa más que en medio
+		for ; pos != -1; pos = indexDesde(texto, termino, pos+1) {
+			if r, _ := utf8.DecodeLastRuneInString(texto[:pos]); !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return 60
+			}
+		}
+		return 40
+	}
+
+	// Letras del término en orden; cuanto más juntas, más puntuación
+	runasTermino := []rune(termino)
+	inicio, j := -1, 0
+	for i, r := range []rune(texto) {
+		if j < len(runasTermino) && r == runasTermino[j] {
+			if j == 0 {
+				inicio = i
+			}
+			j++
+			if j == len(runasTermino) {
+				result := 20 * len(runasTermino) / (i - inicio + 1)
+				if result < 1 {
+					result = 1
+				}
+				return result
+			}
+		}
+	}
+	return 0
+}
+
+// indexDesde es strings.Index a partir de la posición indicada
+func indexDesde(texto string, termino string, desde int) int {
+	if pos := strings.Index(texto[desde:], termino); pos != -1 {
+		return desde + pos
+	}
+	return -1
+}
+
+// buscarEntradas puntúa todas las entradas (ya descifradas) con la consulta
+// y devuelve las que coinciden ordenadas de mayor a menor puntuación. Si la
+// consulta tiene varias palabras, todas deben aparecer en algún campo
+func buscarEntradas(org organizacion, vault map[string]model.VaultEntry, consulta string) []resultadoBusqueda {
+	var resultados []resultadoBusqueda
+
+	terminos := strings.Fields(normalizarBusqueda(consulta))
+	if len(terminos) == 0 {
+		return resultados
+	}
+
+	for entryID, entry := range vault {
+		campos := camposBusqueda(org, entry)
+		resultado := resultadoBusqueda{ID: entryID, Entrada: entry}
+		mejorCampo := 0
+
+		for _, termino := range terminos {
+			mejor := 0
+			for _, campo := range campos {
+				if puntos := campo.Peso * puntuacionTexto(termino, campo.Texto); puntos > mejor {
+					mejor = puntos
+					if puntos > mejorCampo {
+						mejorCampo = puntos
+						resultado.Coincidencia = campo.Etiqueta
+					}
+				}
+			}
+			if mejor == 0 {
+				resultado.Puntuacion = 0
+				break
+			}
+			resultado.Puntuacion += mejor
+		}
+
+		if resultado.Puntuacion > 0 {
+			resultados = append(resultados, resultado)
+		}
+	}
+
+	sort.Slice(resultados, func(i, j int) bool {
+		if resultados[i].Puntuacion != resultados[j].Puntuacion {
+			return resultados[i].Puntuacion > resultados[j].Puntuacion
+		}
+		return resultados[i].Entrada.Title < resultados[j].Entrada.Title
+	})
+	return resultados
+}
@@ -0,0 +1,783 @@
+package client
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bertus193/gestorSDS/model"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// Variables de entorno con las credenciales para usar los
+// comandos sin que se pidan por teclado (scripts)
+const (
+	cliEmailEnv          = "GESTOR_EMAIL"
+	cliPasswordEnv       = "GESTOR_PASSWORD"
+	cliExportPasswordEnv = "GESTOR_EXPORT_PASSWORD" // Contraseña de las exportaciones cifradas
+)
+
+// cliLogin inicia sesión para los comandos de línea, pidiendo por
+// teclado los datos que no estén en las variables de entorno
+func cliLogin() error {
+	httpClient = newHTTPClient()
+
+	email := os.Getenv(cliEmailEnv)
+	if email == "" {
+		fmt.Fprint(os.Stderr, "Email: ")
+		email = utils.CustomScanf()
+	}
+	pass := os.Getenv(cliPasswordEnv)
+	if pass == "" {
+		fmt.Fprint(os.Stderr, "Contraseña: ")
+		pass = utils.GetPassw()
+		fmt.Fprintln(os.Stderr)
+	}
+
+	err := loginUsuario(httpClient, email, pass)
+	if err != nil && err.Error() == "a2f required" {
+		fmt.Fprint(os.Stderr, "Código de verificación enviado por correo: ")
+		err = desbloquearA2F(httpClient, utils.CustomScanf())
+	}
+	if err == nil {
+		migrarEntradasAntiguas(httpClient)
+	} else {
+		switch err.Error() {
+		case "user not found", "passwords do not match":
+			// No damos información detallada del error en este caso
+			err = errors.New("No exite ningún usuario con esos datos.")
+		default:
+			err = errors.New("Ocurrio un error al realizar el login (" + err.Error() + ").")
+		}
+	}
+	return err
+}
+
+// cliFail muestra el error del comando y termina con código de salida 1
+func cliFail(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(1)
+}
+
+// LaunchEntry ejecuta el comando "entry", que permite consultar una entrada
+// y editar sus campos personalizados y URLs desde la línea de comandos:
+//
+//	entry show [-reveal] <título>
+//	entry field set [-hidden] [-type tipo] <título> <nombre> <valor>
+//	entry field rm <título> <nombre>
+//	entry url add <título> <url>
+//	entry url rm <título> <url>
+//	entry history [-reveal] <título>
+//	entry restore <título> <versión>
+//	entry file ls <título>
+//	entry file add <título> <fichero>
+//	entry file get <título> <nombre> [destino]
+//	entry file rm <título> <nombre>
+//	entry otp set <título> <uri otpauth://>
+//	entry otp rm <título>
+//	entry expiry <título> <AAAA-MM-DD|->
+//	entry rotation <título> <días>
+//	entry renew <título>
+//	entry reminder <título> <nombre|->
+//	entry rules show <título>
+//	entry rules set [-allow clases] [-require clases] [-max-length n] [-forbid caracteres] <título>
+//	entry rules rm <título>
+func LaunchEntry(args []string) {
+	if len(args) == 0 {
+		cliFail("El número de parámetros introducido no es correcto.")
+	}
+
+	command := args[0]
+	if (command == "field" || command == "url" || command == "file" || command == "otp" || command == "rules") && len(args) > 1 {
+		command += " " + args[1]
+		args = args[1:]
+	}
+
+	flags := flag.NewFlagSet("entry "+command, flag.ContinueOnError)
+	reveal := flags.Bool("reveal", false, "mostrar también los campos ocultos (y los valores anteriores en history)")
+	hidden := flags.Bool("hidden", false, "el campo se muestra oculto")
+	tipo := flags.String("type", "text", "tipo del campo ("+strings.Join(model.TiposCampoPersonalizado, ", ")+")")
+	allow := flags.String("allow", "", "clases de caracteres permitidas, separadas por comas ("+strings.Join(utils.ClasesCaracteres, ", ")+")")
+	require := flags.String("require", "", "clases de caracteres obligatorias, separadas por comas")
+	maxLength := flags.Int("max-length", 0, "longitud máxima de la contraseña (0 para no limitarla)")
+	forbid := flags.String("forbid", "", "caracteres que no pueden aparecer en la contraseña")
+	if err := flags.Parse(args[1:]); err != nil {
+		os.Exit(2)
+	}
+	params := flags.Args()
+
+	switch {
+	case command == "show" && len(params) == 1:
+	case command == "history" && len(params) == 1:
+	case command == "restore" && len(params) == 2:
+	case command == "file ls" && len(params) == 1:
+	case command == "file add" && len(params) == 2:
+	case command == "file get" && (len(params) == 2 || len(params) == 3):
+	case command == "file rm" && len(params) == 2:
+	case command == "otp set" && len(params) == 2:
+	case command == "otp rm" && len(params) == 1:
+	case command == "expiry" && len(params) == 2:
+	case command == "rotation" && len(params) == 2:
+	case command == "renew" && len(params) == 1:
+	case command == "reminder" && len(params) == 2:
+	case command == "rules show" && len(params) == 1:
+	case command == "rules set" && len(params) == 1:
+	case command == "rules rm" && len(params) == 1:
+	case command == "field set" && len(params) == 3:
+		if !tipoCampoValido(*tipo) {
+			cliFail("El tipo de campo indicado no es válido.")
+		}
+	case command == "field rm" && len(params) == 2:
+	case command == "url add" && len(params) == 2:
+	case command == "url rm" && len(params) == 2:
+	default:
+		cliFail("El número de parámetros introducido no es correcto.")
+	}
+
+	if err := cliLogin(); err != nil {
+		cliFail("%s", err.Error())
+	}
+
+	titulo := params[0]
+	entryID, err := buscarEntrada(httpClient, titulo)
+	if err != nil {
+		cliFail("No se ha podido recuperar la entrada [%s] (%s).", titulo, err.Error())
+	}
+	entry, err := detallesEntrada(httpClient, entryID)
+	if err != nil {
+		cliFail("No se ha podido recuperar la entrada [%s] (%s).", titulo, err.Error())
+	}
+
+	switch command {
+	case "show":
+		imprimirEntradaCLI(titulo, entry, *reveal)
+		return
+	case "history":
+		imprimirRevisionesCLI(entryID, entry, *reveal)
+		return
+	case "restore":
+		n, errNum := strconv.Atoi(params[1])
+		if errNum != nil || n < 1 {
+			cliFail("El número de versión no es correcto.")
+		}
+		if err := restaurarRevision(httpClient, entryID, n-1); err != nil {
+			cliFail("No se ha podido restaurar la versión %d de [%s] (%s).", n, titulo, err.Error())
+		}
+		fmt.Printf("Versión %d de [%s] restaurada correctamente.\n", n, titulo)
+		return
+	case "file ls", "file add", "file get", "file rm":
+		adjuntosCLI(command, entryID, params)
+		return
+	case "rules show":
+		reglas, origen, errReglas := reglasEntrada(entry)
+		if errReglas != nil {
+			cliFail("No se ha podido leer el fichero de reglas por dominio (%s).", errReglas.Error())
+		}
+		fmt.Printf("%s (%s)\n", reglas, descripcionOrigenReglas(origen))
+		for _, contrasena := range contrasenasEntrada(entry) {
+			if incumplidas := reglas.Check(contrasena.Valor); len(incumplidas) != 0 {
+				fmt.Printf("%s: no cumple las reglas, %s\n", contrasena.Etiqueta, strings.Join(incumplidas, ", "))
+			}
+		}
+		return
+	case "rules set":
+		reglas := utils.PasswordRules{LongitudMaxima: *maxLength, Prohibidos: *forbid}
+		var errReglas error
+		if reglas.Permitidas, errReglas = utils.ParseClasses(*allow); errReglas == nil {
+			reglas.Obligatorias, errReglas = utils.ParseClasses(*require)
+		}
+		if errReglas == nil {
+			errReglas = setReglas(&entry, reglas)
+		}
+		if errReglas != nil {
+			cliFail("%s", descripcionErrorReglas(errReglas))
+		}
+	case "rules rm":
+		setReglas(&entry, utils.PasswordRules{})
+	case "otp set", "otp rm":
+		campo, ok := campoOTP(entry)
+		if !ok {
+			cliFail("La entrada [%s] no admite verificación en dos pasos.", titulo)
+		}
+		valor := ""
+		if command == "otp set" {
+			if valor, err = validarCampoOTP(params[1]); err != nil || valor == "" {
+				cliFail("La URI no es válida, debe empezar por otpauth://totp/ u otpauth://hotp/.")
+			}
+		}
+		entry.Fields[campo.Nombre] = valor
+	case "expiry":
+		expires, errFecha := validarFechaCaducidad(params[1])
+		if errFecha != nil {
+			cliFail("La fecha no es correcta, el formato es AAAA-MM-DD.")
+		}
+		setCaducidad(&entry, expires, entry.RotationDays)
+	case "rotation":
+		rotationDays, errDias := validarRotacion(params[1])
+		if errDias != nil {
+			cliFail("El número de días no es correcto.")
+		}
+		setCaducidad(&entry, entry.Expires, rotationDays)
+	case "renew":
+		renovarEntrada(&entry)
+	case "reminder":
+		nombre := params[1]
+		if nombre == "-" {
+			nombre = ""
+		}
+		if setRecordatorio(&entry, nombre) != nil {
+			cliFail("La entrada [%s] no caduca, fija antes una fecha o un intervalo de renovación.", titulo)
+		}
+	case "field set":
+		setCampoPersonalizado(&entry, model.CampoPersonalizado{Nombre: params[1], Valor: params[2], Tipo: *tipo, Oculto: *hidden})
+	case "field rm":
+		if !eliminarCampoPersonalizado(&entry, params[1]) {
+			cliFail("La entrada [%s] no tiene ningún campo [%s].", titulo, params[1])
+		}
+	case "url add":
+		entry.URLs = append(entry.URLs, params[1])
+	case "url rm":
+		if !eliminarURL(&entry, params[1]) {
+			cliFail("La entrada [%s] no tiene esa URL.", titulo)
+		}
+	}
+
+	if err := editarEntrada(httpClient, entryID, entry); err != nil {
+		cliFail("No se han podido guardar los cambios (%s).", err.Error())
+	}
+	fmt.Printf("Entrada [%s] actualizada correctamente.\n", titulo)
+}
+
+// adjuntosCLI ejecuta los comandos "entry file" sobre los adjuntos de la entrada
+func adjuntosCLI(command string, entryID string, params []string) {
+	titulo := params[0]
+	if command == "file add" {
+		if _, err := subirAdjunto(httpClient, entryID, params[1], nil); err != nil {
+			cliFail("No se ha podido adjuntar [%s] a [%s] (%s).", params[1], titulo, err.Error())
+		}
+		fmt.Printf("Fichero [%s] adjuntado a [%s] correctamente.\n", filepath.Base(params[1]), titulo)
+		return
+	}
+
+	adjuntos, err := listarAdjuntos(httpClient, entryID)
+	if err != nil {
+		cliFail("No se han podido recuperar los adjuntos de [%s] (%s).", titulo, err.Error())
+	}
+	if command == "file ls" {
+		for _, adjunto := range adjuntos {
+			estado := ""
+			if !adjunto.Completo {
+				estado = "\t(subida incompleta)"
+			}
+			fmt.Printf("%s\t%s\t%s%s\n", adjunto.Nombre, formatoTamano(adjunto.Tamano), adjunto.Fecha.Local().Format("2006-01-02 15:04"), estado)
+		}
+		return
+	}
+
+	adjunto, ok := buscarAdjunto(adjuntos, params[1])
+	if !ok {
+		cliFail("La entrada [%s] no tiene ningún adjunto [%s].", titulo, params[1])
+	}
+	switch command {
+	case "file get":
+		destino := filepath.Base(adjunto.Nombre)
+		if len(params) == 3 {
+			destino = params[2]
+		}
+		if err := descargarAdjunto(httpClient, adjunto.ID, destino); err != nil {
+			cliFail("No se ha podido descargar [%s] en [%s] (%s).", adjunto.Nombre, destino, err.Error())
+		}
+		fmt.Printf("Fichero [%s] guardado en [%s].\n", adjunto.Nombre, destino)
+	case "file rm":
+		if err := eliminarAdjunto(httpClient, adjunto.ID); err != nil {
+			cliFail("No se ha podido eliminar [%s] (%s).", adjunto.Nombre, err.Error())
+		}
+		fmt.Printf("Fichero [%s] eliminado de [%s].\n", adjunto.Nombre, titulo)
+	}
+}
+
+// imprimirRevisionesCLI muestra el historial de una entrada, con los cambios
+// de cada versión respecto a la siguiente (la más reciente, respecto a la actual)
+func imprimirRevisionesCLI(entryID string, entry model.VaultEntry, reveal bool) {
+	revisiones, err := leerRevisiones(httpClient, entryID)
+	if err != nil {
+		cliFail("No se ha podido recuperar el historial de [%s] (%s).", entry.Title, err.Error())
+	}
+	org, err := leerOrganizacion(httpClient)
+	if err != nil {
+		cliFail("No se han podido recuperar las carpetas y etiquetas (%s).", err.Error())
+	}
+	for i, revision := range revisiones {
+		siguiente := entry
+		if i > 0 {
+			siguiente = revisiones[i-1].Entrada
+		}
+		cambios := diferenciasEntradas(org, revision.Entrada, siguiente)
+		fmt.Printf("%d\t%s\t%s\n", i+1, revision.Fecha.Local().Format("2006-01-02 15:04:05"), nombresCambios(cambios))
+		for _, cambio := range cambios {
+			fmt.Printf("\t%s\n", cambio.texto(reveal))
+		}
+	}
+}
+
+// imprimirEntradaCLI muestra una entrada completa por la salida estándar
+func imprimirEntradaCLI(titulo string, entry model.VaultEntry, reveal bool) {
+	fmt.Printf("# %s (%s)\n", titulo, entry.Type)
+	if esquema, ok := model.BuscarTipoEntrada(entry.Type); ok {
+		for _, campo := range esquema.Campos {
+			if valor := entry.Fields[campo.Nombre]; valor != "" && campo.OTP {
+				fmt.Printf("Código 2FA: %s\n", descripcionOTP(entry))
+				if reveal {
+					fmt.Printf("%s: %s\n", campo.Etiqueta, valor)
+				}
+			} else if valor != "" {
+				fmt.Printf("%s: %s\n", campo.Etiqueta, valor)
+			}
+		}
+	} else {
+		for nombre, valor := range entry.Fields {
+			fmt.Printf("%s: %s\n", nombre, valor)
+		}
+	}
+	for _, campo := range entry.CustomFields {
+		valor := campo.Valor
+		if campo.Oculto && !reveal {
+			valor = "********"
+		}
+		fmt.Printf("%s (%s): %s\n", campo.Nombre, campo.Tipo, valor)
+	}
+	for _, url := range entry.URLs {
+		fmt.Printf("URL: %s\n", url)
+	}
+	if vence := vencimientoEntrada(entry); !vence.IsZero() {
+		fmt.Printf("Caducidad: %s\n", descripcionCaducidad(vence))
+	}
+	if entry.Reminder != nil {
+		fmt.Printf("Aviso por correo: %s\n", entry.Reminder.Nombre)
+	}
+	if reglas, origen, err := reglasEntrada(entry); err == nil && !reglas.Empty() {
+		fmt.Printf("Reglas de la contraseña: %s (%s)\n", reglas, descripcionOrigenReglas(origen))
+	}
+}
+
+// LaunchGet ejecuta el comando "get", que muestra solo la contraseña de una
+// entrada o, con -otp, su código 2FA actual (la validez se indica por la
+// salida de errores para poder usar el código en scripts):
+//
+//	get [-otp] <título>
+func LaunchGet(args []string) {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	otp := flags.Bool("otp", false, "mostrar el código 2FA actual en lugar de la contraseña")
+	if err := flags.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() != 1 {
+		cliFail("El número de parámetros introducido no es correcto.")
+	}
+
+	if err := cliLogin(); err != nil {
+		cliFail("%s", err.Error())
+	}
+
+	titulo := flags.Arg(0)
+	entryID, err := buscarEntrada(httpClient, titulo)
+	if err != nil {
+		cliFail("No se ha podido recuperar la entrada [%s] (%s).", titulo, err.Error())
+	}
+	entry, err := detallesEntrada(httpClient, entryID)
+	if err != nil {
+		cliFail("No se ha podido recuperar la entrada [%s] (%s).", titulo, err.Error())
+	}
+
+	if !*otp {
+		if entry.Fields["password"] == "" {
+			cliFail("La entrada [%s] no tiene contraseña.", titulo)
+		}
+		fmt.Println(entry.Fields["password"])
+		return
+	}
+
+	codigo, restante, err := generarCodigoOTP(httpClient, entryID, entry)
+	if err != nil && err.Error() == "no otp" {
+		cliFail("La entrada [%s] no tiene configurada la verificación en dos pasos.", titulo)
+	} else if err != nil {
+		cliFail("No se ha podido generar el código de [%s] (%s).", titulo, err.Error())
+	}
+	fmt.Println(codigo)
+	if restante > 0 {
+		fmt.Fprintf(os.Stderr, "Válido durante %d s\n", restante)
+	}
+}
+
+// LaunchList ejecuta el comando "list", que muestra las entradas (sin sus
+// datos secretos) filtradas por carpeta (incluidas sus subcarpetas) y etiqueta:
+//
+//	list [--folder /Trabajo/Servidores] [--tag nombre] [--expiring]
+func LaunchList(args []string) {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	folder := flags.String("folder", "", "mostrar solo las entradas de esta carpeta y sus subcarpetas")
+	tag := flags.String("tag", "", "mostrar solo las entradas con esta etiqueta")
+	expiring := flags.Bool("expiring", false, "mostrar solo las entradas caducadas o a punto de caducar")
+	if err := flags.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() != 0 {
+		cliFail("El número de parámetros introducido no es correcto.")
+	}
+
+	if err := cliLogin(); err != nil {
+		cliFail("%s", err.Error())
+	}
+
+	org, err := leerOrganizacion(httpClient)
+	if err != nil {
+		cliFail("No se han podido recuperar las carpetas y etiquetas (%s).", err.Error())
+	}
+	entradas, err := listarEntradas(httpClient)
+	if err != nil {
+		cliFail("No se han podido recuperar las entradas (%s).", err.Error())
+	}
+
+	folderID, ok := org.buscarCarpeta(*folder)
+	if !ok {
+		cliFail("No existe ninguna carpeta [%s].", *folder)
+	}
+	tagID := ""
+	if *tag != "" {
+		if tagID, ok = org.buscarEtiqueta(*tag); !ok {
+			cliFail("No existe ninguna etiqueta [%s].", *tag)
+		}
+	}
+
+	for _, entrada := range filtrarEntradas(org, entradas, folderID, true, tagID) {
+		if *expiring && !caducaPronto(entrada.Vence) {
+			continue
+		}
+		line := org.rutaCarpeta(entrada.Carpeta) + "\t" + entrada.Titulo + "\t(" + entrada.Tipo + ")"
+		if etiquetas := org.nombresEtiquetas(entrada.Etiquetas); len(etiquetas) != 0 {
+			line += "\t#" + strings.Join(etiquetas, " #")
+		}
+		if caducaPronto(entrada.Vence) {
+			line += "\t" + descripcionCaducidad(entrada.Vence)
+		}
+		fmt.Println(line)
+	}
+}
+
+// LaunchSearch ejecuta el comando "search", que busca en todas las entradas
+// (título, usuario, URLs, etiquetas y notas) y las muestra por relevancia:
+//
+//	search [-limit n] <consulta>
+func LaunchSearch(args []string) {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	limit := flags.Int("limit", 20, "número máximo de resultados (0 para mostrarlos todos)")
+	if err := flags.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	consulta := strings.Join(flags.Args(), " ")
+	if strings.TrimSpace(consulta) == "" {
+		cliFail("El número de parámetros introducido no es correcto.")
+	}
+
+	if err := cliLogin(); err != nil {
+		cliFail("%s", err.Error())
+	}
+
+	org, err := leerOrganizacion(httpClient)
+	if err != nil {
+		cliFail("No se han podido recuperar las carpetas y etiquetas (%s).", err.Error())
+	}
+	vault, err := leerBoveda(httpClient)
+	if err != nil {
+		cliFail("No se han podido recuperar las entradas (%s).", err.Error())
+	}
+
+	resultados := buscarEntradas(org, vault, consulta)
+	if len(resultados) == 0 {
+		cliFail("No hay ninguna entrada que coincida con la búsqueda.")
+	}
+	if *limit > 0 && len(resultados) > *limit {
+		resultados = resultados[:*limit]
+	}
+	for _, resultado := range resultados {
+		fmt.Printf("%s\t%s\t(%s)\t%s\n", org.rutaCarpeta(resultado.Entrada.Folder), resultado.Entrada.Title,
+			resultado.Entrada.Type, resultado.Coincidencia)
+	}
+}
+
+// LaunchHealth ejecuta el comando "health", que revisa en el cliente las
+// contraseñas de todas las entradas y muestra las filtradas, débiles,
+// reutilizadas o antiguas (termina con código 3 si encuentra algún problema):
+//
+//	health
+func LaunchHealth(args []string) {
+	if len(args) != 0 {
+		cliFail("El número de parámetros introducido no es correcto.")
+	}
+
+	if err := cliLogin(); err != nil {
+		cliFail("%s", err.Error())
+	}
+
+	vault, err := leerBoveda(httpClient)
+	if err != nil {
+		cliFail("No se han podido recuperar las entradas (%s).", err.Error())
+	}
+
+	problemas, errFiltradas := informeSalud(vault, func(password string) (int, error) {
+		return vecesFiltrada(httpClient, password)
+	})
+	if errFiltradas != nil {
+		fmt.Fprintf(os.Stderr, "No se ha podido comprobar si aparecen en filtraciones conocidas (%s).\n", descripcionErrorFiltradas(errFiltradas))
+	}
+	for _, problema := range problemas {
+		fmt.Printf("%s\t%s\t%s\t%s\n", problema.Tipo, problema.Titulo, problema.Campo.Etiqueta, problema.Detalle)
+	}
+	if len(problemas) != 0 {
+		os.Exit(3)
+	}
+}
+
+// LaunchGenerate ejecuta el comando "generate", que genera una contraseña
+// aleatoria, pronunciable o una frase de contraseña sin iniciar sesión. La
+// contraseña se escribe en la salida estándar y su entropía en la de errores.
+// Con -entry la contraseña cumple las reglas de esa entrada (o de su dominio):
+//
+//	generate [-entry título] [-length n] [-min-lower n] [-min-upper n] [-min-digits n] [-min-symbols n]
+//	         [-symbols caracteres] [-extra caracteres] [-exclude caracteres] [-no-ambiguous] [-pronounceable]
+//	generate [-entry título] -passphrase [-words n] [-separator texto] [-capitalize] [-digits n]
+func LaunchGenerate(args []string) {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	length := flags.Int("length", 20, "longitud de la contraseña")
+	minLower := flags.Int("min-lower", 1, "mínimo de minúsculas (negativo para excluirlas)")
+	minUpper := flags.Int("min-upper", 1, "mínimo de mayúsculas (negativo para excluirlas)")
+	minDigits := flags.Int("min-digits", 1, "mínimo de números (negativo para excluirlos)")
+	minSymbols := flags.Int("min-symbols", 1, "mínimo de símbolos (negativo para excluirlos)")
+	symbols := flags.String("symbols", utils.CaracteresSimbolos, "símbolos que pueden aparecer")
+	extra := flags.String("extra", "", "otros caracteres que pueden aparecer")
+	exclude := flags.String("exclude", "", "caracteres que no deben aparecer")
+	noAmbiguous := flags.Bool("no-ambiguous", false, "excluir los caracteres que se confunden ("+utils.CaracteresAmbiguos+")")
+	pronounceable := flags.Bool("pronounceable", false, "alternar consonantes y vocales (números y símbolos al final)")
+	passphrase := flags.Bool("passphrase", false, "generar una frase de contraseña con palabras al azar")
+	words := flags.Int("words", 6, "número de palabras de la frase")
+	separator := flags.String("separator", "-", "separador entre las palabras de la frase")
+	capitalize := flags.Bool("capitalize", false, "empezar cada palabra de la frase en mayúscula")
+	digits := flags.Int("digits", 0, "cifras añadidas al final de una de las palabras de la frase")
+	entryTitle := flags.String("entry", "", "cumplir las reglas de la contraseña de esta entrada (inicia sesión)")
+	if err := flags.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() != 0 {
+		cliFail("El número de parámetros introducido no es correcto.")
+	}
+
+	var reglas utils.PasswordRules
+	if *entryTitle != "" {
+		if err := cliLogin(); err != nil {
+			cliFail("%s", err.Error())
+		}
+		entryID, err := buscarEntrada(httpClient, *entryTitle)
+		if err != nil {
+			cliFail("No se ha podido recuperar la entrada [%s] (%s).", *entryTitle, err.Error())
+		}
+		entry, err := detallesEntrada(httpClient, entryID)
+		if err != nil {
+			cliFail("No se ha podido recuperar la entrada [%s] (%s).", *entryTitle, err.Error())
+		}
+		if reglas, _, err = reglasEntrada(entry); err != nil {
+			cliFail("No se ha podido leer el fichero de reglas por dominio (%s).", err.Error())
+		}
+	}
+
+	var password string
+	var entropia float64
+	var err error
+	if *passphrase {
+		password, entropia, err = utils.GeneratePassphrase(utils.PassphraseOptions{Palabras: *words, Separador: *separator, Mayusculas: *capitalize, Digitos: *digits})
+	} else {
+		password, entropia, err = utils.GeneratePasswordWithOptions(reglas.Apply(utils.PasswordOptions{
+			Longitud:      *length,
+			MinMinusculas: *minLower,
+			MinMayusculas: *minUpper,
+			MinNumeros:    *minDigits,
+			MinSimbolos:   *minSymbols,
+			Simbolos:      *symbols,
+			Adicionales:   *extra,
+			Excluidos:     *exclude,
+			SinAmbiguos:   *noAmbiguous,
+			Pronunciable:  *pronounceable,
+		}))
+	}
+	if err != nil {
+		cliFail("%s", descripcionErrorGenerador(err))
+	}
+	if incumplidas := reglas.Check(password); len(incumplidas) != 0 {
+		cliFail("La contraseña generada no cumple las reglas de [%s]: %s.", *entryTitle, strings.Join(incumplidas, ", "))
+	}
+
+	fmt.Println(password)
+	fmt.Fprintf(os.Stderr, "Entropía: %s\n", descripcionEntropia(entropia))
+}
+
+// LaunchImport ejecuta el comando "import", que importa las entradas de la
+// exportación de otro gestor (KeePass 2 XML, Bitwarden JSON sin cifrar,
+// 1Password 1PUX o CSV). Las entradas con el título de otra que ya existe se
+// omiten o, con -rename, se renombran. Con -dry-run solo se muestra qué se
+// importaría:
+//
+//	import [-format keepass|bitwarden|1pux|csv] [-map campo=columna,...] [-folder ruta] [-rename] [-dry-run] <fichero>
+func LaunchImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "formato del fichero (encrypted, keepass, bitwarden, 1pux o csv; por defecto, según la extensión)")
+	mapping := flags.String("map", "", "columnas del CSV de cada campo ("+strings.Join(camposCSV, ", ")+"), p. ej. title=Nombre,user=Usuario")
+	folder := flags.String("folder", "", "carpeta en la que se importan las entradas (se crea si no existe)")
+	rename := flags.Bool("rename", false, "importar las entradas duplicadas con otro título en lugar de omitirlas")
+	dryRun := flags.Bool("dry-run", false, "mostrar lo que se importaría sin guardar nada")
+	if err := flags.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() != 1 {
+		cliFail("El número de parámetros introducido no es correcto.")
+	}
+	fichero := flags.Arg(0)
+
+	formato := *format
+	if formato == "" {
+		formato = formatoImportacion(fichero)
+	}
+	mapeo, err := parsearMapeoCSV(*mapping)
+	if err != nil {
+		cliFail("%s", descripcionErrorImportacion(err))
+	}
+	contenido, err := ioutil.ReadFile(fichero)
+	if err != nil {
+		cliFail("No se ha podido leer el fichero (%s).", err.Error())
+	}
+	if formato == formatoCifrado {
+		// Las exportaciones cifradas son exportaciones de Bitwarden
+		password := os.Getenv(cliExportPasswordEnv)
+		if password == "" {
+			fmt.Fprint(os.Stderr, "Contraseña de la exportación: ")
+			password = utils.GetPassw()
+			fmt.Fprintln(os.Stderr)
+		}
+		if contenido, err = utils.OpenExportArchive(password, contenido); err != nil {
+			cliFail("%s", descripcionErrorExportacion(err))
+		}
+		formato = formatoBitwarden
+	}
+	entradas, err := leerImportacion(formato, contenido, mapeo)
+	if err != nil {
+		cliFail("%s", descripcionErrorImportacion(err))
+	}
+
+	if err := cliLogin(); err != nil {
+		cliFail("%s", err.Error())
+	}
+	existentes, err := listarEntradas(httpClient)
+	if err != nil {
+		cliFail("No se han podido recuperar las entradas (%s).", err.Error())
+	}
+	marcarDuplicadas(entradas, existentes, *rename)
+
+	if !*dryRun {
+		org, errOrg := leerOrganizacion(httpClient)
+		if errOrg != nil {
+			cliFail("No se han podido recuperar las carpetas y etiquetas (%s).", errOrg.Error())
+		}
+		importarEntradas(httpClient, &org, entradas, *folder)
+	}
+
+	// Una línea por entrada y el resumen (en la salida de errores)
+	estados := make(map[string]int)
+	for _, entrada := range entradas {
+		estados[entrada.Estado]++
+		line := entrada.Estado + "\t/" + strings.Trim(strings.Trim(*folder, "/")+"/"+entrada.Carpeta, "/") + "\t" + entrada.Entry.Title + "\t(" + entrada.Entry.Type + ")"
+		if entrada.Motivo != "" {
+			line += "\t" + entrada.Motivo
+		}
+		fmt.Println(line)
+	}
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "Se importarían %d entradas (%d renombradas) y se omitirían %d duplicadas. No se ha guardado nada.\n",
+			estados[importarNueva]+estados[importarRenombrada], estados[importarRenombrada], estados[importarDuplicada])
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Importadas %d entradas, omitidas %d duplicadas, %d con errores.\n",
+		estados[importarImportada], estados[importarDuplicada], estados[importarFallida])
+	if estados[importarFallida] != 0 {
+		os.Exit(1)
+	}
+}
+
+// LaunchExport ejecuta el comando "export", que guarda toda la bóveda en un
+// fichero compatible con Bitwarden:
+//
+//	export [-format encrypted|json|csv] [-yes] <fichero>
+//
+// Por defecto el fichero se cifra con una contraseña propia (se pide dos
+// veces o se toma de GESTOR_EXPORT_PASSWORD) y se puede volver a importar con
+// "import". Las exportaciones en claro piden confirmación salvo con -yes
+func LaunchExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", formatoCifrado, "formato del fichero (encrypted, json o csv)")
+	yes := flags.Bool("yes", false, "no pedir confirmación para exportar en claro")
+	if err := flags.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() != 1 {
+		cliFail("El número de parámetros introducido no es correcto.")
+	}
+	fichero := flags.Arg(0)
+	if *format != formatoCifrado && *format != formatoJSON && *format != formatoCSV {
+		cliFail("%s", descripcionErrorExportacion(errors.New("unknown format")))
+	}
+
+	if err := cliLogin(); err != nil {
+		cliFail("%s", err.Error())
+	}
+
+	password := ""
+	if *format == formatoCifrado {
+		if password = os.Getenv(cliExportPasswordEnv); password == "" {
+			fmt.Fprint(os.Stderr, "Contraseña de la exportación: ")
+			password = utils.GetPassw()
+			fmt.Fprint(os.Stderr, "\nRepite la contraseña: ")
+			repetida := utils.GetPassw()
+			fmt.Fprintln(os.Stderr)
+			if password != repetida {
+				cliFail("Las contraseñas no coinciden.")
+			}
+		}
+		if password == "" {
+			cliFail("La contraseña de la exportación no puede estar vacía.")
+		}
+	} else if !*yes {
+		fmt.Fprint(os.Stderr, "El fichero tendrá todas las contraseñas sin cifrar. Escribe \"si\" para continuar: ")
+		if respuesta := strings.ToLower(utils.CustomScanf()); respuesta != "si" && respuesta != "sí" {
+			cliFail("Exportación cancelada.")
+		}
+	}
+
+	org, err := leerOrganizacion(httpClient)
+	if err != nil {
+		cliFail("No se han podido recuperar las carpetas y etiquetas (%s).", err.Error())
+	}
+	boveda, err := leerBoveda(httpClient)
+	if err != nil {
+		cliFail("No se han podido recuperar las entradas (%s).", err.Error())
+	}
+	contenido, err := generarExportacion(*format, org, boveda, password)
+	if err != nil {
+		cliFail("%s", descripcionErrorExportacion(err))
+	}
+	if err := ioutil.WriteFile(fichero, contenido, 0600); err != nil {
+		cliFail("No se ha podido guardar el fichero (%s).", err.Error())
+	}
+	fmt.Fprintf(os.Stderr, "Exportadas %d entradas a %s. Los adjuntos, las versiones anteriores y la papelera no se exportan.\n", len(boveda), fichero)
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/model"
+)
+
+// formatoFecha es el formato de las fechas de caducidad y renovación
+const formatoFecha = "2006-01-02"
+
+// vencimiento calcula cuándo caduca una entrada: en su fecha límite o al
+// cumplirse el intervalo de renovación desde la última renovación, lo que
+// llegue antes. Devuelve cero si la entrada no caduca
+func vencimiento(expires string, rotationDays string, renewed string) time.Time {
+	var vence time.Time
+	if fecha, err := time.ParseInLocation(formatoFecha, expires, time.Local); err == nil {
+		vence = fecha
+	}
+	dias, errDias := strconv.Atoi(rotationDays)
+	renovada, errRenovada := time.ParseInLocation(formatoFecha, renewed, time.Local)
+	if errDias == nil && dias > 0 && errRenovada == nil {
+		if rotacion := renovada.AddDate(0, 0, dias); vence.IsZero() || rotacion.Before(vence) {
+			vence = rotacion
+		}
+	}
+	return vence
+}
+
+// vencimientoEntrada calcula cuándo caduca una entrada ya descifrada
+func vencimientoEntrada(entry model.VaultEntry) time.Time {
+	return vencimiento(entry.Expires, entry.RotationDays, entry.Renewed)
+}
+
+// diasHasta devuelve los días que faltan desde hoy hasta la fecha
+// (negativo si ya ha pasado)
+func diasHasta(fecha time.Time) int {
+	y, m, d := time.Now().Date()
+	hoy := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	return int(math.Round(fecha.Sub(hoy).Hours() / 24))
+}
+
+// caducada indica si la entrada ya ha caducado (o caduca hoy)
+func caducada(vence time.Time) bool {
+	return !vence.IsZero() && diasHasta(vence) <= 0
+}
+
+// caducaPronto indica si la entrada caduca en los próximos
+// config.ExpiryWarningDays días (o ya ha caducado)
+func caducaPronto(vence time.Time) bool {
+	return !vence.IsZero() && diasHasta(vence) <= config.ExpiryWarningDays
+}
+
+// descripcionCaducidad describe cuándo caduca una entrada
+func descripcionCaducidad(vence time.Time) string {
+	dias := diasHasta(vence)
+	switch {
+	case vence.IsZero():
+		return "no caduca"
+	case dias < -1:
+		return "caducada hace " + strconv.Itoa(-dias) + " días (" + vence.Format(formatoFecha) + ")"
+	case dias == -1:
+		return "caducada ayer (" + vence.Format(formatoFecha) + ")"
+	case dias == 0:
+		return "caduca hoy"
+	case dias == 1:
+		return "caduca mañana (" + vence.Format(formatoFecha) + ")"
+	default:
+		return "caduca en " + strconv.Itoa(dias) + " días (" + vence.Format(formatoFecha) + ")"
+	}
+}
+
+// hoy devuelve la fecha de hoy en el formato de las caducidades
+func hoy() string {
+	return time.Now().Format(formatoFecha)
+}
+
+// validarFechaCaducidad comprueba una fecha AAAA-MM-DD ("" o "-" la quitan)
+func validarFechaCaducidad(valor string) (string, error) {
+	valor = strings.TrimSpace(valor)
+	if valor == "" || valor == "-" {
+		return "", nil
+	}
+	if _, err := time.ParseInLocation(formatoFecha, valor, time.Local); err != nil {
+		return "", errors.New("invalid date")
+	}
+	return valor, nil
+}
+
+// validarRotacion comprueba un intervalo de renovación en días ("", "-" o 0 lo quitan)
+func validarRotacion(valor string) (string, error) {
+	valor = strings.TrimSpace(valor)
+	if valor == "" || valor == "-" || valor == "0" {
+		return "", nil
+	}
+	if dias, err := strconv.Atoi(valor); err != nil || dias < 0 {
+		return "", errors.New("invalid days")
+	}
+	return valor, nil
+}
+
+// setCaducidad cambia la fecha límite y el intervalo de renovación de la
+// entrada. Si no se había renovado nunca, se cuenta desde hoy
+func setCaducidad(entry *model.VaultEntry, expires string, rotationDays string) {
+	entry.Expires, entry.RotationDays = expires, rotationDays
+	if entry.RotationDays != "" && entry.Renewed == "" {
+		entry.Renewed = hoy()
+	}
+	actualizarRecordatorio(entry)
+}
+
+// renovarEntrada anota que la contraseña de la entrada se ha renovado hoy
+func renovarEntrada(entry *model.VaultEntry) {
+	entry.Renewed = hoy()
+	actualizarRecordatorio(entry)
+}
+
+// setRecordatorio comparte (o deja de compartir, con el nombre vacío) el aviso
+// de caducidad de la entrada. El servidor solo verá el nombre y la fecha
+func setRecordatorio(entry *model.VaultEntry, nombre string) error {
+	if nombre = strings.TrimSpace(nombre); nombre == "" {
+		entry.Reminder = nil
+		return nil
+	}
+	if vencimientoEntrada(*entry).IsZero() {
+		return errors.New("no expiry")
+	}
+	entry.Reminder = &model.Recordatorio{Nombre: nombre}
+	actualizarRecordatorio(entry)
+	return nil
+}
+
+// actualizarRecordatorio recalcula la fecha del aviso compartido, o lo quita
+// si la entrada ya no caduca
+func actualizarRecordatorio(entry *model.VaultEntry) {
+	if entry.Reminder == nil {
+		return
+	}
+	if vence := vencimientoEntrada(*entry); vence.IsZero() {
+		entry.Reminder = nil
+	} else {
+		entry.Reminder = &model.Recordatorio{Nombre: entry.Reminder.Nombre, Vence: vence}
+	}
+}
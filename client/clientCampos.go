@@ -0,0 +1,228 @@
+package client
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/bertus193/gestorSDS/model"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// entradaListado es una entrada del listado ya descifrada
+type entradaListado struct {
+	ID        string
+	Titulo    string
+	Tipo      string
+	Version   int
+	Carpeta   string
+	Etiquetas []string
+	Vence     time.Time // Cero si la entrada no caduca
+}
+
+// cifrarValor cifra un valor con la clave de datos del usuario y un nonce
+// aleatorio, que se guarda delante del texto cifrado (base64(nonce || cifrado))
+func cifrarValor(valor string) string {
+	nonce, _ := utils.GenerateRandomBytes(24)
+	return utils.EncodeBase64(append(nonce, utils.CipherSalsa20([]byte(valor), keyData, nonce)...))
+}
+
+// descifrarValor descifra un valor cifrado con cifrarValor
+func descifrarValor(valor string) string {
+	data := utils.DecodeBase64(valor)
+	if len(data) < 24 {
+		return ""
+	}
+	return string(utils.CipherSalsa20(data[24:], keyData, data[:24]))
+}
+
+// nonceCampo devuelve el nonce con el que se cifraba un campo en las entradas
+// anteriores a la versión 2 (derivado del título, que era la clave de la entrada)
+func nonceCampo(tituloEntrada string, campo string, legacy bool) []byte {
+	if legacy {
+		return []byte(tituloEntrada)
+	}
+	return []byte(tituloEntrada + "/" + campo)
+}
+
+// descifrarTexto descifra un valor de las entradas anteriores a la versión 2
+func descifrarTexto(valor string, nonce []byte) string {
+	return string(utils.CipherSalsa20(utils.DecodeBase64(valor), keyData, nonce))
+}
+
+// cifrarEntrada devuelve la entrada lista para enviarla al servidor, con todo
+// su contenido cifrado: título, tipo, campos, campos personalizados y URLs
+func cifrarEntrada(entry model.VaultEntry) model.VaultEntry {
+	result := model.VaultEntry{
+		Version: model.VersionEntrada,
+		Title:   cifrarValor(entry.Title),
+		Type:    cifrarValor(entry.Type),
+		Folder:  entry.Folder,
+		Tags:    entry.Tags,
+		Fields:  make(map[string]string),
+	}
+	for nombre, valor := range entry.Fields {
+		result.Fields[nombre] = cifrarValor(valor)
+	}
+	for _, campo := range entry.CustomFields {
+		result.CustomFields = append(result.CustomFields, model.CampoPersonalizado{
+			Nombre: cifrarValor(campo.Nombre),
+			Valor:  cifrarValor(campo.Valor),
+			Tipo:   cifrarValor(campo.Tipo),
+			Oculto: campo.Oculto,
+		})
+	}
+	for _, url := range entry.URLs {
+		result.URLs = append(result.URLs, cifrarValor(url))
+	}
+	result.Expires = cifrarOpcional(entry.Expires)
+	result.RotationDays = cifrarOpcional(entry.RotationDays)
+	result.Renewed = cifrarOpcional(entry.Renewed)
+	result.Rules = cifrarOpcional(entry.Rules)
+	result.Reminder = entry.Reminder
+	return result
+}
+
+// cifrarOpcional cifra un valor que puede no estar (vacío se queda vacío)
+func cifrarOpcional(valor string) string {
+	if valor == "" {
+		return ""
+	}
+	return cifrarValor(valor)
+}
+
+// descifrarOpcional descifra un valor que puede no estar
+func descifrarOpcional(valor string) string {
+	if valor == "" {
+		return ""
+	}
+	return descifrarValor(valor)
+}
+
+// descifrarEntrada devuelve la entrada con todo su contenido descifrado
+func descifrarEntrada(entryID string, entry model.VaultEntry) model.VaultEntry {
+	if entry.Version < model.VersionEntrada {
+		return descifrarEntradaAntigua(entryID, entry)
+	}
+
+	result := model.VaultEntry{
+		Version: entry.Version,
+		Title:   descifrarValor(entry.Title),
+		Type:    descifrarValor(entry.Type),
+		Folder:  entry.Folder,
+		Tags:    entry.Tags,
+		Fields:  make(map[string]string),
+	}
+	for nombre, valor := range entry.Fields {
+		result.Fields[nombre] = descifrarValor(valor)
+	}
+	for _, campo := range entry.CustomFields {
+		result.CustomFields = append(result.CustomFields, model.CampoPersonalizado{
+			Nombre: descifrarValor(campo.Nombre),
+			Valor:  descifrarValor(campo.Valor),
+			Tipo:   descifrarValor(campo.Tipo),
+			Oculto: campo.Oculto,
+		})
+	}
+	for _, url := range entry.URLs {
+		result.URLs = append(result.URLs, descifrarValor(url))
+	}
+	result.Expires = descifrarOpcional(entry.Expires)
+	result.RotationDays = descifrarOpcional(entry.RotationDays)
+	result.Renewed = descifrarOpcional(entry.Renewed)
+	result.Rules = descifrarOpcional(entry.Rules)
+	result.Reminder = entry.Reminder
+	return result
+}
+
+// descifrarEntradaAntigua descifra las entradas anteriores a la versión 2, en
+// las que el título es la clave y solo se cifraban los campos secretos. Los
+// campos de los tipos que este cliente no conoce se devuelven tal cual
+func descifrarEntradaAntigua(tituloEntrada string, entry model.VaultEntry) model.VaultEntry {
+	legacy := entry.Type == ""
+	result := model.VaultEntry{Title: tituloEntrada, Type: entry.Tipo(), Folder: entry.Folder, Tags: entry.Tags, Fields: make(map[string]string)}
+	for nombre, valor := range entry.Campos() {
+		result.Fields[nombre] = valor
+	}
+	if esquema, ok := model.BuscarTipoEntrada(result.Type); ok {
+		for _, campo := range esquema.Campos {
+			if valor, okCampo := result.Fields[campo.Nombre]; okCampo && campo.Cifrado {
+				result.Fields[campo.Nombre] = descifrarTexto(valor, nonceCampo(tituloEntrada, campo.Nombre, legacy))
+			}
+		}
+	}
+
+	for i, campo := range entry.CustomFields {
+		prefijo := "custom/" + strconv.Itoa(i) + "/"
+		result.CustomFields = append(result.CustomFields, model.CampoPersonalizado{
+			Nombre: descifrarTexto(campo.Nombre, nonceCampo(tituloEntrada, prefijo+"name", false)),
+			Valor:  descifrarTexto(campo.Valor, nonceCampo(tituloEntrada, prefijo+"value", false)),
+			Tipo:   descifrarTexto(campo.Tipo, nonceCampo(tituloEntrada, prefijo+"type", false)),
+			Oculto: campo.Oculto,
+		})
+	}
+	for i, url := range entry.URLs {
+		result.URLs = append(result.URLs, descifrarTexto(url, nonceCampo(tituloEntrada, "url/"+strconv.Itoa(i), false)))
+	}
+	return result
+}
+
+// descifrarResumen descifra una entrada del listado
+func descifrarResumen(entryID string, resumen model.ResumenEntrada) entradaListado {
+	if resumen.Version < model.VersionEntrada {
+		// En las entradas antiguas el identificador es el título
+		entry := model.VaultEntry{Mode: resumen.Mode, Type: resumen.Type}
+		return entradaListado{ID: entryID, Titulo: entryID, Tipo: entry.Tipo(), Version: resumen.Version, Carpeta: resumen.Folder, Etiquetas: resumen.Tags}
+	}
+	return entradaListado{
+		ID:        entryID,
+		Titulo:    descifrarValor(resumen.Title),
+		Tipo:      descifrarValor(resumen.Type),
+		Version:   resumen.Version,
+		Carpeta:   resumen.Folder,
+		Etiquetas: resumen.Tags,
+		Vence:     vencimiento(descifrarOpcional(resumen.Expires), descifrarOpcional(resumen.RotationDays), descifrarOpcional(resumen.Renewed)),
+	}
+}
+
+// setCampoPersonalizado sustituye el campo con el mismo nombre o lo añade al final
+func setCampoPersonalizado(entry *model.VaultEntry, campo model.CampoPersonalizado) {
+	for i := range entry.CustomFields {
+		if entry.CustomFields[i].Nombre == campo.Nombre {
+			entry.CustomFields[i] = campo
+			return
+		}
+	}
+	entry.CustomFields = append(entry.CustomFields, campo)
+}
+
+// eliminarCampoPersonalizado quita el campo con el nombre indicado
+func eliminarCampoPersonalizado(entry *model.VaultEntry, nombre string) bool {
+	for i := range entry.CustomFields {
+		if entry.CustomFields[i].Nombre == nombre {
+			entry.CustomFields = append(entry.CustomFields[:i], entry.CustomFields[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// eliminarURL quita la dirección indicada de la entrada
+func eliminarURL(entry *model.VaultEntry, url string) bool {
+	for i := range entry.URLs {
+		if entry.URLs[i] == url {
+			entry.URLs = append(entry.URLs[:i], entry.URLs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// tipoCampoValido comprueba que el tipo de campo personalizado existe
+func tipoCampoValido(tipo string) bool {
+	for _, t := range model.TiposCampoPersonalizado {
+		if t == tipo {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/bertus193/gestorSDS/model"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// Formatos de exportación. La exportación cifrada es el JSON de Bitwarden
+// cifrado con una contraseña propia (utils.SealExportArchive)
+const (
+	formatoCifrado   = "encrypted"
+	formatoJSON      = "json"
+	extensionCifrada = ".gsds"
+)
+
+// Columnas del CSV de Bitwarden, en su orden
+var columnasCSVBitwarden = []string{"folder", "favorite", "type", "name", "notes", "fields", "reprompt",
+	"login_uri", "login_username", "login_password", "login_totp"}
+
+// Documentos de identidad de Bitwarden (clave y nombre del documento)
+var documentosBitwarden = [][2]string{{"passportNumber", "Pasaporte"}, {"licenseNumber", "Permiso de conducir"}, {"ssn", "Número de la seguridad social"}}
+
+// generarExportacion genera el contenido del fichero de exportación de toda la
+// bóveda en el formato indicado. La contraseña solo se usa en la cifrada
+func generarExportacion(formato string, org organizacion, boveda map[string]model.VaultEntry, password string) ([]byte, error) {
+	exportacion := exportarBitwarden(org, boveda)
+	switch formato {
+	case formatoCifrado:
+		contenido, _ := json.Marshal(exportacion)
+		return utils.SealExportArchive(password, contenido)
+	case formatoJSON:
+		return json.MarshalIndent(exportacion, "", "  ")
+	case formatoCSV:
+		return exportarCSVBitwarden(exportacion), nil
+	}
+	return nil, errors.New("unknown format")
+}
+
+// exportarBitwarden convierte la bóveda al formato JSON de Bitwarden. Las
+// carpetas se exportan con su ruta completa ("Trabajo/Servidores"), que es
+// como Bitwarden indica las anidadas, y las entradas ordenadas por carpeta y título
+func exportarBitwarden(org organizacion, boveda map[string]model.VaultEntry) bitwardenExportacion {
+	exportacion := bitwardenExportacion{Carpetas: []bitwardenCarpeta{}, Elementos: []bitwardenElemento{}}
+	for folderID := range org.Carpetas {
+		exportacion.Carpetas = append(exportacion.Carpetas, bitwardenCarpeta{ID: folderID, Nombre: strings.TrimPrefix(org.rutaCarpeta(folderID), "/")})
+	}
+	sort.Slice(exportacion.Carpetas, func(i, j int) bool { return exportacion.Carpetas[i].Nombre < exportacion.Carpetas[j].Nombre })
+
+	for _, entry := range boveda {
+		elemento := elementoBitwarden(entry)
+		if _, ok := org.Carpetas[entry.Folder]; ok {
+			elemento.Carpeta = entry.Folder
+		}
+		elemento.Extension.Etiquetas = org.nombresEtiquetas(entry.Tags)
+		exportacion.Elementos = append(exportacion.Elementos, elemento)
+	}
+	sort.Slice(exportacion.Elementos, func(i, j int) bool {
+		a, b := exportacion.Elementos[i], exportacion.Elementos[j]
+		rutaA, rutaB := org.rutaCarpeta(a.Carpeta), org.rutaCarpeta(b.Carpeta)
+		if rutaA != rutaB {
+			return rutaA < rutaB
+		}
+		return a.Nombre < b.Nombre
+	})
+	return exportacion
+}
+
+// elementoBitwarden convierte una entrada al elemento de Bitwarden más
+// parecido: las cuentas son inicios de sesión (1), las tarjetas e identidades
+// sus tipos (3 y 4) y el resto notas seguras (2) con sus datos como campos.
+// Lo que Bitwarden no tiene (direcciones fuera de las cuentas, campos sin
+// equivalente) se exporta como campos personalizados
+func elementoBitwarden(entry model.VaultEntry) bitwardenElemento {
+	elemento := bitwardenElemento{Nombre: entry.Title}
+	agregarCampo := func(nombre string, valor string, oculto bool) {
+		if strings.TrimSpace(valor) == "" {
+			return
+		}
+		campo := bitwardenCampo{Nombre: nombre, Valor: valor}
+		if oculto {
+			campo.Tipo = 1
+		}
+		elemento.Campos = append(elemento.Campos, campo)
+	}
+
+	// Campos del tipo que no tienen equivalente en Bitwarden
+	var otros []string
+	switch entry.Type {
+	case model.TipoCuenta:
+		elemento.Tipo = 1
+		elemento.Login = &bitwardenLogin{Usuario: entry.Fields["user"], Contrasena: entry.Fields["password"], TOTP: entry.Fields["otp"]}
+		for _, direccion := range entry.URLs {
+			elemento.Login.URIs = append(elemento.Login.URIs, bitwardenURI{URI: direccion})
+		}
+	case model.TipoTarjeta:
+		elemento.Tipo = 3
+		elemento.Tarjeta = &bitwardenTarjeta{Titular: entry.Fields["holder"], Numero: entry.Fields["number"], Codigo: entry.Fields["cvv"]}
+		if partes := strings.SplitN(entry.Fields["expiry"], "/", 2); len(partes) == 2 {
+			elemento.Tarjeta.Mes = strings.TrimLeft(strings.TrimSpace(partes[0]), "0")
+			if elemento.Tarjeta.Anyo = strings.TrimSpace(partes[1]); len(elemento.Tarjeta.Anyo) == 2 {
+				elemento.Tarjeta.Anyo = "20" + elemento.Tarjeta.Anyo
+			}
+		} else {
+			otros = append(otros, "expiry")
+		}
+		otros = append(otros, "pin")
+	case model.TipoIdentidad:
+		elemento.Tipo = 4
+		elemento.Identidad = make(map[string]interface{})
+		if nombre := strings.Fields(entry.Fields["fullName"]); len(nombre) != 0 {
+			elemento.Identidad["firstName"] = nombre[0]
+			elemento.Identidad["lastName"] = strings.Join(nombre[1:], " ")
+		}
+		elemento.Identidad["country"] = entry.Fields["country"]
+		documento := ""
+		for _, candidato := range documentosBitwarden {
+			if strings.EqualFold(strings.TrimSpace(entry.Fields["docType"]), candidato[1]) {
+				documento = candidato[0]
+			}
+		}
+		if documento != "" {
+			elemento.Identidad[documento] = entry.Fields["number"]
+		} else {
+			otros = append(otros, "docType", "number")
+		}
+		otros = append(otros, "birthDate", "expiry")
+	case model.TipoTexto:
+		elemento.Tipo = 2
+		elemento.NotaSegura = &bitwardenNotaSegura{}
+		elemento.Notas = entry.Fields["text"]
+	default:
+		elemento.Tipo = 2
+		elemento.NotaSegura = &bitwardenNotaSegura{}
+		for nombre := range entry.Fields {
+			otros = append(otros, nombre)
+		}
+		sort.Strings(otros)
+	}
+
+	// Los campos del tipo sin equivalente van en el orden del esquema
+	if esquema, ok := model.BuscarTipoEntrada(entry.Type); ok {
+		for _, campo := range esquema.Campos {
+			if contiene(otros, campo.Nombre) {
+				agregarCampo(campo.Etiqueta, entry.Fields[campo.Nombre], campo.Cifrado)
+			}
+		}
+	} else {
+		for _, nombre := range otros {
+			agregarCampo(nombre, entry.Fields[nombre], true)
+		}
+	}
+	if entry.Type != model.TipoCuenta {
+		for _, direccion := range entry.URLs {
+			agregarCampo("URL", direccion, false)
+		}
+	}
+	for _, campo := range entry.CustomFields {
+		agregarCampo(campo.Nombre, campo.Valor, campo.Oculto)
+	}
+
+	// La entrada completa, para volver a importarla aquí sin perder nada
+	completa := entry
+	completa.Version, completa.Folder, completa.Tags, completa.Reminder = 0, "", nil, nil
+	elemento.Extension = &extensionBitwarden{Entrada: completa}
+	return elemento
+}
+
+// exportarCSVBitwarden escribe los elementos en el CSV de Bitwarden, que solo
+// tiene inicios de sesión y notas: el resto de elementos se escriben como
+// notas con sus datos en la columna de campos ("nombre: valor" por línea). Los
+// valores de varias líneas no caben en esa columna y se añaden a las notas
+func exportarCSVBitwarden(exportacion bitwardenExportacion) []byte {
+	carpetas := make(map[string]string)
+	for _, carpeta := range exportacion.Carpetas {
+		carpetas[carpeta.ID] = carpeta.Nombre
+	}
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write(columnasCSVBitwarden)
+	for _, elemento := range exportacion.Elementos {
+		notas := []string{}
+		if elemento.Notas != "" {
+			notas = append(notas, elemento.Notas)
+		}
+		var campos []string
+		agregarCampo := func(nombre string, valor string) {
+			switch {
+			case strings.TrimSpace(valor) == "":
+			case strings.Contains(valor, "\n"):
+				notas = append(notas, nombre+":\n"+valor)
+			default:
+				campos = append(campos, nombre+": "+valor)
+			}
+		}
+
+		fila := map[string]string{"folder": carpetas[elemento.Carpeta], "name": elemento.Nombre, "type": "note"}
+		switch {
+		case elemento.Login != nil:
+			fila["type"] = "login"
+			var uris []string
+			for _, uri := range elemento.Login.URIs {
+				uris = append(uris, uri.URI)
+			}
+			fila["login_uri"] = strings.Join(uris, ",")
+			fila["login_username"] = elemento.Login.Usuario
+			fila["login_password"] = elemento.Login.Contrasena
+			fila["login_totp"] = elemento.Login.TOTP
+		case elemento.Tarjeta != nil:
+			agregarCampo("Titular", elemento.Tarjeta.Titular)
+			agregarCampo("Número", elemento.Tarjeta.Numero)
+			if elemento.Tarjeta.Mes != "" || elemento.Tarjeta.Anyo != "" {
+				agregarCampo("Caducidad", caducidadTarjeta(elemento.Tarjeta.Mes, elemento.Tarjeta.Anyo))
+			}
+			agregarCampo("CVV", elemento.Tarjeta.Codigo)
+		case elemento.Identidad != nil:
+			valor := func(clave string) string {
+				texto, _ := elemento.Identidad[clave].(string)
+				return texto
+			}
+			agregarCampo("Nombre completo", strings.TrimSpace(valor("firstName")+" "+valor("lastName")))
+			agregarCampo("País de expedición", valor("country"))
+			for _, documento := range documentosBitwarden {
+				agregarCampo(documento[1], valor(documento[0]))
+			}
+		}
+		for _, campo := range elemento.Campos {
+			agregarCampo(campo.Nombre, campo.Valor)
+		}
+		fila["notes"] = strings.Join(notas, "\n\n")
+		fila["fields"] = strings.Join(campos, "\n")
+
+		linea := make([]string, len(columnasCSVBitwarden))
+		for i, columna := range columnasCSVBitwarden {
+			linea[i] = fila[columna]
+		}
+		writer.Write(linea)
+	}
+	writer.Flush()
+	return buffer.Bytes()
+}
+
+// descripcionErrorExportacion explica por qué no se ha podido exportar o abrir
+// una exportación cifrada
+func descripcionErrorExportacion(err error) string {
+	switch err.Error() {
+	case "unknown format":
+		return "El formato de exportación no es correcto (" + strings.Join([]string{formatoCifrado, formatoJSON, formatoCSV}, ", ") + ")."
+	case "wrong password":
+		return "La contraseña de la exportación no es correcta o el fichero está dañado."
+	case "unsupported version":
+		return "La exportación es de una versión que este cliente no sabe leer."
+	case "invalid file":
+		return "El fichero no es una exportación cifrada o está dañado."
+	}
+	return err.Error()
+}
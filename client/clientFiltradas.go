@@ -0,0 +1,107 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// Lista local de contraseñas filtradas (se abre la primera vez que se usa)
+// y rangos ya consultados al servidor, por prefijo
+var listaFiltradas *utils.PwnedList
+var listaFiltradasAbierta bool
+var rangosFiltradas = make(map[string][]string)
+
+// vecesFiltrada devuelve cuántas veces aparece la contraseña en filtraciones
+// conocidas. Se busca en la lista local (config.PwnedPasswordsFile) o, si no
+// existe, se piden al servidor los hashes que empiezan por los 5 primeros
+// caracteres del de la contraseña (k-anonimato): la contraseña no sale del
+// cliente y el servidor no sabe cuál de los hashes del rango se buscaba
+func vecesFiltrada(client *http.Client, password string) (int, error) {
+	if !listaFiltradasAbierta {
+		listaFiltradasAbierta = true
+		if lista, err := utils.OpenPwnedList(config.PwnedPasswordsFile); err == nil {
+			listaFiltradas = lista
+		}
+	}
+	if listaFiltradas != nil {
+		return listaFiltradas.Count(password)
+	}
+
+	prefijo := utils.PwnedHash(password)[:5]
+	rango, ok := rangosFiltradas[prefijo]
+	if !ok {
+		var err error
+		if rango, err = consultarRangoFiltradas(client, prefijo); err != nil {
+			return 0, err
+		}
+		rangosFiltradas[prefijo] = rango
+	}
+	return utils.PwnedRangeCount(password, rango), nil
+}
+
+// Petición al servidor de los hashes de contraseñas filtradas que empiezan
+// por el prefijo indicado ("SUFIJO:VECES" por línea)
+func consultarRangoFiltradas(client *http.Client, prefijo string) ([]string, error) {
+
+	var rangeResult []string
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("prefijo", prefijo)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/filtradas/rango", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("unavailable")
+			default:
+				errResult = errors.New("unknown")
+			}
+
+		} else {
+			// Leemos la respuesta
+			if contents, errRead := ioutil.ReadAll(response.Body); errRead != nil {
+				errResult = errors.New("unable to read")
+			} else if len(contents) != 0 {
+				rangeResult = strings.Split(string(contents), "\n")
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return rangeResult, errResult
+}
+
+// descripcionErrorFiltradas explica por qué no se han podido comprobar las filtraciones
+func descripcionErrorFiltradas(err error) string {
+	switch err.Error() {
+	case "unavailable":
+		return "no hay ninguna lista de contraseñas filtradas en el cliente ni en el servidor"
+	case "unauthorized":
+		return "la sesión de usuario ha caducado"
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"strconv"
+
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// descripcionEntropia resume la entropía de una contraseña generada con la
+// misma escala que el estimador de fortaleza
+func descripcionEntropia(entropia float64) string {
+	return "~" + strconv.Itoa(int(entropia)) + " bits, " + nombresFortaleza[utils.StrengthScore(entropia)]
+}
+
+// descripcionErrorGenerador explica por qué no se ha podido generar la contraseña
+func descripcionErrorGenerador(err error) string {
+	switch err.Error() {
+	case "invalid length":
+		return "La longitud indicada no es válida."
+	case "minimums exceed length":
+		return "La suma de los mínimos de cada tipo de carácter es mayor que la longitud."
+	case "empty character class":
+		return "Se exige algún tipo de carácter del que se han excluido todos."
+	case "no characters":
+		return "No queda ningún carácter con el que generar la contraseña."
+	}
+	return err.Error()
+}
@@ -0,0 +1,857 @@
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bertus193/gestorSDS/model"
+)
+
+// Formatos de importación
+const (
+	formatoKeePass   = "keepass"
+	formatoBitwarden = "bitwarden"
+	formato1PUX      = "1pux"
+	formatoCSV       = "csv"
+)
+
+// Estado de cada entrada al importar
+const (
+	importarNueva       = "nueva"
+	importarDuplicada   = "duplicada"
+	importarRenombrada  = "renombrada"
+	importarImportada   = "importada"
+	importarFallida     = "error"
+	tituloSinNombre     = "Sin título"
+	campoNotasImportado = "Notas"
+)
+
+// entradaImportada es una entrada leída de la exportación de otro gestor,
+// todavía en claro. La carpeta es la ruta ("Trabajo/Servidores") y las
+// etiquetas sus nombres: se crean al importar si no existen
+type entradaImportada struct {
+	Entry     model.VaultEntry
+	Carpeta   string
+	Etiquetas []string
+	Estado    string
+	Motivo    string // Por qué se omite o se renombra
+}
+
+// formatoImportacion deduce el formato por la extensión del fichero
+func formatoImportacion(fichero string) string {
+	switch strings.ToLower(filepath.Ext(fichero)) {
+	case ".xml":
+		return formatoKeePass
+	case ".json":
+		return formatoBitwarden
+	case ".1pux":
+		return formato1PUX
+	case ".csv":
+		return formatoCSV
+	case extensionCifrada:
+		return formatoCifrado
+	}
+	return ""
+}
+
+// leerImportacion lee las entradas de una exportación en el formato indicado.
+// El mapeo de columnas (campo -> columna) solo se usa en CSV
+func leerImportacion(formato string, contenido []byte, mapeo map[string]string) ([]entradaImportada, error) {
+	var entradas []entradaImportada
+	var err error
+	switch formato {
+	case formatoKeePass:
+		entradas, err = importarKeePass(contenido)
+	case formatoBitwarden:
+		entradas, err = importarBitwarden(contenido)
+	case formato1PUX:
+		entradas, err = importar1PUX(contenido)
+	case formatoCSV:
+		entradas, err = importarCSV(contenido, mapeo)
+	default:
+		return nil, errors.New("unknown format")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range entradas {
+		normalizarImportada(&entradas[i])
+	}
+	return entradas, nil
+}
+
+// nuevaImportada crea una entrada importada del tipo indicado con todos sus campos
+func nuevaImportada(tipo string, titulo string) entradaImportada {
+	entry := model.VaultEntry{Title: strings.TrimSpace(titulo), Type: tipo, Fields: make(map[string]string)}
+	if esquema, ok := model.BuscarTipoEntrada(tipo); ok {
+		for _, campo := range esquema.Campos {
+			entry.Fields[campo.Nombre] = ""
+		}
+	}
+	return entradaImportada{Entry: entry, Estado: importarNueva}
+}
+
+// agregarCampo añade un campo personalizado (si tiene valor)
+func (e *entradaImportada) agregarCampo(nombre string, valor string, oculto bool) {
+	if strings.TrimSpace(valor) == "" {
+		return
+	}
+	if strings.TrimSpace(nombre) == "" {
+		nombre = "Campo"
+	}
+	tipo := "text"
+	if oculto {
+		tipo = "password"
+	}
+	e.Entry.CustomFields = append(e.Entry.CustomFields, model.CampoPersonalizado{Nombre: nombre, Valor: valor, Tipo: tipo, Oculto: oculto})
+}
+
+// agregarURL añade una dirección a la entrada (si tiene valor y no está ya)
+func (e *entradaImportada) agregarURL(direccion string) {
+	if direccion = strings.TrimSpace(direccion); direccion != "" && !contiene(e.Entry.URLs, direccion) {
+		e.Entry.URLs = append(e.Entry.URLs, direccion)
+	}
+}
+
+// agregarNotas guarda las notas en el texto de las notas seguras o, en el
+// resto de tipos (que no tienen notas), en un campo personalizado
+func (e *entradaImportada) agregarNotas(notas string) {
+	if strings.TrimSpace(notas) == "" {
+		return
+	}
+	if e.Entry.Type == model.TipoTexto {
+		if e.Entry.Fields["text"] != "" {
+			notas = e.Entry.Fields["text"] + "\n" + notas
+		}
+		e.Entry.Fields["text"] = notas
+		return
+	}
+	e.agregarCampo(campoNotasImportado, notas, false)
+}
+
+// agregarOTP guarda la semilla 2FA de una cuenta como URI otpauth://. Los
+// gestores que guardan solo el secreto en base32 se convierten a TOTP y lo
+// que no se entiende se guarda oculto en un campo personalizado
+func (e *entradaImportada) agregarOTP(valor string) {
+	if valor = strings.TrimSpace(valor); valor == "" {
+		return
+	}
+	if e.Entry.Type == model.TipoCuenta {
+		if uri, err := validarCampoOTP(valor); err == nil {
+			e.Entry.Fields["otp"] = uri
+			return
+		}
+		uri := "otpauth://totp/" + url.PathEscape(e.Entry.Title) + "?secret=" + url.QueryEscape(strings.Replace(valor, " ", "", -1))
+		if uri, err := validarCampoOTP(uri); err == nil {
+			e.Entry.Fields["otp"] = uri
+			return
+		}
+	}
+	e.agregarCampo("TOTP", valor, true)
+}
+
+// normalizarImportada completa lo que falta de una entrada leída: título,
+// cuentas sin usuario ni contraseña que en realidad son notas, etc
+func normalizarImportada(e *entradaImportada) {
+	if e.Entry.Title == "" {
+		e.Entry.Title = tituloSinNombre
+	}
+	if e.Entry.Type == model.TipoCuenta && e.Entry.Fields["user"] == "" && e.Entry.Fields["password"] == "" &&
+		e.Entry.Fields["otp"] == "" && len(e.Entry.URLs) == 0 {
+		// Sin datos de la cuenta: si solo tiene notas, es una nota segura
+		if len(e.Entry.CustomFields) == 1 && e.Entry.CustomFields[0].Nombre == campoNotasImportado {
+			notas := e.Entry.CustomFields[0].Valor
+			e.Entry = model.VaultEntry{Title: e.Entry.Title, Type: model.TipoTexto, Fields: map[string]string{"text": notas}}
+		}
+	}
+	e.Carpeta = strings.Trim(e.Carpeta, "/")
+}
+
+// ---------------------------------------------------------------------------
+// KeePass 2 (XML sin cifrar)
+
+type keePassGrupo struct {
+	UUID     string           `xml:"UUID"`
+	Nombre   string           `xml:"Name"`
+	Entradas []keePassEntrada `xml:"Entry"`
+	Grupos   []keePassGrupo   `xml:"Group"`
+}
+
+type keePassEntrada struct {
+	Etiquetas string         `xml:"Tags"`
+	Valores   []keePassValor `xml:"String"`
+}
+
+type keePassValor struct {
+	Clave string `xml:"Key"`
+	Valor struct {
+		Texto     string `xml:",chardata"`
+		Protegido string `xml:"ProtectInMemory,attr"`
+	} `xml:"Value"`
+}
+
+// importarKeePass lee la exportación XML de KeePass 2 (o KeePassXC). El grupo
+// raíz no se convierte en carpeta, los subgrupos sí; la papelera se ignora
+func importarKeePass(contenido []byte) ([]entradaImportada, error) {
+	var fichero struct {
+		XMLName  xml.Name       `xml:"KeePassFile"`
+		Papelera string         `xml:"Meta>RecycleBinUUID"`
+		Grupos   []keePassGrupo `xml:"Root>Group"`
+	}
+	if err := xml.Unmarshal(contenido, &fichero); err != nil {
+		return nil, errors.New("invalid file")
+	}
+
+	var result []entradaImportada
+	var recorrer func(grupo keePassGrupo, ruta string)
+	recorrer = func(grupo keePassGrupo, ruta string) {
+		if fichero.Papelera != "" && grupo.UUID == fichero.Papelera {
+			return
+		}
+		for _, entrada := range grupo.Entradas {
+			result = append(result, importarEntradaKeePass(entrada, ruta))
+		}
+		for _, subgrupo := range grupo.Grupos {
+			recorrer(subgrupo, ruta+"/"+subgrupo.Nombre)
+		}
+	}
+	for _, raiz := range fichero.Grupos {
+		recorrer(raiz, "")
+	}
+	return result, nil
+}
+
+// importarEntradaKeePass convierte una entrada de KeePass en una cuenta
+func importarEntradaKeePass(entrada keePassEntrada, ruta string) entradaImportada {
+	valores := make(map[string]string)
+	for _, valor := range entrada.Valores {
+		valores[valor.Clave] = valor.Valor.Texto
+	}
+
+	result := nuevaImportada(model.TipoCuenta, valores["Title"])
+	result.Carpeta = ruta
+	result.Entry.Fields["user"] = valores["UserName"]
+	result.Entry.Fields["password"] = valores["Password"]
+	result.agregarURL(valores["URL"])
+	for _, valor := range entrada.Valores {
+		switch valor.Clave {
+		case "Title", "UserName", "Password", "URL", "Notes":
+		case "otp", "TOTP Seed":
+			result.agregarOTP(valor.Valor.Texto)
+		default:
+			result.agregarCampo(valor.Clave, valor.Valor.Texto, strings.EqualFold(valor.Valor.Protegido, "true"))
+		}
+	}
+	result.agregarNotas(valores["Notes"])
+	for _, etiqueta := range strings.FieldsFunc(entrada.Etiquetas, func(r rune) bool { return r == ';' || r == ',' }) {
+		result.Etiquetas = append(result.Etiquetas, strings.TrimSpace(etiqueta))
+	}
+	return result
+}
+
+// ---------------------------------------------------------------------------
+// Bitwarden (JSON sin cifrar)
+
+// bitwardenExportacion es el fichero JSON de Bitwarden. También es el formato
+// de las exportaciones de este gestor (ver clientExportar.go)
+type bitwardenExportacion struct {
+	Cifrado   bool                `json:"encrypted"`
+	Carpetas  []bitwardenCarpeta  `json:"folders"`
+	Elementos []bitwardenElemento `json:"items"`
+}
+
+type bitwardenCarpeta struct {
+	ID     string `json:"id"`
+	Nombre string `json:"name"`
+}
+
+type bitwardenElemento struct {
+	Tipo       int                    `json:"type"`
+	Nombre     string                 `json:"name"`
+	Notas      string                 `json:"notes"`
+	Favorito   bool                   `json:"favorite"`
+	Carpeta    string                 `json:"folderId,omitempty"`
+	Borrado    string                 `json:"deletedDate,omitempty"`
+	Campos     []bitwardenCampo       `json:"fields,omitempty"`
+	Login      *bitwardenLogin        `json:"login,omitempty"`
+	NotaSegura *bitwardenNotaSegura   `json:"secureNote,omitempty"`
+	Tarjeta    *bitwardenTarjeta      `json:"card,omitempty"`
+	Identidad  map[string]interface{} `json:"identity,omitempty"`
+	Extension  *extensionBitwarden    `json:"gestorSDS,omitempty"`
+}
+
+type bitwardenCampo struct {
+	Nombre string `json:"name"`
+	Valor  string `json:"value"`
+	Tipo   int    `json:"type"` // 0 texto, 1 oculto, 2 booleano, 3 enlazado
+}
+
+type bitwardenLogin struct {
+	URIs       []bitwardenURI `json:"uris,omitempty"`
+	Usuario    string         `json:"username"`
+	Contrasena string         `json:"password"`
+	TOTP       string         `json:"totp,omitempty"`
+}
+
+type bitwardenURI struct {
+	URI string `json:"uri"`
+}
+
+type bitwardenNotaSegura struct {
+	Tipo int `json:"type"` // Siempre 0 (genérica)
+}
+
+type bitwardenTarjeta struct {
+	Titular string `json:"cardholderName"`
+	Marca   string `json:"brand"`
+	Numero  string `json:"number"`
+	Mes     string `json:"expMonth"`
+	Anyo    string `json:"expYear"`
+	Codigo  string `json:"code"`
+}
+
+// extensionBitwarden es la parte propia de los elementos que exporta este
+// gestor: la entrada completa, sin carpeta (ya la indica folderId), y los
+// nombres de sus etiquetas. Bitwarden no la lee; al importar aquí se usa en
+// lugar de los campos de Bitwarden para no perder nada (caducidad, reglas...)
+type extensionBitwarden struct {
+	Entrada   model.VaultEntry `json:"entry"`
+	Etiquetas []string         `json:"tags,omitempty"`
+}
+
+// importarBitwarden lee la exportación JSON (sin cifrar) de Bitwarden. Las
+// carpetas anidadas se indican con "/" en el nombre, igual que aquí
+func importarBitwarden(contenido []byte) ([]entradaImportada, error) {
+	var fichero bitwardenExportacion
+	if err := json.Unmarshal(contenido, &fichero); err != nil {
+		return nil, errors.New("invalid file")
+	}
+	if fichero.Cifrado {
+		return nil, errors.New("encrypted export")
+	}
+	carpetas := make(map[string]string)
+	for _, carpeta := range fichero.Carpetas {
+		carpetas[carpeta.ID] = carpeta.Nombre
+	}
+
+	var result []entradaImportada
+	for _, elemento := range fichero.Elementos {
+		if elemento.Borrado != "" {
+			continue
+		}
+		entrada := importarElementoBitwarden(elemento)
+		entrada.Carpeta = carpetas[elemento.Carpeta]
+		result = append(result, entrada)
+	}
+	return result, nil
+}
+
+// importarElementoBitwarden convierte un elemento de Bitwarden según su tipo
+// (1 cuenta, 2 nota segura, 3 tarjeta, 4 identidad). Los exportados por este
+// gestor se importan tal cual a partir de su extensión
+func importarElementoBitwarden(elemento bitwardenElemento) entradaImportada {
+	if extension := elemento.Extension; extension != nil && extension.Entrada.Type != "" {
+		entry := extension.Entrada
+		entry.Version, entry.Folder, entry.Tags, entry.Reminder = 0, "", nil, nil
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		if entry.Title == "" {
+			entry.Title = strings.TrimSpace(elemento.Nombre)
+		}
+		return entradaImportada{Entry: entry, Etiquetas: extension.Etiquetas, Estado: importarNueva}
+	}
+
+	var result entradaImportada
+	switch {
+	case elemento.Tipo == 1 && elemento.Login != nil:
+		result = nuevaImportada(model.TipoCuenta, elemento.Nombre)
+		result.Entry.Fields["user"] = elemento.Login.Usuario
+		result.Entry.Fields["password"] = elemento.Login.Contrasena
+		for _, uri := range elemento.Login.URIs {
+			result.agregarURL(uri.URI)
+		}
+		result.agregarOTP(elemento.Login.TOTP)
+	case elemento.Tipo == 3 && elemento.Tarjeta != nil:
+		result = nuevaImportada(model.TipoTarjeta, elemento.Nombre)
+		result.Entry.Fields["holder"] = elemento.Tarjeta.Titular
+		result.Entry.Fields["number"] = elemento.Tarjeta.Numero
+		result.Entry.Fields["cvv"] = elemento.Tarjeta.Codigo
+		result.Entry.Fields["expiry"] = caducidadTarjeta(elemento.Tarjeta.Mes, elemento.Tarjeta.Anyo)
+		result.agregarCampo("Marca", elemento.Tarjeta.Marca, false)
+	case elemento.Tipo == 4 && elemento.Identidad != nil:
+		result = nuevaImportada(model.TipoIdentidad, elemento.Nombre)
+		valor := func(clave string) string {
+			texto, _ := elemento.Identidad[clave].(string)
+			return texto
+		}
+		result.Entry.Fields["fullName"] = strings.Join(strings.Fields(valor("firstName")+" "+valor("middleName")+" "+valor("lastName")), " ")
+		result.Entry.Fields["country"] = valor("country")
+		for _, documento := range documentosBitwarden {
+			if numero := valor(documento[0]); numero != "" && result.Entry.Fields["number"] == "" {
+				result.Entry.Fields["number"], result.Entry.Fields["docType"] = numero, documento[1]
+			} else {
+				result.agregarCampo(documento[1], numero, true)
+			}
+		}
+		for _, otro := range [][2]string{{"email", "Email"}, {"phone", "Teléfono"}, {"username", "Usuario"}, {"company", "Empresa"},
+			{"address1", "Dirección"}, {"address2", "Dirección (2)"}, {"address3", "Dirección (3)"}, {"postalCode", "Código postal"},
+			{"city", "Ciudad"}, {"state", "Provincia"}} {
+			result.agregarCampo(otro[1], valor(otro[0]), false)
+		}
+	default:
+		result = nuevaImportada(model.TipoTexto, elemento.Nombre)
+	}
+
+	for _, campo := range elemento.Campos {
+		if campo.Tipo != 3 {
+			result.agregarCampo(campo.Nombre, campo.Valor, campo.Tipo == 1)
+		}
+	}
+	result.agregarNotas(elemento.Notas)
+	return result
+}
+
+// caducidadTarjeta convierte mes y año ("3", "2027") al formato MM/AA
+func caducidadTarjeta(mes string, anyo string) string {
+	if mes == "" && anyo == "" {
+		return ""
+	}
+	if len(mes) == 1 {
+		mes = "0" + mes
+	}
+	if len(anyo) == 4 {
+		anyo = anyo[2:]
+	}
+	return mes + "/" + anyo
+}
+
+// ---------------------------------------------------------------------------
+// 1Password (1PUX: ZIP con export.data en JSON)
+
+type unoPasswordElemento struct {
+	Estado    string `json:"state"`
+	Categoria string `json:"categoryUuid"`
+	Detalles  struct {
+		CamposLogin []struct {
+			Valor       string `json:"value"`
+			Nombre      string `json:"name"`
+			Designacion string `json:"designation"`
+			Tipo        string `json:"fieldType"`
+		} `json:"loginFields"`
+		Notas     string `json:"notesPlain"`
+		Secciones []struct {
+			Titulo string `json:"title"`
+			Campos []struct {
+				Titulo string                     `json:"title"`
+				ID     string                     `json:"id"`
+				Valor  map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+		Contrasena string `json:"password"`
+	} `json:"details"`
+	Resumen struct {
+		Titulo string `json:"title"`
+		URL    string `json:"url"`
+		URLs   []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+		Etiquetas []string `json:"tags"`
+	} `json:"overview"`
+}
+
+// Campos de las secciones de 1Password que corresponden a campos de los tipos
+// de aquí, por categoría (001 cuenta, 002 tarjeta, 004 identidad, 005
+// contraseña, 109 red Wi-Fi, 114 clave SSH)
+var campos1PUX = map[string]map[string]string{
+	"002": {"cardholder": "holder", "ccnum": "number", "cvv": "cvv", "expiry": "expiry", "pin": "pin"},
+	"109": {"network_name": "ssid", "wireless_password": "password", "wireless_security": "security"},
+	"114": {"private_key": "privateKey", "public_key": "publicKey"},
+}
+
+// importar1PUX lee la exportación 1PUX de 1Password. Cada bóveda se importa
+// en una carpeta con su nombre; los elementos archivados o borrados se omiten
+func importar1PUX(contenido []byte) ([]entradaImportada, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(contenido), int64(len(contenido)))
+	if err != nil {
+		return nil, errors.New("invalid file")
+	}
+	var datos []byte
+	for _, fichero := range zipReader.File {
+		if fichero.Name == "export.data" {
+			reader, errOpen := fichero.Open()
+			if errOpen != nil {
+				return nil, errors.New("invalid file")
+			}
+			datos, err = ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				return nil, errors.New("invalid file")
+			}
+		}
+	}
+
+	var exportacion struct {
+		Cuentas []struct {
+			Bovedas []struct {
+				Atributos struct {
+					Nombre string `json:"name"`
+				} `json:"attrs"`
+				Elementos []unoPasswordElemento `json:"items"`
+			} `json:"vaults"`
+		} `json:"accounts"`
+	}
+	if datos == nil || json.Unmarshal(datos, &exportacion) != nil {
+		return nil, errors.New("invalid file")
+	}
+
+	var result []entradaImportada
+	for _, cuenta := range exportacion.Cuentas {
+		for _, boveda := range cuenta.Bovedas {
+			for _, elemento := range boveda.Elementos {
+				if elemento.Estado != "" && elemento.Estado != "active" {
+					continue
+				}
+				entrada := importarElemento1PUX(elemento)
+				entrada.Carpeta = boveda.Atributos.Nombre
+				result = append(result, entrada)
+			}
+		}
+	}
+	return result, nil
+}
+
+// importarElemento1PUX convierte un elemento de 1Password según su categoría
+func importarElemento1PUX(elemento unoPasswordElemento) entradaImportada {
+	var result entradaImportada
+	switch elemento.Categoria {
+	case "001", "005":
+		result = nuevaImportada(model.TipoCuenta, elemento.Resumen.Titulo)
+		for _, campo := range elemento.Detalles.CamposLogin {
+			switch {
+			case campo.Designacion == "username":
+				result.Entry.Fields["user"] = campo.Valor
+			case campo.Designacion == "password":
+				result.Entry.Fields["password"] = campo.Valor
+			default:
+				result.agregarCampo(campo.Nombre, campo.Valor, campo.Tipo == "P")
+			}
+		}
+		if result.Entry.Fields["password"] == "" {
+			result.Entry.Fields["password"] = elemento.Detalles.Contrasena
+		}
+	case "002":
+		result = nuevaImportada(model.TipoTarjeta, elemento.Resumen.Titulo)
+	case "004":
+		result = nuevaImportada(model.TipoIdentidad, elemento.Resumen.Titulo)
+	case "109":
+		result = nuevaImportada(model.TipoWifi, elemento.Resumen.Titulo)
+	case "114":
+		result = nuevaImportada(model.TipoSSH, elemento.Resumen.Titulo)
+	default:
+		result = nuevaImportada(model.TipoTexto, elemento.Resumen.Titulo)
+	}
+
+	result.agregarURL(elemento.Resumen.URL)
+	for _, direccion := range elemento.Resumen.URLs {
+		result.agregarURL(direccion.URL)
+	}
+	if result.Entry.Type != model.TipoCuenta && len(result.Entry.URLs) != 0 {
+		for _, direccion := range result.Entry.URLs {
+			result.agregarCampo("URL", direccion, false)
+		}
+		result.Entry.URLs = nil
+	}
+
+	for _, seccion := range elemento.Detalles.Secciones {
+		for _, campo := range seccion.Campos {
+			valor, oculto, otp := valorCampo1PUX(campo.Valor)
+			if nombre, ok := campos1PUX[elemento.Categoria][campo.ID]; ok && result.Entry.Fields[nombre] == "" {
+				result.Entry.Fields[nombre] = valor
+				continue
+			}
+			if otp {
+				result.agregarOTP(valor)
+				continue
+			}
+			nombre := campo.Titulo
+			if nombre == "" {
+				nombre = seccion.Titulo
+			}
+			result.agregarCampo(nombre, valor, oculto)
+		}
+	}
+	result.agregarNotas(elemento.Detalles.Notas)
+	result.Etiquetas = elemento.Resumen.Etiquetas
+	return result
+}
+
+// valorCampo1PUX devuelve el valor de un campo de 1Password como texto, si
+// está oculto y si es una semilla 2FA. El valor es un objeto con una única
+// clave que indica su tipo ({"concealed": "..."}, {"monthYear": 202512}...)
+func valorCampo1PUX(valor map[string]json.RawMessage) (string, bool, bool) {
+	for tipo, raw := range valor {
+		var texto string
+		if json.Unmarshal(raw, &texto) == nil {
+			return texto, tipo == "concealed" || tipo == "creditCardNumber", tipo == "totp"
+		}
+		var numero int64
+		if json.Unmarshal(raw, &numero) == nil {
+			switch tipo {
+			case "date":
+				return time.Unix(numero, 0).UTC().Format(formatoFecha), false, false
+			case "monthYear":
+				return caducidadTarjeta(strconv.FormatInt(numero%100, 10), strconv.FormatInt(numero/100, 10)), false, false
+			}
+			return strconv.FormatInt(numero, 10), false, false
+		}
+		var objeto map[string]interface{}
+		if json.Unmarshal(raw, &objeto) == nil {
+			switch tipo {
+			case "email":
+				texto, _ := objeto["email_address"].(string)
+				return texto, false, false
+			case "sshKey":
+				texto, _ := objeto["privateKey"].(string)
+				return texto, true, false
+			case "address":
+				var partes []string
+				for _, clave := range []string{"street", "zip", "city", "state", "country"} {
+					if parte, _ := objeto[clave].(string); parte != "" {
+						partes = append(partes, parte)
+					}
+				}
+				return strings.Join(partes, ", "), false, false
+			}
+		}
+	}
+	return "", false, false
+}
+
+// ---------------------------------------------------------------------------
+// CSV genérico
+
+// Campos a los que se pueden asignar columnas del CSV y nombres de columna
+// habituales (Chrome, Firefox, LastPass, KeePassXC...) para cada uno
+var columnasCSV = map[string][]string{
+	"title":    {"title", "name", "título", "titulo", "nombre"},
+	"user":     {"username", "user", "login", "login_username", "usuario", "email"},
+	"password": {"password", "login_password", "pass", "contraseña", "contrasena"},
+	"url":      {"url", "uri", "login_uri", "website", "web", "hostname"},
+	"notes":    {"notes", "note", "extra", "comments", "notas"},
+	"otp":      {"totp", "otp", "login_totp", "otpauth"},
+	"folder":   {"folder", "group", "grouping", "carpeta", "grupo"},
+	"tags":     {"tags", "etiquetas"},
+	"type":     {"type", "tipo"},
+	"fields":   {"fields", "campos"},
+}
+
+// camposCSV son los campos que se pueden indicar en el mapeo de columnas. En
+// "type", "note" indica una nota segura (el resto son cuentas) y "fields" tiene
+// campos personalizados, uno por línea ("nombre: valor"), como en Bitwarden
+var camposCSV = []string{"title", "user", "password", "url", "notes", "otp", "folder", "tags", "type", "fields"}
+
+// columnasIgnoradasCSV son columnas habituales que no se importan
+var columnasIgnoradasCSV = []string{"favorite", "fav", "reprompt"}
+
+// parsearMapeoCSV convierte "title=Nombre,user=Usuario" en campo -> columna
+func parsearMapeoCSV(mapeo string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, par := range strings.Split(mapeo, ",") {
+		if strings.TrimSpace(par) == "" {
+			continue
+		}
+		partes := strings.SplitN(par, "=", 2)
+		campo := strings.ToLower(strings.TrimSpace(partes[0]))
+		if len(partes) != 2 || !contiene(camposCSV, campo) {
+			return nil, errors.New("invalid mapping")
+		}
+		result[campo] = strings.TrimSpace(partes[1])
+	}
+	return result, nil
+}
+
+// importarCSV lee un CSV con cabecera. Cada campo se toma de la columna que
+// indica el mapeo o, si no se indica, de la que tiene un nombre habitual para
+// él. Las columnas que no corresponden a ningún campo se guardan como campos
+// personalizados
+func importarCSV(contenido []byte, mapeo map[string]string) ([]entradaImportada, error) {
+	contenido = bytes.TrimPrefix(contenido, []byte("\xef\xbb\xbf"))
+	reader := csv.NewReader(bytes.NewReader(contenido))
+	reader.FieldsPerRecord = -1
+	filas, err := reader.ReadAll()
+	if err != nil || len(filas) == 0 {
+		return nil, errors.New("invalid file")
+	}
+	cabecera := filas[0]
+
+	// Columna de cada campo
+	columnas := make(map[string]int)
+	for _, campo := range camposCSV {
+		nombres := columnasCSV[campo]
+		if columna, ok := mapeo[campo]; ok {
+			nombres = []string{columna}
+		}
+		for _, nombre := range nombres {
+			for i, columna := range cabecera {
+				if _, usada := columnaUsada(columnas, i); !usada && strings.EqualFold(strings.TrimSpace(columna), nombre) {
+					columnas[campo] = i
+					break
+				}
+			}
+			if _, ok := columnas[campo]; ok {
+				break
+			}
+		}
+		if _, ok := columnas[campo]; !ok && mapeo[campo] != "" {
+			return nil, errors.New("column not found: " + mapeo[campo])
+		}
+	}
+
+	var result []entradaImportada
+	for _, fila := range filas[1:] {
+		valor := func(campo string) string {
+			if i, ok := columnas[campo]; ok && i < len(fila) {
+				return fila[i]
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(fila, "")) == "" {
+			continue
+		}
+
+		entrada := nuevaImportada(model.TipoCuenta, valor("title"))
+		if strings.EqualFold(strings.TrimSpace(valor("type")), "note") {
+			entrada = nuevaImportada(model.TipoTexto, valor("title"))
+		} else {
+			entrada.Entry.Fields["user"] = valor("user")
+			entrada.Entry.Fields["password"] = valor("password")
+		}
+		// Bitwarden separa con comas las direcciones de una entrada
+		for _, direccion := range strings.Split(valor("url"), ",") {
+			entrada.agregarURL(direccion)
+		}
+		if entrada.Entry.Title == "" && len(entrada.Entry.URLs) != 0 {
+			entrada.Entry.Title = hostURL(entrada.Entry.URLs[0])
+		}
+		entrada.agregarOTP(valor("otp"))
+		for i, columna := range cabecera {
+			if _, usada := columnaUsada(columnas, i); !usada && i < len(fila) && !contiene(columnasIgnoradasCSV, strings.ToLower(strings.TrimSpace(columna))) {
+				entrada.agregarCampo(columna, fila[i], false)
+			}
+		}
+		for _, linea := range strings.Split(valor("fields"), "\n") {
+			if partes := strings.SplitN(linea, ": ", 2); len(partes) == 2 {
+				entrada.agregarCampo(partes[0], partes[1], false)
+			} else {
+				entrada.agregarCampo("", linea, false)
+			}
+		}
+		entrada.agregarNotas(valor("notes"))
+		entrada.Carpeta = strings.Replace(valor("folder"), "\\", "/", -1)
+		for _, etiqueta := range strings.FieldsFunc(valor("tags"), func(r rune) bool { return r == ';' || r == ',' }) {
+			entrada.Etiquetas = append(entrada.Etiquetas, strings.TrimSpace(etiqueta))
+		}
+		result = append(result, entrada)
+	}
+	return result, nil
+}
+
+// columnaUsada indica si la columna ya corresponde a algún campo
+func columnaUsada(columnas map[string]int, columna int) (string, bool) {
+	for campo, i := range columnas {
+		if i == columna {
+			return campo, true
+		}
+	}
+	return "", false
+}
+
+// ---------------------------------------------------------------------------
+// Importación
+
+// marcarDuplicadas compara los títulos de las entradas importadas con los de
+// la bóveda (y entre ellas). Las duplicadas se omiten o, si se indica, se
+// renombran añadiendo un número ("Correo (2)")
+func marcarDuplicadas(entradas []entradaImportada, existentes []entradaListado, renombrar bool) {
+	titulos := make(map[string]bool)
+	for _, existente := range existentes {
+		titulos[existente.Titulo] = true
+	}
+	for i := range entradas {
+		titulo := entradas[i].Entry.Title
+		if !titulos[titulo] {
+			titulos[titulo] = true
+			continue
+		}
+		if !renombrar {
+			entradas[i].Estado, entradas[i].Motivo = importarDuplicada, "ya existe una entrada con ese título"
+			continue
+		}
+		n := 2
+		for titulos[titulo+" ("+strconv.Itoa(n)+")"] {
+			n++
+		}
+		nuevo := titulo + " (" + strconv.Itoa(n) + ")"
+		entradas[i].Entry.Title = nuevo
+		entradas[i].Estado, entradas[i].Motivo = importarRenombrada, "ya existía ["+titulo+"]"
+		titulos[nuevo] = true
+	}
+}
+
+// importarEntradas guarda en la bóveda las entradas que no están duplicadas,
+// dentro de la carpeta base indicada. Crea las carpetas y etiquetas que no
+// existen; cada entrada se cifra en el cliente antes de enviarla (nuevaEntrada)
+func importarEntradas(client *http.Client, org *organizacion, entradas []entradaImportada, base string) {
+	for i := range entradas {
+		entrada := &entradas[i]
+		if entrada.Estado != importarNueva && entrada.Estado != importarRenombrada {
+			continue
+		}
+
+		folderID, err := asegurarCarpeta(client, org, strings.Trim(base, "/")+"/"+entrada.Carpeta)
+		if err == nil {
+			entrada.Entry.Folder = folderID
+			entrada.Entry.Tags, err = asegurarEtiquetas(client, org, entrada.Etiquetas)
+		}
+		if err == nil {
+			if entrada.Entry.Renewed == "" {
+				entrada.Entry.Renewed = hoy()
+			}
+			_, err = nuevaEntrada(client, entrada.Entry)
+		}
+		if err != nil {
+			entrada.Estado, entrada.Motivo = importarFallida, err.Error()
+		} else {
+			entrada.Estado = importarImportada
+		}
+	}
+}
+
+// descripcionErrorImportacion explica por qué no se ha podido leer el fichero
+func descripcionErrorImportacion(err error) string {
+	switch {
+	case err.Error() == "unknown format":
+		return "No se reconoce el formato, indícalo con -format (" + strings.Join([]string{formatoCifrado, formatoKeePass, formatoBitwarden, formato1PUX, formatoCSV}, ", ") + ")."
+	case err.Error() == "invalid file":
+		return "El fichero no tiene el formato indicado o está dañado."
+	case err.Error() == "encrypted export":
+		return "La exportación está cifrada, expórtala sin cifrar (JSON)."
+	case err.Error() == "invalid mapping":
+		return "El mapeo de columnas no es correcto, el formato es campo=columna,... con los campos " + strings.Join(camposCSV, ", ") + "."
+	case strings.HasPrefix(err.Error(), "column not found: "):
+		return "El CSV no tiene la columna [" + strings.TrimPrefix(err.Error(), "column not found: ") + "]."
+	}
+	return err.Error()
+}
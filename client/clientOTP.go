@@ -0,0 +1,130 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bertus193/gestorSDS/model"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// campoOTP devuelve el campo del tipo de la entrada que guarda la URI
+// otpauth:// (solo lo tienen las cuentas de usuario)
+func campoOTP(entry model.VaultEntry) (model.CampoEntrada, bool) {
+	if esquema, ok := model.BuscarTipoEntrada(entry.Type); ok {
+		for _, campo := range esquema.Campos {
+			if campo.OTP {
+				return campo, true
+			}
+		}
+	}
+	return model.CampoEntrada{}, false
+}
+
+// otpEntrada devuelve la semilla OTP de la entrada, si tiene
+func otpEntrada(entry model.VaultEntry) (utils.OTP, bool) {
+	campo, ok := campoOTP(entry)
+	if !ok || entry.Fields[campo.Nombre] == "" {
+		return utils.OTP{}, false
+	}
+	otp, err := utils.ParseOTPAuthURI(entry.Fields[campo.Nombre])
+	return otp, err == nil
+}
+
+// generarCodigoOTP calcula el código 2FA actual de la entrada y los segundos
+// de validez que le quedan (0 en HOTP, que no caduca). En HOTP cada código
+// se usa una vez, por lo que se guarda en la entrada el siguiente contador
+// (sin crear una versión nueva en su historial)
+func generarCodigoOTP(client *http.Client, entryID string, entry model.VaultEntry) (string, int, error) {
+	otp, ok := otpEntrada(entry)
+	if !ok {
+		return "", 0, errors.New("no otp")
+	}
+	if otp.Tipo == "totp" {
+		codigo, restante := otp.CodigoTOTP(time.Now())
+		return codigo, restante, nil
+	}
+
+	codigo := otp.CodigoHOTP(otp.Contador)
+	otp.Contador++
+	campo, _ := campoOTP(entry)
+	entry.Fields[campo.Nombre] = otp.URI()
+	var err error
+	if entry.Version < model.VersionEntrada {
+		// Las entradas antiguas se guardan completas para migrarlas
+		err = editarEntrada(client, entryID, entry)
+	} else {
+		err = guardarCampoOTP(client, entryID, campo.Nombre, entry.Fields[campo.Nombre])
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return codigo, 0, nil
+}
+
+// Petición al servidor para guardar solo la URI otpauth:// (cifrada) de una
+// entrada, sin guardar una versión nueva en su historial
+func guardarCampoOTP(client *http.Client, entryID string, campo string, valor string) error {
+
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("id", entryID)
+	data.Set("campo", campo)
+	data.Set("valor", cifrarValor(valor))
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/vault/otp", data)
+
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 400: // (400 - Bad Request)
+				errResult = errors.New("invalid fields")
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("not found")
+			default:
+				errResult = errors.New("unknown")
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return errResult
+}
+
+// formatoCodigoOTP separa el código en dos grupos para leerlo mejor
+func formatoCodigoOTP(codigo string) string {
+	mitad := len(codigo) / 2
+	return codigo[:mitad] + " " + codigo[mitad:]
+}
+
+// validarCampoOTP comprueba que el valor es una URI otpauth:// válida y
+// la devuelve normalizada (vacío si se quita el 2FA)
+func validarCampoOTP(valor string) (string, error) {
+	if strings.TrimSpace(valor) == "" {
+		return "", nil
+	}
+	otp, err := utils.ParseOTPAuthURI(valor)
+	if err != nil {
+		return "", err
+	}
+	return otp.URI(), nil
+}
@@ -0,0 +1,303 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bertus193/gestorSDS/model"
+)
+
+// organizacion contiene las carpetas y etiquetas del usuario ya descifradas
+type organizacion struct {
+	Carpetas  map[string]model.Carpeta
+	Etiquetas map[string]string
+}
+
+// Petición al servidor de las carpetas y etiquetas del usuario
+func leerOrganizacion(client *http.Client) (organizacion, error) {
+	result := organizacion{Carpetas: make(map[string]model.Carpeta), Etiquetas: make(map[string]string)}
+
+	contents, err := peticionOrganizacion(client, "/organizacion", url.Values{}, 200)
+	if err != nil {
+		return result, err
+	}
+
+	cifrada := model.Organizacion{}
+	if errJSON := json.Unmarshal([]byte(contents), &cifrada); errJSON != nil {
+		return result, errors.New("unable to unmarshal")
+	}
+	for id, carpeta := range cifrada.Carpetas {
+		result.Carpetas[id] = model.Carpeta{Nombre: descifrarValor(carpeta.Nombre), Padre: carpeta.Padre}
+	}
+	for id, etiqueta := range cifrada.Etiquetas {
+		result.Etiquetas[id] = descifrarValor(etiqueta.Nombre)
+	}
+	return result, nil
+}
+
+// Petición al servidor para crear una carpeta (dentro de "padre" si se indica)
+func crearCarpeta(client *http.Client, nombre string, padre string) (string, error) {
+	data := url.Values{}
+	data.Set("nombre", cifrarValor(nombre))
+	data.Set("padre", padre)
+	return peticionOrganizacion(client, "/carpetas/nueva", data, 201)
+}
+
+// Petición al servidor para cambiar el nombre de una carpeta o moverla
+func editarCarpeta(client *http.Client, folderID string, nombre string, padre string) error {
+	data := url.Values{}
+	data.Set("id", folderID)
+	data.Set("nombre", cifrarValor(nombre))
+	data.Set("padre", padre)
+	_, err := peticionOrganizacion(client, "/carpetas/editar", data, 200)
+	return err
+}
+
+// Petición al servidor para eliminar una carpeta
+func eliminarCarpeta(client *http.Client, folderID string) error {
+	data := url.Values{}
+	data.Set("id", folderID)
+	_, err := peticionOrganizacion(client, "/carpetas/eliminar", data, 200)
+	return err
+}
+
+// Petición al servidor para crear una etiqueta
+func crearEtiqueta(client *http.Client, nombre string) (string, error) {
+	data := url.Values{}
+	data.Set("nombre", cifrarValor(nombre))
+	return peticionOrganizacion(client, "/etiquetas/nueva", data, 201)
+}
+
+// Petición al servidor para cambiar el nombre de una etiqueta
+func renombrarEtiqueta(client *http.Client, tagID string, nombre string) error {
+	data := url.Values{}
+	data.Set("id", tagID)
+	data.Set("nombre", cifrarValor(nombre))
+	_, err := peticionOrganizacion(client, "/etiquetas/renombrar", data, 200)
+	return err
+}
+
+// Petición al servidor para eliminar una etiqueta
+func eliminarEtiqueta(client *http.Client, tagID string) error {
+	data := url.Values{}
+	data.Set("id", tagID)
+	_, err := peticionOrganizacion(client, "/etiquetas/eliminar", data, 200)
+	return err
+}
+
+// peticionOrganizacion realiza una petición de carpetas o etiquetas
+// y devuelve el cuerpo de la respuesta
+func peticionOrganizacion(client *http.Client, path string, data url.Values, expected int) (string, error) {
+
+	var bodyResult string
+	var errResult error
+
+	data.Set("token", sessionToken)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+path, data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado
+		if response.StatusCode != expected {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("not found")
+			case 409: // (409 - Conflict)
+				errResult = errors.New("invalid parent")
+			default:
+				errResult = errors.New("unknown")
+			}
+		} else {
+			bodyBytes, _ := ioutil.ReadAll(response.Body)
+			bodyResult = string(bodyBytes)
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return bodyResult, errResult
+}
+
+// rutaCarpeta devuelve la ruta completa de una carpeta ("/" es la raíz)
+func (o organizacion) rutaCarpeta(folderID string) string {
+	var partes []string
+	for id := folderID; id != ""; id = o.Carpetas[id].Padre {
+		carpeta, ok := o.Carpetas[id]
+		if !ok {
+			break
+		}
+		partes = append([]string{carpeta.Nombre}, partes...)
+		if len(partes) > len(o.Carpetas) {
+			break
+		}
+	}
+	return "/" + strings.Join(partes, "/")
+}
+
+// buscarCarpeta devuelve el identificador de la carpeta con la ruta indicada
+// ("Trabajo/Servidores"), la cadena vacía o "/" son la raíz
+func (o organizacion) buscarCarpeta(ruta string) (string, bool) {
+	folderID := ""
+	for _, nombre := range strings.Split(strings.Trim(ruta, "/"), "/") {
+		if nombre == "" {
+			continue
+		}
+		found := false
+		for id, carpeta := range o.Carpetas {
+			if carpeta.Padre == folderID && carpeta.Nombre == nombre {
+				folderID, found = id, true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return folderID, true
+}
+
+// subcarpetas devuelve las carpetas contenidas en la indicada, por nombre
+func (o organizacion) subcarpetas(folderID string) []string {
+	var result []string
+	for id, carpeta := range o.Carpetas {
+		if carpeta.Padre == folderID {
+			result = append(result, id)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return o.Carpetas[result[i]].Nombre < o.Carpetas[result[j]].Nombre
+	})
+	return result
+}
+
+// dentroDe comprueba si una carpeta es la indicada o está dentro de ella
+func (o organizacion) dentroDe(folderID string, ancestroID string) bool {
+	for id, n := folderID, 0; n <= len(o.Carpetas); id, n = o.Carpetas[id].Padre, n+1 {
+		if id == ancestroID {
+			return true
+		}
+		if id == "" {
+			break
+		}
+	}
+	return false
+}
+
+// buscarEtiqueta devuelve el identificador de la etiqueta con el nombre indicado
+func (o organizacion) buscarEtiqueta(nombre string) (string, bool) {
+	for id, etiqueta := range o.Etiquetas {
+		if etiqueta == nombre {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// nombresEtiquetas devuelve los nombres de las etiquetas indicadas
+func (o organizacion) nombresEtiquetas(tagIDs []string) []string {
+	var result []string
+	for _, id := range tagIDs {
+		if nombre, ok := o.Etiquetas[id]; ok {
+			result = append(result, nombre)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// asegurarEtiquetas devuelve los identificadores de las etiquetas
+// indicadas por nombre, creando las que todavía no existen
+func asegurarEtiquetas(client *http.Client, org *organizacion, nombres []string) ([]string, error) {
+	var result []string
+	for _, nombre := range nombres {
+		nombre = strings.TrimSpace(nombre)
+		if nombre == "" {
+			continue
+		}
+		tagID, ok := org.buscarEtiqueta(nombre)
+		if !ok {
+			var err error
+			if tagID, err = crearEtiqueta(client, nombre); err != nil {
+				return nil, err
+			}
+			org.Etiquetas[tagID] = nombre
+		}
+		result = append(result, tagID)
+	}
+	return result, nil
+}
+
+// asegurarCarpeta devuelve el identificador de la carpeta con la ruta
+// indicada ("Trabajo/Servidores"), creando las que todavía no existen
+func asegurarCarpeta(client *http.Client, org *organizacion, ruta string) (string, error) {
+	folderID := ""
+	for _, nombre := range strings.Split(strings.Trim(ruta, "/"), "/") {
+		if nombre = strings.TrimSpace(nombre); nombre == "" {
+			continue
+		}
+		found := false
+		for id, carpeta := range org.Carpetas {
+			if carpeta.Padre == folderID && carpeta.Nombre == nombre {
+				folderID, found = id, true
+				break
+			}
+		}
+		if !found {
+			nuevaID, err := crearCarpeta(client, nombre, folderID)
+			if err != nil {
+				return "", err
+			}
+			org.Carpetas[nuevaID] = model.Carpeta{Nombre: nombre, Padre: folderID}
+			folderID = nuevaID
+		}
+	}
+	return folderID, nil
+}
+
+// filtrarEntradas devuelve las entradas de una carpeta (y sus subcarpetas si se
+// indica) que tienen la etiqueta indicada (si no se indica, todas)
+func filtrarEntradas(org organizacion, entradas []entradaListado, folderID string, recursivo bool, tagID string) []entradaListado {
+	var result []entradaListado
+	for _, entrada := range entradas {
+		if recursivo && !org.dentroDe(entrada.Carpeta, folderID) {
+			continue
+		}
+		if !recursivo && entrada.Carpeta != folderID {
+			// Las entradas de carpetas que ya no existen se muestran en la raíz
+			if _, ok := org.Carpetas[entrada.Carpeta]; ok || folderID != "" {
+				continue
+			}
+		}
+		if tagID != "" && !contiene(entrada.Etiquetas, tagID) {
+			continue
+		}
+		result = append(result, entrada)
+	}
+	return result
+}
+
+// contiene comprueba si la lista incluye el valor indicado
+func contiene(lista []string, valor string) bool {
+	for _, v := range lista {
+		if v == valor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/model"
+)
+
+// entradaPapelera es una entrada de la papelera ya descifrada
+type entradaPapelera struct {
+	ID      string
+	Fecha   time.Time
+	Entrada model.VaultEntry
+}
+
+// Purga indica cuándo se eliminará definitivamente la entrada
+func (e entradaPapelera) Purga() time.Time {
+	return e.Fecha.AddDate(0, 0, config.TrashRetentionDays)
+}
+
+// Petición al servidor de las entradas de la papelera, que se descifran
+// localmente. Se devuelven de la eliminada más recientemente a la más antigua
+func leerPapelera(client *http.Client) ([]entradaPapelera, error) {
+
+	var trashResult []entradaPapelera
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/papelera", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			default:
+				errResult = errors.New("unknown")
+			}
+
+		} else {
+			// Leemos la respuesta
+			if contents, errRead := ioutil.ReadAll(response.Body); errRead != nil {
+				errResult = errors.New("unable to read")
+			} else {
+				papelera := make(map[string]model.EntradaEliminada)
+				// Recuperamos el objeto del mensaje original
+				if errJSON := json.Unmarshal(contents, &papelera); errJSON != nil {
+					errResult = errors.New("unable to unmarshal")
+				} else {
+					for entryID, eliminada := range papelera {
+						trashResult = append(trashResult, entradaPapelera{
+							ID:      entryID,
+							Fecha:   eliminada.Fecha,
+							Entrada: descifrarEntrada(entryID, eliminada.Entrada),
+						})
+					}
+					sort.Slice(trashResult, func(i, j int) bool {
+						return trashResult[i].Fecha.After(trashResult[j].Fecha)
+					})
+				}
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return trashResult, errResult
+}
+
+// Petición al servidor para devolver una entrada de la papelera a la bóveda,
+// comprobando antes que no hay otra con el mismo título
+func restaurarDePapelera(client *http.Client, eliminada entradaPapelera) error {
+
+	var errResult error
+
+	if _, errSearch := buscarEntrada(client, eliminada.Entrada.Title); errSearch == nil {
+		return errors.New("entry already exists")
+	} else if errSearch.Error() != "not found" {
+		return errSearch
+	}
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("id", eliminada.ID)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/papelera/restaurar", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("not found")
+			case 409: // (409 - Conflict)
+				errResult = errors.New("entry already exists")
+			default:
+				errResult = errors.New("unknown")
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return errResult
+}
+
+// Petición al servidor para eliminar definitivamente todas las entradas
+// de la papelera. Devuelve cuántas se han eliminado
+func vaciarPapelera(client *http.Client) (int, error) {
+
+	var countResult int
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/papelera/vaciar", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			default:
+				errResult = errors.New("unknown")
+			}
+
+		} else {
+			bodyBytes, _ := ioutil.ReadAll(response.Body)
+			countResult, _ = strconv.Atoi(string(bodyBytes))
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return countResult, errResult
+}
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
 
 	"fmt"
 
@@ -150,10 +152,12 @@ func desbloquearA2F(client *http.Client, a2fcode string) error {
 	return errResult
 }
 
-// Petición al servidor de la lista de títulos de las entradas guardadas
-func listarEntradas(client *http.Client) (model.ListaEntradas, error) {
+// Petición al servidor de la lista de entradas guardadas, que se descifra
+// localmente. Las entradas antiguas (identificadas por su título) se migran
+// al iniciar sesión (migrarEntradasAntiguas)
+func listarEntradas(client *http.Client) ([]entradaListado, error) {
 
-	var entriesResult = model.ListaEntradas{}
+	var entriesResult []entradaListado
 	var errResult error
 
 	data := url.Values{}
@@ -183,7 +187,12 @@ func listarEntradas(client *http.Client) (model.ListaEntradas, error) {
 				if errJSON := json.Unmarshal(contents, &result); errJSON != nil {
 					errResult = errors.New("unable to unmarshal")
 				} else {
-					entriesResult = result
+					for entryID, resumen := range result.Entradas {
+						entriesResult = append(entriesResult, descifrarResumen(entryID, resumen))
+					}
+					sort.Slice(entriesResult, func(i, j int) bool {
+						return entriesResult[i].Titulo < entriesResult[j].Titulo
+					})
 				}
 			}
 		}
@@ -199,21 +208,95 @@ func listarEntradas(client *http.Client) (model.ListaEntradas, error) {
 	return entriesResult, errResult
 }
 
-// Petición al servidor para crear una nueva entrada de tipo texto
-func crearEntradaDeTexto(client *http.Client, tituloEntrada string, textoEntrada string) error {
+// Petición al servidor de todas las entradas con su contenido completo, que
+// se descifran localmente (búsquedas). El resultado es por identificador
+func leerBoveda(client *http.Client) (map[string]model.VaultEntry, error) {
 
 	var errResult error
+	vaultResult := make(map[string]model.VaultEntry)
 
 	data := url.Values{}
 	data.Set("token", sessionToken)
-	data.Set("mode", "0") // Mode 0 - Texto
-	data.Set("tituloEntrada", tituloEntrada)
 
-	encryptText := utils.EncodeBase64(utils.CipherSalsa20([]byte(textoEntrada), keyData, []byte(tituloEntrada)))
-	data.Set("textoEntrada", encryptText)
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/vault/completo", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			default:
+				errResult = errors.New("unknown")
+			}
+
+		} else {
+			// Leemos la respuesta
+			if contents, errRead := ioutil.ReadAll(response.Body); errRead != nil {
+				errResult = errors.New("unable to read")
+			} else {
+				vault := make(map[string]model.VaultEntry)
+				// Recuperamos el objeto del mensaje original
+				if errJSON := json.Unmarshal(contents, &vault); errJSON != nil {
+					errResult = errors.New("unable to unmarshal")
+				} else {
+					for entryID, entry := range vault {
+						vaultResult[entryID] = descifrarEntrada(entryID, entry)
+					}
+				}
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return vaultResult, errResult
+}
+
+// migrarEntradasAntiguas pasa al formato actual las entradas antiguas
+// (identificadas por su título). Se hace al iniciar sesión; las que no se
+// pueden migrar se siguen mostrando como estaban
+func migrarEntradasAntiguas(client *http.Client) {
+	entradas, err := listarEntradas(client)
+	if err != nil {
+		return
+	}
+	for _, entrada := range entradas {
+		if entrada.Version < model.VersionEntrada {
+			migrarEntrada(client, entrada.ID)
+		}
+	}
+}
+
+// migrarEntrada vuelve a guardar una entrada antigua (identificada por su
+// título) con un identificador aleatorio y todo su contenido cifrado. El
+// servidor sustituye la antigua en la misma petición, así que repetirla (o
+// que otro cliente la migre a la vez) no crea copias
+func migrarEntrada(client *http.Client, entryID string) (string, error) {
+	entry, err := detallesEntrada(client, entryID)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := model.BuscarTipoEntrada(entry.Type); !ok {
+		// No sabemos qué campos de un tipo desconocido estaban cifrados
+		return "", errors.New("unknown type")
+	}
+
+	var idResult string
+	var errResult error
+
+	data := datosEntrada(entry)
+	data.Set("id", entryID)
 
 	// Realizamos la petición
-	response, err := client.PostForm(baseURL+"/vault/nueva", data)
+	response, err := client.PostForm(baseURL+"/vault/migrar", data)
 
 	if err == nil {
 		// Si el código de estado recibido no es el esperado (201 - Created)
@@ -224,12 +307,16 @@ func crearEntradaDeTexto(client *http.Client, tituloEntrada string, textoEntrada
 			case 401: // (401 - Unauthorized)
 				errResult = errors.New("unauthorized")
 			case 404: // (404 - Not found)
-				errResult = errors.New("user not found")
+				errResult = errors.New("not found")
 			case 409: // (409 - Conflict)
-				errResult = errors.New("entry already exists")
+				errResult = errors.New("entry not migrated")
 			default:
 				errResult = errors.New("unknown")
 			}
+		} else {
+			// Guardamos el identificador
+			bodyBytes, _ := ioutil.ReadAll(response.Body)
+			idResult = string(bodyBytes)
 		}
 
 	} else {
@@ -240,22 +327,46 @@ func crearEntradaDeTexto(client *http.Client, tituloEntrada string, textoEntrada
 	// Cerramos la conexión
 	defer response.Body.Close()
 
-	return errResult
+	return idResult, errResult
 }
 
-// Petición al servidor para crear una nueva entrada de tipo cuenta de usuario
-func crearEntradaDeCuenta(client *http.Client, tituloEntrada string, usuario string, password string) error {
+// buscarEntrada devuelve el identificador de la entrada con el título indicado
+func buscarEntrada(client *http.Client, tituloEntrada string) (string, error) {
+	entradas, err := listarEntradas(client)
+	if err != nil {
+		return "", err
+	}
+	for _, entrada := range entradas {
+		if entrada.Titulo == tituloEntrada {
+			return entrada.ID, nil
+		}
+	}
+	return "", errors.New("not found")
+}
 
-	var errResult error
+// Petición al servidor para crear una nueva entrada, comprobando antes que no
+// existe otra con el mismo título (el servidor no puede saberlo, está cifrado).
+// La fecha de creación cuenta como la primera renovación de la contraseña
+func crearEntradaConTipo(client *http.Client, entry model.VaultEntry) (string, error) {
+	if _, err := buscarEntrada(client, entry.Title); err == nil {
+		return "", errors.New("entry already exists")
+	} else if err.Error() != "not found" {
+		return "", err
+	}
+	if entry.Renewed == "" {
+		entry.Renewed = hoy()
+	}
+	return nuevaEntrada(client, entry)
+}
 
-	data := url.Values{}
-	data.Set("token", sessionToken)
-	data.Set("mode", "1") // Mode 1 - Cuenta de usuario
-	data.Set("tituloEntrada", tituloEntrada)
-	data.Set("usuarioCuenta", usuario)
+// Petición al servidor para guardar una nueva entrada cifrada,
+// devuelve el identificador que le asigna el servidor
+func nuevaEntrada(client *http.Client, entry model.VaultEntry) (string, error) {
 
-	encryptPassServicio := utils.EncodeBase64(utils.CipherSalsa20([]byte(password), keyData, []byte(tituloEntrada)))
-	data.Set("passwordCuenta", encryptPassServicio)
+	var idResult string
+	var errResult error
+
+	data := datosEntrada(entry)
 
 	// Realizamos la petición
 	response, err := client.PostForm(baseURL+"/vault/nueva", data)
@@ -270,8 +381,47 @@ func crearEntradaDeCuenta(client *http.Client, tituloEntrada string, usuario str
 				errResult = errors.New("unauthorized")
 			case 404: // (404 - Not found)
 				errResult = errors.New("user not found")
-			case 409: // (409 - Conflict)
-				errResult = errors.New("entry already exists")
+			default:
+				errResult = errors.New("unknown")
+			}
+		} else {
+			// Guardamos el identificador
+			bodyBytes, _ := ioutil.ReadAll(response.Body)
+			idResult = string(bodyBytes)
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return idResult, errResult
+}
+
+// Petición al servidor para sustituir el contenido de una entrada existente
+func editarEntrada(client *http.Client, entryID string, entry model.VaultEntry) error {
+
+	var errResult error
+
+	data := datosEntrada(entry)
+	data.Set("id", entryID)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/vault/editar", data)
+
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("not found")
 			default:
 				errResult = errors.New("unknown")
 			}
@@ -288,15 +438,51 @@ func crearEntradaDeCuenta(client *http.Client, tituloEntrada string, usuario str
 	return errResult
 }
 
+// datosEntrada prepara el formulario con la entrada cifrada
+func datosEntrada(entry model.VaultEntry) url.Values {
+	cifrada := cifrarEntrada(entry)
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("version", strconv.Itoa(cifrada.Version))
+	data.Set("titulo", cifrada.Title)
+	data.Set("tipo", cifrada.Type)
+	data.Set("carpeta", cifrada.Folder)
+	if len(cifrada.Tags) != 0 {
+		tagsJSON, _ := json.Marshal(cifrada.Tags)
+		data.Set("etiquetas", string(tagsJSON))
+	}
+
+	camposJSON, _ := json.Marshal(cifrada.Fields)
+	data.Set("campos", string(camposJSON))
+	if len(cifrada.CustomFields) != 0 {
+		customJSON, _ := json.Marshal(cifrada.CustomFields)
+		data.Set("camposPersonalizados", string(customJSON))
+	}
+	if len(cifrada.URLs) != 0 {
+		urlsJSON, _ := json.Marshal(cifrada.URLs)
+		data.Set("urls", string(urlsJSON))
+	}
+	data.Set("caducidad", cifrada.Expires)
+	data.Set("rotacion", cifrada.RotationDays)
+	data.Set("renovada", cifrada.Renewed)
+	data.Set("reglas", cifrada.Rules)
+	if cifrada.Reminder != nil {
+		reminderJSON, _ := json.Marshal(cifrada.Reminder)
+		data.Set("recordatorio", string(reminderJSON))
+	}
+	return data
+}
+
 // Petición al servidor para recibir la información detallada de una entrada concreta
-func detallesEntrada(client *http.Client, tituloEntrada string) (model.VaultEntry, error) {
+func detallesEntrada(client *http.Client, entryID string) (model.VaultEntry, error) {
 
 	var errResult error
 	detailResult := model.VaultEntry{}
 
 	data := url.Values{}
 	data.Set("token", sessionToken)
-	data.Set("tituloEntrada", tituloEntrada)
+	data.Set("id", entryID)
 
 	// Realizamos la petición
 	response, err := client.PostForm(baseURL+"/vault/detalles", data)
@@ -328,24 +514,8 @@ func detallesEntrada(client *http.Client, tituloEntrada string) (model.VaultEntr
 					errResult = errors.New("unable to unmarshal")
 				} else {
 
-					// Comprobamos el tipo de entrada (texto, cuenta) y la descriframos
-					if tempEntry.Mode == 0 {
-						// Si es una entrada de tipo texto
-						// Desciframos el texto
-						detailResult = model.VaultEntry{
-							Mode: 0, // Text
-							Text: string(utils.CipherSalsa20(utils.DecodeBase64(tempEntry.Text), keyData, []byte(tituloEntrada))),
-						}
-
-					} else if tempEntry.Mode == 1 {
-						// Si es una entrada de tipo cuenta de usuario
-						// Desciframos la contraseña
-						detailResult = model.VaultEntry{
-							Mode:     1, // Account
-							User:     tempEntry.User,
-							Password: string(utils.CipherSalsa20(utils.DecodeBase64(tempEntry.Password), keyData, []byte(tituloEntrada))),
-						}
-					}
+					// Desciframos todo el contenido de la entrada
+					detailResult = descifrarEntrada(entryID, tempEntry)
 				}
 			}
 		}
@@ -362,13 +532,13 @@ func detallesEntrada(client *http.Client, tituloEntrada string) (model.VaultEntr
 }
 
 // Petición al servidor para eliminar una entrada concreta
-func eliminarEntrada(client *http.Client, tituloEntrada string) error {
+func eliminarEntrada(client *http.Client, entryID string) error {
 
 	var errResult error
 
 	data := url.Values{}
 	data.Set("token", sessionToken)
-	data.Set("tituloEntrada", tituloEntrada)
+	data.Set("id", entryID)
 
 	// Realizamos la petición
 	response, err := client.PostForm(baseURL+"/vault/eliminar", data)
@@ -534,3 +704,98 @@ func eliminarUsuario(client *http.Client) error {
 
 	return errResult
 }
+
+// Petición al servidor para recibir una página del historial de actividad del usuario
+func actividadUsuario(client *http.Client, pagina int) (model.PaginaActividad, error) {
+
+	var errResult error
+	pageResult := model.PaginaActividad{}
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("pagina", strconv.Itoa(pagina))
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/usuario/actividad", data)
+
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("user not found")
+			default:
+				errResult = errors.New("unknown")
+			}
+		} else {
+
+			// Leemos la respuesta
+			if contents, errRead := ioutil.ReadAll(response.Body); errRead != nil {
+				errResult = errors.New("unable to read")
+			} else {
+
+				tempResult := model.PaginaActividad{}
+
+				// Recuperamos el objeto del mensaje origianl
+				if errJSON := json.Unmarshal(contents, &tempResult); errJSON != nil {
+					errResult = errors.New("unable to unmarshal")
+				} else {
+					pageResult = tempResult
+				}
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return pageResult, errResult
+}
+
+// Petición al servidor para cambiar el idioma de las notificaciones del usuario
+func updateIdioma(client *http.Client, idioma string) error {
+
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("idioma", idioma)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/usuario/idioma", data)
+
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("user not found")
+			case 400: // (400 - Bad Request)
+				errResult = errors.New("unsupported language")
+			default:
+				errResult = errors.New("unknown")
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return errResult
+}
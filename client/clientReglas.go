@@ -0,0 +1,138 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/model"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// Reglas por dominio del fichero compartido (se lee la primera vez que se usa)
+var reglasDominios map[string]utils.PasswordRules
+var errReglasDominios error
+
+// leerReglasDominios lee el fichero de reglas por dominio. Si no existe, no
+// hay reglas por dominio
+func leerReglasDominios() (map[string]utils.PasswordRules, error) {
+	if reglasDominios != nil || errReglasDominios != nil {
+		return reglasDominios, errReglasDominios
+	}
+
+	reglasDominios = make(map[string]utils.PasswordRules)
+	contenido, err := ioutil.ReadFile(config.PasswordRulesFile)
+	if os.IsNotExist(err) {
+		return reglasDominios, nil
+	}
+	var leidas map[string]utils.PasswordRules
+	if err == nil {
+		err = json.Unmarshal(contenido, &leidas)
+	}
+	for dominio, reglas := range leidas {
+		if err == nil {
+			err = reglas.Validate()
+		}
+		reglasDominios[strings.ToLower(dominio)] = reglas
+	}
+	if err != nil {
+		reglasDominios, errReglasDominios = nil, err
+	}
+	return reglasDominios, errReglasDominios
+}
+
+// reglasPropias devuelve las reglas guardadas en la entrada
+func reglasPropias(entry model.VaultEntry) utils.PasswordRules {
+	var reglas utils.PasswordRules
+	if entry.Rules != "" {
+		json.Unmarshal([]byte(entry.Rules), &reglas)
+	}
+	return reglas
+}
+
+// setReglas guarda las reglas en la entrada (vacías, las quita)
+func setReglas(entry *model.VaultEntry, reglas utils.PasswordRules) error {
+	if err := reglas.Validate(); err != nil {
+		return err
+	}
+	entry.Rules = ""
+	if !reglas.Empty() {
+		reglasJSON, _ := json.Marshal(reglas)
+		entry.Rules = string(reglasJSON)
+	}
+	return nil
+}
+
+// reglasEntrada devuelve las reglas que hay que aplicar a las contraseñas de
+// la entrada: las suyas propias o, si no tiene, las del dominio más concreto
+// de sus URLs en el fichero compartido. También devuelve de dónde salen
+// ("" si no hay reglas, "entrada" o el dominio)
+func reglasEntrada(entry model.VaultEntry) (utils.PasswordRules, string, error) {
+	if reglas := reglasPropias(entry); !reglas.Empty() {
+		return reglas, "entrada", nil
+	}
+
+	dominios, err := leerReglasDominios()
+	if err != nil {
+		return utils.PasswordRules{}, "", err
+	}
+	var result utils.PasswordRules
+	origen := ""
+	for _, direccion := range entry.URLs {
+		host := hostURL(direccion)
+		for dominio, reglas := range dominios {
+			coincide := host == dominio || strings.HasSuffix(host, "."+dominio)
+			if coincide && len(dominio) > len(origen) {
+				result, origen = reglas, dominio
+			}
+		}
+	}
+	return result, origen, nil
+}
+
+// hostURL devuelve el nombre del servidor de una URL (admite direcciones sin
+// esquema, como "www.ejemplo.com/login")
+func hostURL(direccion string) string {
+	if !strings.Contains(direccion, "://") {
+		direccion = "http://" + direccion
+	}
+	if u, err := url.Parse(direccion); err == nil {
+		return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	}
+	return ""
+}
+
+// descripcionReglasEntrada describe las reglas propias de la entrada ("" si no tiene)
+func descripcionReglasEntrada(entry model.VaultEntry) string {
+	if reglas := reglasPropias(entry); !reglas.Empty() {
+		return reglas.String()
+	}
+	return ""
+}
+
+// descripcionOrigenReglas indica de dónde salen las reglas de una entrada
+func descripcionOrigenReglas(origen string) string {
+	switch origen {
+	case "":
+		return "sin reglas"
+	case "entrada":
+		return "propias de la entrada"
+	}
+	return "del dominio " + origen
+}
+
+// descripcionErrorReglas explica por qué no son válidas unas reglas
+func descripcionErrorReglas(err error) string {
+	switch err.Error() {
+	case "invalid class":
+		return "Las clases de caracteres válidas son " + strings.Join(utils.ClasesCaracteres, ", ") + "."
+	case "required class not allowed":
+		return "Alguna clase obligatoria no está entre las permitidas."
+	case "invalid length":
+		return "La longitud máxima no es válida."
+	}
+	return err.Error()
+}
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bertus193/gestorSDS/model"
+)
+
+// revisionEntrada es una versión anterior de una entrada ya descifrada
+type revisionEntrada struct {
+	Fecha   time.Time
+	Entrada model.VaultEntry
+}
+
+// cambioEntrada es un campo que cambia entre dos versiones de una entrada
+type cambioEntrada struct {
+	Campo   string
+	Antes   string
+	Despues string
+	Secreto bool // Contraseñas, campos ocultos, etc
+}
+
+// Petición al servidor de las versiones anteriores de una entrada (de la más
+// reciente a la más antigua), que se descifran localmente
+func leerRevisiones(client *http.Client, entryID string) ([]revisionEntrada, error) {
+
+	var revisionsResult []revisionEntrada
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("id", entryID)
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/vault/revisiones", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("not found")
+			default:
+				errResult = errors.New("unknown")
+			}
+
+		} else {
+			// Leemos la respuesta
+			if contents, errRead := ioutil.ReadAll(response.Body); errRead != nil {
+				errResult = errors.New("unable to read")
+			} else {
+				var revisiones []model.Revision
+				// Recuperamos el objeto del mensaje original
+				if errJSON := json.Unmarshal(contents, &revisiones); errJSON != nil {
+					errResult = errors.New("unable to unmarshal")
+				} else {
+					for _, revision := range revisiones {
+						revisionsResult = append(revisionsResult, revisionEntrada{
+							Fecha:   revision.Fecha,
+							Entrada: descifrarEntrada(entryID, revision.Entrada),
+						})
+					}
+				}
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return revisionsResult, errResult
+}
+
+// Petición al servidor para restaurar una versión anterior de una entrada
+// (0 es la más reciente, en el orden de leerRevisiones)
+func restaurarRevision(client *http.Client, entryID string, revision int) error {
+
+	var errResult error
+
+	data := url.Values{}
+	data.Set("token", sessionToken)
+	data.Set("id", entryID)
+	data.Set("revision", strconv.Itoa(revision))
+
+	// Realizamos la petición
+	response, err := client.PostForm(baseURL+"/vault/restaurar", data)
+	if err == nil {
+		// Si el código de estado recibido no es el esperado (200 - OK)
+		if response.StatusCode != 200 {
+
+			// Comprobamos el código de estado recibido
+			switch response.StatusCode {
+			case 401: // (401 - Unauthorized)
+				errResult = errors.New("unauthorized")
+			case 404: // (404 - Not found)
+				errResult = errors.New("not found")
+			default:
+				errResult = errors.New("unknown")
+			}
+		}
+
+	} else {
+		// La petición al servidor no ha obtenido respuesta
+		fmt.Println("* No se ha podido comunicar con el servidor")
+		os.Exit(0)
+	}
+	// Cerramos la conexión
+	defer response.Body.Close()
+
+	return errResult
+}
+
+// diferenciasEntradas compara dos versiones (descifradas) de una entrada y
+// devuelve los campos que cambian, en el orden en el que se muestran
+func diferenciasEntradas(org organizacion, antes model.VaultEntry, despues model.VaultEntry) []cambioEntrada {
+	var cambios []cambioEntrada
+	comparar := func(campo string, valorAntes string, valorDespues string, secreto bool) {
+		if valorAntes != valorDespues {
+			cambios = append(cambios, cambioEntrada{campo, valorAntes, valorDespues, secreto})
+		}
+	}
+
+	comparar("Título", antes.Title, despues.Title, false)
+	comparar("Tipo", nombreTipo(antes.Type), nombreTipo(despues.Type), false)
+
+	// Campos del tipo, con su etiqueta si el tipo es conocido
+	nombres := make(map[string]bool)
+	for nombre := range antes.Fields {
+		nombres[nombre] = true
+	}
+	for nombre := range despues.Fields {
+		nombres[nombre] = true
+	}
+	if esquema, ok := model.BuscarTipoEntrada(despues.Type); ok {
+		for _, campo := range esquema.Campos {
+			comparar(campo.Etiqueta, antes.Fields[campo.Nombre], despues.Fields[campo.Nombre], campo.Cifrado)
+			delete(nombres, campo.Nombre)
+		}
+	}
+	for _, nombre := range mapKeysBool(nombres) {
+		comparar(nombre, antes.Fields[nombre], despues.Fields[nombre], true)
+	}
+
+	// Campos personalizados, por nombre
+	personalizados := make(map[string][2]model.CampoPersonalizado)
+	for _, campo := range antes.CustomFields {
+		par := personalizados[campo.Nombre]
+		par[0] = campo
+		personalizados[campo.Nombre] = par
+	}
+	for _, campo := range despues.CustomFields {
+		par := personalizados[campo.Nombre]
+		par[1] = campo
+		personalizados[campo.Nombre] = par
+	}
+	nombresPersonalizados := make([]string, 0, len(personalizados))
+	for nombre := range personalizados {
+		nombresPersonalizados = append(nombresPersonalizados, nombre)
+	}
+	sort.Strings(nombresPersonalizados)
+	for _, nombre := range nombresPersonalizados {
+		par := personalizados[nombre]
+		comparar(nombre, par[0].Valor, par[1].Valor, par[0].Oculto || par[1].Oculto)
+	}
+
+	comparar("URLs", strings.Join(antes.URLs, " "), strings.Join(despues.URLs, " "), false)
+	comparar("Carpeta", org.rutaCarpeta(antes.Folder), org.rutaCarpeta(despues.Folder), false)
+	comparar("Etiquetas", strings.Join(org.nombresEtiquetas(antes.Tags), " "), strings.Join(org.nombresEtiquetas(despues.Tags), " "), false)
+	comparar("Caducidad", antes.Expires, despues.Expires, false)
+	comparar("Renovar cada (días)", antes.RotationDays, despues.RotationDays, false)
+	comparar("Última renovación", antes.Renewed, despues.Renewed, false)
+	comparar("Aviso por correo", nombreRecordatorio(antes.Reminder), nombreRecordatorio(despues.Reminder), false)
+	comparar("Reglas de la contraseña", descripcionReglasEntrada(antes), descripcionReglasEntrada(despues), false)
+
+	return cambios
+}
+
+// nombreRecordatorio devuelve el nombre del aviso de caducidad compartido
+func nombreRecordatorio(recordatorio *model.Recordatorio) string {
+	if recordatorio == nil {
+		return ""
+	}
+	return recordatorio.Nombre
+}
+
+// nombresCambios devuelve los nombres de los campos que cambian
+func nombresCambios(cambios []cambioEntrada) string {
+	if len(cambios) == 0 {
+		return "sin cambios"
+	}
+	var nombres []string
+	for _, cambio := range cambios {
+		nombres = append(nombres, cambio.Campo)
+	}
+	return strings.Join(nombres, ", ")
+}
+
+// texto describe el cambio; los valores secretos solo se muestran si se pide
+func (c cambioEntrada) texto(revelar bool) string {
+	if c.Secreto && !revelar {
+		return c.Campo + ": (modificado)"
+	}
+	antes, despues := c.Antes, c.Despues
+	if antes == "" {
+		antes = "(vacío)"
+	}
+	if despues == "" {
+		despues = "(vacío)"
+	}
+	return c.Campo + ": " + antes + " -> " + despues
+}
+
+// mapKeysBool devuelve las claves del mapa ordenadas
+func mapKeysBool(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
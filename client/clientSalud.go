@@ -0,0 +1,188 @@
+package client
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/model"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// Tipos de problema del informe de salud, en el orden en el que se muestran
+const (
+	problemaFiltrada    = "filtrada"
+	problemaReglas      = "reglas"
+	problemaDebil       = "debil"
+	problemaReutilizada = "reutilizada"
+	problemaAntigua     = "antigua"
+)
+
+// contrasenaEntrada es una contraseña de una entrada: un campo del tipo
+// marcado como contraseña o un campo personalizado de tipo "password"
+type contrasenaEntrada struct {
+	Campo         string // Nombre del campo (o del campo personalizado)
+	Etiqueta      string
+	Valor         string
+	Personalizado bool
+}
+
+// problemaSalud es cada problema que encuentra el informe de salud
+type problemaSalud struct {
+	Tipo     string
+	ID       string // Identificador de la entrada
+	Titulo   string
+	Campo    contrasenaEntrada
+	Detalle  string
+	Gravedad int // Para ordenar dentro de cada tipo (mayor, más grave)
+}
+
+// contrasenasEntrada devuelve las contraseñas (no vacías) de una entrada
+func contrasenasEntrada(entry model.VaultEntry) []contrasenaEntrada {
+	var result []contrasenaEntrada
+	if esquema, ok := model.BuscarTipoEntrada(entry.Type); ok {
+		for _, campo := range esquema.Campos {
+			if valor := entry.Fields[campo.Nombre]; campo.Contrasena && valor != "" {
+				result = append(result, contrasenaEntrada{Campo: campo.Nombre, Etiqueta: campo.Etiqueta, Valor: valor})
+			}
+		}
+	}
+	for _, campo := range entry.CustomFields {
+		if campo.Tipo == "password" && campo.Valor != "" {
+			result = append(result, contrasenaEntrada{Campo: campo.Nombre, Etiqueta: campo.Nombre, Valor: campo.Valor, Personalizado: true})
+		}
+	}
+	return result
+}
+
+// setContrasena cambia el valor de una de las contraseñas de la entrada
+func setContrasena(entry *model.VaultEntry, campo contrasenaEntrada, valor string) {
+	if !campo.Personalizado {
+		entry.Fields[campo.Campo] = valor
+		return
+	}
+	for i := range entry.CustomFields {
+		if entry.CustomFields[i].Nombre == campo.Campo {
+			entry.CustomFields[i].Valor = valor
+		}
+	}
+}
+
+// informeSalud revisa las contraseñas de todas las entradas (ya descifradas,
+// no sale nada del cliente) y devuelve los problemas encontrados: contraseñas
+// que aparecen en filtraciones conocidas (según la función indicada), que no
+// cumplen las reglas de la entrada o de su dominio, cortas o fáciles de adivinar, repetidas en varias entradas o sin cambiar desde hace
+// más de config.HealthMaxPasswordAgeDays días. Si no se han podido comprobar
+// las filtraciones, se devuelve el error junto con el resto de problemas
+func informeSalud(vault map[string]model.VaultEntry, filtrada func(string) (int, error)) ([]problemaSalud, error) {
+	var problemas []problemaSalud
+	var errFiltradas error
+
+	// Entradas que usan cada contraseña
+	usos := make(map[string][]string)
+	for entryID, entry := range vault {
+		for _, contrasena := range contrasenasEntrada(entry) {
+			usos[contrasena.Valor] = append(usos[contrasena.Valor], entryID)
+		}
+	}
+
+	for entryID, entry := range vault {
+		reglas, origen, _ := reglasEntrada(entry)
+		for _, contrasena := range contrasenasEntrada(entry) {
+			nuevo := func(tipo string, detalle string, gravedad int) {
+				problemas = append(problemas, problemaSalud{tipo, entryID, entry.Title, contrasena, detalle, gravedad})
+			}
+
+			// Filtrada: aparece en filtraciones conocidas
+			if errFiltradas == nil {
+				if veces, err := filtrada(contrasena.Valor); err != nil {
+					errFiltradas = err
+				} else if veces > 0 {
+					nuevo(problemaFiltrada, "aparece "+strconv.Itoa(veces)+" veces en filtraciones conocidas", veces)
+				}
+			}
+
+			// No cumple las reglas de la entrada (o de su dominio)
+			if incumplidas := reglas.Check(contrasena.Valor); len(incumplidas) != 0 {
+				nuevo(problemaReglas, strings.Join(incumplidas, ", ")+" (reglas "+descripcionOrigenReglas(origen)+")", len(incumplidas))
+			}
+
+			// Débil: corta o fácil de adivinar
+			fortaleza := utils.EstimatePasswordStrength(contrasena.Valor)
+			if longitud := len([]rune(contrasena.Valor)); longitud < config.HealthMinPasswordLength || fortaleza.Puntuacion < 3 {
+				detalle := descripcionFortaleza(fortaleza)
+				if longitud < config.HealthMinPasswordLength {
+					detalle = strconv.Itoa(longitud) + " caracteres, " + detalle
+				}
+				nuevo(problemaDebil, detalle, 4-fortaleza.Puntuacion)
+			}
+
+			// Reutilizada en otras entradas (o en otro campo de la misma)
+			if otras := usos[contrasena.Valor]; len(otras) > 1 {
+				var titulos []string
+				for _, otraID := range otras {
+					if otraID != entryID {
+						titulos = append(titulos, vault[otraID].Title)
+					}
+				}
+				detalle := "repetida en otro campo de la entrada"
+				if len(titulos) != 0 {
+					sort.Strings(titulos)
+					detalle = "también en " + strings.Join(titulos, ", ")
+				}
+				nuevo(problemaReutilizada, detalle, len(otras))
+			}
+
+			// Antigua: sin renovar desde hace demasiado
+			if renovada, err := time.ParseInLocation(formatoFecha, entry.Renewed, time.Local); err == nil {
+				if dias := -diasHasta(renovada); dias > config.HealthMaxPasswordAgeDays {
+					nuevo(problemaAntigua, "sin cambiar desde "+entry.Renewed+" ("+strconv.Itoa(dias)+" días)", dias)
+				}
+			}
+		}
+	}
+
+	orden := map[string]int{problemaFiltrada: 0, problemaReglas: 1, problemaDebil: 2, problemaReutilizada: 3, problemaAntigua: 4}
+	sort.Slice(problemas, func(i, j int) bool {
+		a, b := problemas[i], problemas[j]
+		if a.Tipo != b.Tipo {
+			return orden[a.Tipo] < orden[b.Tipo]
+		}
+		if a.Gravedad != b.Gravedad {
+			return a.Gravedad > b.Gravedad
+		}
+		return a.Titulo+"/"+a.Campo.Etiqueta < b.Titulo+"/"+b.Campo.Etiqueta
+	})
+	return problemas, errFiltradas
+}
+
+// Nombre de cada puntuación de fortaleza (de 0 a 4)
+var nombresFortaleza = []string{"muy débil", "débil", "mejorable", "fuerte", "muy fuerte"}
+
+// descripcionFortaleza resume la estimación de fortaleza de una contraseña
+func descripcionFortaleza(fortaleza utils.PasswordStrength) string {
+	result := nombresFortaleza[fortaleza.Puntuacion] + " (~" + strconv.Itoa(int(fortaleza.Entropia)) + " bits)"
+	if len(fortaleza.Avisos) != 0 {
+		result += ": " + strings.Join(fortaleza.Avisos, ", ")
+	}
+	return result
+}
+
+// nombreProblema es el título de cada tipo de problema
+func nombreProblema(tipo string) string {
+	switch tipo {
+	case problemaFiltrada:
+		return "Contraseñas filtradas"
+	case problemaReglas:
+		return "Contraseñas que no cumplen sus reglas"
+	case problemaDebil:
+		return "Contraseñas débiles"
+	case problemaReutilizada:
+		return "Contraseñas reutilizadas"
+	case problemaAntigua:
+		return "Contraseñas antiguas"
+	}
+	return tipo
+}
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bertus193/gestorSDS/config"
 	"github.com/bertus193/gestorSDS/model"
@@ -14,6 +18,10 @@ import (
 
 var httpClient *http.Client
 
+// Carpeta que se está viendo y etiqueta por la que se filtra en la pantalla principal
+var carpetaActual string
+var etiquetaActual string
+
 func startUI(c *http.Client) {
 	httpClient = c
 	uiInicio("", "")
@@ -26,6 +34,9 @@ func uiInicio(showError string, showSuccess string) {
 	// Limpiamos la pantalla
 	utils.ClearScreen()
 
+	// Al cerrar sesión volvemos a la raíz
+	carpetaActual, etiquetaActual = "", ""
+
 	// Título de la pantalla
 	fmt.Printf("# Bienvenido a %s\n\n", config.AppName)
 
@@ -133,6 +144,7 @@ func uiLoginUser(showError string) {
 
 	} else {
 		// Login completado, vamos a la pantalla principal del usuario
+		migrarEntradasAntiguas(httpClient)
 		uiUserMainMenu("", "")
 	}
 }
@@ -174,11 +186,13 @@ func uiUnlockA2F(showError string) {
 		}
 	} else {
 		//Desbloqueado con exito
+		migrarEntradasAntiguas(httpClient)
 		uiUserMainMenu("", "")
 	}
 }
 
-// Pantalla principal del usuario, listado de entradas
+// Pantalla principal del usuario, listado de entradas de la carpeta
+// actual (o de todas las que tienen la etiqueta elegida)
 func uiUserMainMenu(showError string, showSuccess string) {
 
 	// Limpiamos la pantalla
@@ -195,7 +209,11 @@ func uiUserMainMenu(showError string, showSuccess string) {
 	// Recuperamos las cuentas del usuario
 	fmt.Printf("\n------ Listado de entradas ------\n\n")
 	// Petición al servidor
+	org, errOrg := leerOrganizacion(httpClient)
 	entradas, err := listarEntradas(httpClient)
+	if err == nil {
+		err = errOrg
+	}
 	if err != nil {
 		// Si hay un error, mostramos el mensaje de error adecuado
 		switch err.Error() {
@@ -205,41 +223,87 @@ func uiUserMainMenu(showError string, showSuccess string) {
 			fmt.Println("Ocurrio un error al recuperar las entradas." + err.Error())
 		}
 	} else {
-		// Mostramos la lista de cuentas de usuario guardadas
-
 		boldBlue := color.New(color.FgHiBlue, color.Bold)
-		if (entradas.Accounts != nil && len(entradas.Accounts) != 0) ||
-			(entradas.Texts != nil && len(entradas.Texts) != 0) {
-
-			// Mostramos la lista de cuentas de usuario guardadas
-			if entradas.Accounts != nil && len(entradas.Accounts) != 0 {
-				boldBlue.Printf(" Cuentas de usuario\n")
-				// Imprimimos los resultados
-				for c := range entradas.Accounts {
-					fmt.Printf("    [%s]\n", entradas.Accounts[c])
-				}
+
+		// Si la carpeta o la etiqueta elegidas ya no existen, volvemos a la raíz
+		if _, ok := org.Carpetas[carpetaActual]; !ok {
+			carpetaActual = ""
+		}
+		if _, ok := org.Etiquetas[etiquetaActual]; !ok {
+			etiquetaActual = ""
+		}
+
+		// Entradas caducadas o a punto de caducar (de todas las carpetas)
+		imprimirCaducadas(entradas)
+
+		// Mostramos dónde estamos y las subcarpetas
+		if etiquetaActual != "" {
+			boldBlue.Printf(" Etiqueta: #%s\n\n", org.Etiquetas[etiquetaActual])
+			entradas = filtrarEntradas(org, entradas, "", true, etiquetaActual)
+		} else {
+			boldBlue.Printf(" Carpeta: %s\n\n", org.rutaCarpeta(carpetaActual))
+			for _, folderID := range org.subcarpetas(carpetaActual) {
+				fmt.Printf("    [+] %s\n", org.Carpetas[folderID].Nombre)
+			}
+			if len(org.subcarpetas(carpetaActual)) != 0 {
 				fmt.Printf("\n")
 			}
+			entradas = filtrarEntradas(org, entradas, carpetaActual, false, "")
+		}
+
+		if len(entradas) != 0 {
+
+			// Agrupamos los títulos (ya ordenados) por tipo
+			tipos := make(map[string][]string)
+			for _, entrada := range entradas {
+				titulo := entrada.Titulo
+				if etiquetas := org.nombresEtiquetas(entrada.Etiquetas); len(etiquetas) != 0 {
+					titulo += " #" + strings.Join(etiquetas, " #")
+				}
+				tipos[entrada.Tipo] = append(tipos[entrada.Tipo], titulo)
+			}
+
+			// Mostramos las entradas de cada tipo en el orden de los esquemas
+			for _, tipo := range model.TiposEntrada {
+				if titulos := tipos[tipo.ID]; len(titulos) != 0 {
+					boldBlue.Printf(" %s\n", tipo.Nombre)
+					// Imprimimos los resultados
+					for c := range titulos {
+						fmt.Printf("    [%s]\n", titulos[c])
+					}
+					fmt.Printf("\n")
+				}
+			}
 
-			// Mostramos la lista de textos guardados
-			if entradas.Texts != nil && len(entradas.Texts) != 0 {
-				boldBlue.Printf(" Textos guardados\n")
-				// Imprimimos los resultados
-				for c := range entradas.Texts {
-					fmt.Printf("    [%s]\n", entradas.Texts[c])
+			// Tipos que este cliente no conoce (creados con una versión más nueva)
+			for tipo, titulos := range tipos {
+				if _, ok := model.BuscarTipoEntrada(tipo); !ok {
+					boldBlue.Printf(" Otros (%s)\n", tipo)
+					for c := range titulos {
+						fmt.Printf("    [%s]\n", titulos[c])
+					}
+					fmt.Printf("\n")
 				}
 			}
 
 		} else {
-			boldBlue.Printf("* No hay nada guardado todavía\n")
+			boldBlue.Printf("* No hay nada guardado aquí todavía\n")
 		}
 	}
 	fmt.Printf("\n--------------------------------\n\n")
 
 	// Opciones
 	fmt.Println("1. Añadir entrada")
-	fmt.Println("2. Ver detalle de entrada")
-	fmt.Println("3. Configuración de mi cuenta")
+	fmt.Println("2. Buscar y ver entrada")
+	fmt.Println("3. Abrir carpeta")
+	if carpetaActual != "" || etiquetaActual != "" {
+		fmt.Println("4. Volver a la carpeta superior")
+	}
+	fmt.Println("5. Filtrar por etiqueta")
+	fmt.Println("6. Gestionar carpetas y etiquetas")
+	fmt.Println("7. Configuración de mi cuenta")
+	fmt.Println("8. Papelera")
+	fmt.Println("9. Salud de contraseñas")
 	fmt.Println("0. Salir")
 
 	// Mensaje de error en caso de existir
@@ -256,11 +320,44 @@ func uiUserMainMenu(showError string, showSuccess string) {
 	case inputSelectionStr == "1":
 		uiAddNewEntry("")
 	case inputSelectionStr == "2":
-		fmt.Print("Escribe el nombre de la entrada: ")
-		inputEntrySelectionStr := utils.CustomScanf()
-		uiDetailsEntry("", inputEntrySelectionStr)
+		uiBuscarEntradas()
 	case inputSelectionStr == "3":
+		fmt.Print("Escribe el nombre de la carpeta (o la ruta desde la raíz, /Trabajo/Servidores): ")
+		inputFolder := utils.CustomScanf()
+		base := carpetaActual
+		if strings.HasPrefix(inputFolder, "/") {
+			base = ""
+		}
+		if folderID, ok := org.buscarCarpeta(org.rutaCarpeta(base) + "/" + inputFolder); ok {
+			carpetaActual, etiquetaActual = folderID, ""
+			uiUserMainMenu("", "")
+		} else {
+			uiUserMainMenu("No existe ninguna carpeta con ese nombre.", "")
+		}
+	case inputSelectionStr == "4" && (carpetaActual != "" || etiquetaActual != ""):
+		if etiquetaActual != "" {
+			etiquetaActual = ""
+		} else {
+			carpetaActual = org.Carpetas[carpetaActual].Padre
+		}
+		uiUserMainMenu("", "")
+	case inputSelectionStr == "5":
+		fmt.Printf("Etiquetas: %s\n", strings.Join(org.nombresEtiquetas(mapKeys(org.Etiquetas)), ", "))
+		fmt.Print("Escribe el nombre de la etiqueta: ")
+		if tagID, ok := org.buscarEtiqueta(utils.CustomScanf()); ok {
+			etiquetaActual = tagID
+			uiUserMainMenu("", "")
+		} else {
+			uiUserMainMenu("No existe ninguna etiqueta con ese nombre.", "")
+		}
+	case inputSelectionStr == "6":
+		uiOrganizacion("", "")
+	case inputSelectionStr == "7":
 		uiUserConfiguration("")
+	case inputSelectionStr == "8":
+		uiPapelera("", "")
+	case inputSelectionStr == "9":
+		uiSaludContrasenas("", "")
 	case inputSelectionStr == "0":
 		uiInicio("", "")
 	default:
@@ -268,6 +365,326 @@ func uiUserMainMenu(showError string, showSuccess string) {
 	}
 }
 
+// imprimirCaducadas resalta las entradas que han caducado (en rojo) o que
+// caducan en los próximos config.ExpiryWarningDays días (en amarillo)
+func imprimirCaducadas(entradas []entradaListado) {
+	var avisos []entradaListado
+	for _, entrada := range entradas {
+		if caducaPronto(entrada.Vence) {
+			avisos = append(avisos, entrada)
+		}
+	}
+	if len(avisos) == 0 {
+		return
+	}
+	sort.SliceStable(avisos, func(i, j int) bool {
+		return avisos[i].Vence.Before(avisos[j].Vence)
+	})
+
+	color.New(color.FgHiYellow, color.Bold).Printf(" Contraseñas que renovar\n")
+	for _, entrada := range avisos {
+		if caducada(entrada.Vence) {
+			color.HiRed("    [%s] %s", entrada.Titulo, descripcionCaducidad(entrada.Vence))
+		} else {
+			color.HiYellow("    [%s] %s", entrada.Titulo, descripcionCaducidad(entrada.Vence))
+		}
+	}
+	fmt.Printf("\n")
+}
+
+// Pantalla de búsqueda incremental: los resultados se actualizan con cada
+// tecla sobre las entradas ya descifradas, sin volver a pedirlas al servidor
+func uiBuscarEntradas() {
+
+	// Recuperamos y desciframos todas las entradas una sola vez
+	org, err := leerOrganizacion(httpClient)
+	vault := make(map[string]model.VaultEntry)
+	if err == nil {
+		vault, err = leerBoveda(httpClient)
+	}
+	if err != nil {
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiUserMainMenu("Ocurrio un error al recuperar las entradas ("+err.Error()+").", "")
+		}
+		return
+	}
+
+	restaurar, ok := utils.ModoTeclaPorTecla()
+	if !ok {
+		// Sin terminal no se pueden leer las teclas una a una: se pide la consulta entera
+		uiBuscarEntradasLinea(org, vault)
+		return
+	}
+
+	consulta := ""
+	seleccion := 0
+	for {
+		resultados := buscarEntradas(org, vault, consulta)
+		if len(resultados) > maxResultadosUI {
+			resultados = resultados[:maxResultadosUI]
+		}
+		if seleccion >= len(resultados) {
+			seleccion = len(resultados) - 1
+		}
+		if seleccion < 0 {
+			seleccion = 0
+		}
+		imprimirBusqueda(consulta, resultados, seleccion)
+
+		switch tecla := utils.LeerTecla(); tecla {
+		case utils.TeclaEnter:
+			if len(resultados) != 0 {
+				restaurar()
+				uiDetailsEntry("", resultados[seleccion].ID)
+				return
+			}
+		case utils.TeclaEscape, utils.TeclaCancelar:
+			restaurar()
+			uiUserMainMenu("", "")
+			return
+		case utils.TeclaBorrar:
+			if runas := []rune(consulta); len(runas) != 0 {
+				consulta = string(runas[:len(runas)-1])
+			}
+		case utils.TeclaArriba:
+			seleccion--
+		case utils.TeclaAbajo:
+			seleccion++
+		case utils.TeclaDesconoce:
+		default:
+			consulta += tecla
+			seleccion = 0
+		}
+	}
+}
+
+// Número máximo de resultados que se muestran en la búsqueda
+const maxResultadosUI = 10
+
+// imprimirBusqueda dibuja la pantalla de búsqueda con el terminal en modo
+// "raw", en el que cada salto de línea debe volver también al principio
+func imprimirBusqueda(consulta string, resultados []resultadoBusqueda, seleccion int) {
+	var pantalla strings.Builder
+
+	pantalla.WriteString("\033[H\033[2J")
+	pantalla.WriteString("# Buscar entradas\n\n")
+	pantalla.WriteString(color.New(color.FgHiBlue, color.Bold).Sprintf(" Buscar: ") + consulta + "_\n\n")
+
+	if consulta != "" && len(resultados) == 0 {
+		pantalla.WriteString(color.HiRedString("* No hay ninguna entrada que coincida\n"))
+	}
+	for i, resultado := range resultados {
+		linea := fmt.Sprintf("[%s] (%s) - %s", resultado.Entrada.Title, nombreTipo(resultado.Entrada.Type), resultado.Coincidencia)
+		if i == seleccion {
+			pantalla.WriteString(color.New(color.FgHiGreen, color.Bold).Sprintf("  > %s", linea) + "\n")
+		} else {
+			pantalla.WriteString("    " + linea + "\n")
+		}
+	}
+
+	pantalla.WriteString("\n--------------------------------\n\n")
+	pantalla.WriteString("Flechas arriba/abajo: elegir - Enter: ver entrada - Esc: volver\n")
+
+	fmt.Print(strings.Replace(pantalla.String(), "\n", "\r\n", -1))
+}
+
+// uiBuscarEntradasLinea es la búsqueda cuando la entrada no es un terminal:
+// se lee la consulta completa y se elige el resultado por su número
+func uiBuscarEntradasLinea(org organizacion, vault map[string]model.VaultEntry) {
+	fmt.Print("Buscar: ")
+	resultados := buscarEntradas(org, vault, utils.CustomScanf())
+	if len(resultados) == 0 {
+		uiUserMainMenu("No hay ninguna entrada que coincida con la búsqueda.", "")
+		return
+	}
+	if len(resultados) > maxResultadosUI {
+		resultados = resultados[:maxResultadosUI]
+	}
+	for i, resultado := range resultados {
+		fmt.Printf("%d. [%s] (%s) - %s\n", i+1, resultado.Entrada.Title, nombreTipo(resultado.Entrada.Type), resultado.Coincidencia)
+	}
+	fmt.Print("\nSeleccione una entrada: ")
+	if i, err := strconv.Atoi(utils.CustomScanf()); err == nil && i >= 1 && i <= len(resultados) {
+		uiDetailsEntry("", resultados[i-1].ID)
+	} else {
+		uiUserMainMenu("La opción elegida no es correcta", "")
+	}
+}
+
+// nombreTipo devuelve el nombre para mostrar de un tipo de entrada
+func nombreTipo(tipo string) string {
+	if esquema, ok := model.BuscarTipoEntrada(tipo); ok {
+		return esquema.Nombre
+	}
+	return tipo
+}
+
+// Pantalla de gestión de carpetas y etiquetas
+func uiOrganizacion(showError string, showSuccess string) {
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Título de la pantalla
+	fmt.Printf("# Carpetas y etiquetas\n")
+
+	// Mensaje de confirmación de acción en caso de existir
+	if showSuccess != "" {
+		color.HiGreen("\n* %s\n", showSuccess)
+	}
+
+	fmt.Printf("\n--------------------------------\n\n")
+	org, err := leerOrganizacion(httpClient)
+	if err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiUserMainMenu("No se han podido recuperar las carpetas y etiquetas.", "")
+		}
+	}
+
+	// Mostramos el árbol de carpetas y la lista de etiquetas
+	boldBlue := color.New(color.FgHiBlue, color.Bold)
+	boldBlue.Printf(" Carpetas\n")
+	var imprimirCarpetas func(folderID string, nivel int)
+	imprimirCarpetas = func(folderID string, nivel int) {
+		for _, childID := range org.subcarpetas(folderID) {
+			fmt.Printf("%s[+] %s\n", strings.Repeat("    ", nivel+1), org.Carpetas[childID].Nombre)
+			imprimirCarpetas(childID, nivel+1)
+		}
+	}
+	imprimirCarpetas("", 0)
+	boldBlue.Printf("\n Etiquetas\n")
+	for _, nombre := range org.nombresEtiquetas(mapKeys(org.Etiquetas)) {
+		fmt.Printf("    #%s\n", nombre)
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Opciones
+	fmt.Printf("1. Nueva carpeta (en %s)\n", org.rutaCarpeta(carpetaActual))
+	fmt.Println("2. Renombrar o mover carpeta")
+	fmt.Println("3. Eliminar carpeta")
+	fmt.Println("4. Nueva etiqueta")
+	fmt.Println("5. Renombrar etiqueta")
+	fmt.Println("6. Eliminar etiqueta")
+	fmt.Println("0. Volver")
+
+	// Mensaje de error en caso de existir
+	if showError != "" {
+		color.HiRed("\n* %s", showError)
+	}
+
+	// Lectura de opción elegida
+	fmt.Printf("\nSeleccione una opción: ")
+	inputSelectionStr := utils.CustomScanf()
+
+	var errAction error
+	var success string
+	switch inputSelectionStr {
+	case "1":
+		fmt.Print("Nombre de la carpeta: ")
+		inputName := utils.CustomScanf()
+		if inputName == "" || strings.Contains(inputName, "/") {
+			uiOrganizacion("El nombre no puede estar vacío ni contener \"/\".", "")
+		}
+		_, errAction = crearCarpeta(httpClient, inputName, carpetaActual)
+		success = "Carpeta [" + inputName + "] creada correctamente"
+	case "2":
+		fmt.Print("Ruta de la carpeta (/Trabajo/Servidores): ")
+		folderID, ok := org.buscarCarpeta(utils.CustomScanf())
+		if !ok || folderID == "" {
+			uiOrganizacion("No existe ninguna carpeta con esa ruta.", "")
+		}
+		fmt.Printf("Nuevo nombre (ENTER para mantener [%s]): ", org.Carpetas[folderID].Nombre)
+		inputName := utils.CustomScanf()
+		if inputName == "" {
+			inputName = org.Carpetas[folderID].Nombre
+		}
+		fmt.Printf("Nueva carpeta superior (ENTER para mantener [%s]): ", org.rutaCarpeta(org.Carpetas[folderID].Padre))
+		padre := org.Carpetas[folderID].Padre
+		if inputParent := utils.CustomScanf(); inputParent != "" {
+			if padre, ok = org.buscarCarpeta(inputParent); !ok {
+				uiOrganizacion("No existe ninguna carpeta con esa ruta.", "")
+			}
+		}
+		errAction = editarCarpeta(httpClient, folderID, inputName, padre)
+		success = "Carpeta [" + inputName + "] modificada correctamente"
+	case "3":
+		fmt.Print("Ruta de la carpeta (/Trabajo/Servidores): ")
+		folderID, ok := org.buscarCarpeta(utils.CustomScanf())
+		if !ok || folderID == "" {
+			uiOrganizacion("No existe ninguna carpeta con esa ruta.", "")
+		}
+		fmt.Print("Su contenido pasará a la carpeta superior. ¿Estás seguro? (si, no): ")
+		if inputDecission := utils.CustomScanf(); inputDecission != "si" && inputDecission != "s" {
+			uiOrganizacion("", "")
+		}
+		errAction = eliminarCarpeta(httpClient, folderID)
+		success = "Carpeta [" + org.Carpetas[folderID].Nombre + "] eliminada correctamente"
+	case "4":
+		fmt.Print("Nombre de la etiqueta: ")
+		inputName := utils.CustomScanf()
+		if _, exists := org.buscarEtiqueta(inputName); exists || inputName == "" {
+			uiOrganizacion("El nombre está vacío o ya existe una etiqueta con ese nombre.", "")
+		}
+		_, errAction = crearEtiqueta(httpClient, inputName)
+		success = "Etiqueta [" + inputName + "] creada correctamente"
+	case "5":
+		fmt.Print("Nombre de la etiqueta: ")
+		tagID, ok := org.buscarEtiqueta(utils.CustomScanf())
+		if !ok {
+			uiOrganizacion("No existe ninguna etiqueta con ese nombre.", "")
+		}
+		fmt.Print("Nuevo nombre: ")
+		inputName := utils.CustomScanf()
+		if _, exists := org.buscarEtiqueta(inputName); exists || inputName == "" {
+			uiOrganizacion("El nombre está vacío o ya existe una etiqueta con ese nombre.", "")
+		}
+		errAction = renombrarEtiqueta(httpClient, tagID, inputName)
+		success = "Etiqueta [" + inputName + "] renombrada correctamente"
+	case "6":
+		fmt.Print("Nombre de la etiqueta: ")
+		tagID, ok := org.buscarEtiqueta(utils.CustomScanf())
+		if !ok {
+			uiOrganizacion("No existe ninguna etiqueta con ese nombre.", "")
+		}
+		errAction = eliminarEtiqueta(httpClient, tagID)
+		success = "Etiqueta [" + org.Etiquetas[tagID] + "] eliminada correctamente"
+	case "0":
+		uiUserMainMenu("", "")
+	default:
+		uiOrganizacion("La opción elegida no es correcta", "")
+	}
+
+	if errAction != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch errAction.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		case "invalid parent":
+			uiOrganizacion("Una carpeta no puede estar dentro de sí misma.", "")
+		default:
+			uiOrganizacion("No se han podido guardar los cambios.", "")
+		}
+	} else {
+		uiOrganizacion("", success)
+	}
+}
+
+// mapKeys devuelve las claves de un mapa de nombres
+func mapKeys(m map[string]string) []string {
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
+
 // Pantalla de creación de nueva entrada
 func uiAddNewEntry(showError string) {
 
@@ -280,6 +697,10 @@ func uiAddNewEntry(showError string) {
 	// Solicitamos información de lo que queremos guardar de entre las posibles
 	fmt.Println("1. Texto")
 	fmt.Println("2. Cuenta de usuario")
+	fmt.Println("3. Tarjeta de pago")
+	fmt.Println("4. Documento de identidad")
+	fmt.Println("5. Clave SSH")
+	fmt.Println("6. Red Wi-Fi")
 	fmt.Println("0. Volver")
 
 	// Mensaje de error en caso de existir
@@ -296,6 +717,14 @@ func uiAddNewEntry(showError string) {
 		uiAddNewTextEntry("")
 	case "2":
 		uiAddNewAccountEntry("")
+	case "3":
+		uiAddNewTypedEntry(model.TipoTarjeta)
+	case "4":
+		uiAddNewTypedEntry(model.TipoIdentidad)
+	case "5":
+		uiAddNewTypedEntry(model.TipoSSH)
+	case "6":
+		uiAddNewTypedEntry(model.TipoWifi)
 	case "0":
 		uiUserMainMenu("", "")
 	default:
@@ -303,6 +732,67 @@ func uiAddNewEntry(showError string) {
 	}
 }
 
+// Pantalla de creación de nueva entrada de cualquier tipo, pide
+// los campos en el orden que indica su esquema
+func uiAddNewTypedEntry(tipo string) {
+
+	esquema, _ := model.BuscarTipoEntrada(tipo)
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Título de la pantalla
+	fmt.Printf("# Añadir nueva entrada [%s]\n\n", esquema.Nombre)
+
+	// Lectura de los datos de la nueva entrada
+	fmt.Print("Título de la entrada: ")
+	inputTitle := utils.CustomScanf()
+
+	campos := make(map[string]string)
+	for _, campo := range esquema.Campos {
+		etiqueta := campo.Etiqueta
+		if campo.Opcional {
+			etiqueta += " (opcional, ENTER para omitir)"
+		}
+		if campo.Multilinea {
+			fmt.Printf("%s (línea vacía para terminar):\n", etiqueta)
+			campos[campo.Nombre] = utils.CustomScanfMultiline()
+		} else {
+			fmt.Printf("%s: ", etiqueta)
+			campos[campo.Nombre] = utils.CustomScanf()
+		}
+
+		// La URI otpauth:// se comprueba antes de guardarla
+		for campo.OTP {
+			valor, errOTP := validarCampoOTP(campos[campo.Nombre])
+			if errOTP == nil {
+				campos[campo.Nombre] = valor
+				break
+			}
+			color.HiRed("* La URI no es válida, debe empezar por otpauth://totp/ u otpauth://hotp/")
+			fmt.Printf("%s: ", etiqueta)
+			campos[campo.Nombre] = utils.CustomScanf()
+		}
+	}
+
+	// Petición al servidor
+	if _, err := crearEntradaConTipo(httpClient, model.VaultEntry{Title: inputTitle, Type: tipo, Folder: carpetaActual, Fields: campos}); err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		case "user not found":
+			uiLoginUser("Ha ocurrido un error al guardar la entrada en tu cuenta.")
+		case "entry already exists":
+			uiUserMainMenu("Ya existe una entrada con ese título.", "")
+		default:
+			uiUserMainMenu("Ocurrio un error al añadir la entrada el código.", "")
+		}
+	} else {
+		uiUserMainMenu("", "Entrada ["+inputTitle+"] añadida correctamente")
+	}
+}
+
 // Pantalla de creación de nueva entrada de tipo texto
 func uiAddNewTextEntry(showError string) {
 
@@ -324,7 +814,7 @@ func uiAddNewTextEntry(showError string) {
 	inputText := utils.CustomScanf()
 
 	// Petición al servidor
-	if err := crearEntradaDeTexto(httpClient, inputTitle, inputText); err != nil {
+	if _, err := crearEntradaConTipo(httpClient, model.VaultEntry{Title: inputTitle, Type: model.TipoTexto, Folder: carpetaActual, Fields: map[string]string{"text": inputText}}); err != nil {
 		// Si hay un error, mostramos el mensaje de error adecuado
 		switch err.Error() {
 		case "unauthorized":
@@ -360,51 +850,32 @@ func uiAddNewAccountEntry(showError string) {
 	inputAccountType := utils.CustomScanf()
 	fmt.Print("Usuario: ")
 	inputAccountUser := utils.CustomScanf()
-	fmt.Print("¿Deseas generar una contraseña? (si, no): ")
-	inputGeneratePassw := utils.CustomScanf()
 
 	var finalPassw string
-	if inputGeneratePassw == "si" || inputGeneratePassw == "s" {
-
-		// Solicitamos información de como se desea generar la contraseña
-		for {
-			// Tamaño de la contraseña
-			var genLenght int
-			for {
-				fmt.Print("¿Que tamaño de contraseña deseas? ")
-				inputLenght := utils.CustomScanf()
-				if convLenght, err := strconv.Atoi(inputLenght); err == nil {
-					genLenght = convLenght
-					break
-				}
-			}
-
-			// La contraseña generada puede tener números
-			fmt.Print("¿Deseas que tenga números? (si, no): ")
-			inputWithNums := utils.CustomScanf()
-			genWithNums := inputWithNums == "si" || inputWithNums == "s"
-
-			// La contraseña generada puede tener simbolos
-			fmt.Print("¿Deseas que tenga símbolos? (si, no): ")
-			inputWithSymbols := utils.CustomScanf()
-			genWithSymbols := inputWithSymbols == "si" || inputWithSymbols == "s"
-
-			// Mostramos la contraseña y preguntamos al usuario si está de acuerdo
-			finalPassw = utils.GeneratePassword(genLenght, true, genWithNums, genWithSymbols)
-			fmt.Printf("La contraseña es: %s\n¿Estás de acuerdo? (si, no): ", finalPassw)
-			inputConfirm := utils.CustomScanf()
-			if inputConfirm == "si" || inputConfirm == "s" {
-				break
-			}
+	for {
+		fmt.Print("¿Deseas generar una contraseña? (si, no): ")
+		inputGeneratePassw := utils.CustomScanf()
+		if inputGeneratePassw == "si" || inputGeneratePassw == "s" {
+			finalPassw = uiGenerarContrasena(utils.PasswordRules{})
+		} else {
+			fmt.Print("Contraseña: ")
+			finalPassw = utils.CustomScanf()
 		}
 
-	} else {
-		fmt.Print("Contraseña: ")
-		finalPassw = utils.CustomScanf()
+		// Comprobamos (sin enviarla) si aparece en filtraciones conocidas
+		veces, errFiltrada := vecesFiltrada(httpClient, finalPassw)
+		if errFiltrada != nil || veces == 0 {
+			break
+		}
+		color.HiRed("* Esta contraseña aparece %d veces en filtraciones conocidas.", veces)
+		fmt.Print("¿Quieres usarla igualmente? (si, no): ")
+		if inputConfirm := utils.CustomScanf(); inputConfirm == "si" || inputConfirm == "s" {
+			break
+		}
 	}
 
 	// Petición al servidor
-	if err := crearEntradaDeCuenta(httpClient, inputAccountType, inputAccountUser, finalPassw); err != nil {
+	if _, err := crearEntradaConTipo(httpClient, model.VaultEntry{Title: inputAccountType, Type: model.TipoCuenta, Folder: carpetaActual, Fields: map[string]string{"user": inputAccountUser, "password": finalPassw}}); err != nil {
 		// Si hay un error, mostramos el mensaje de error adecuado
 		switch err.Error() {
 		case "unauthorized":
@@ -421,18 +892,128 @@ func uiAddNewAccountEntry(showError string) {
 	}
 }
 
+// uiGenerarContrasena pregunta cómo generar una contraseña hasta que el
+// usuario está de acuerdo con la generada, y la devuelve. La contraseña
+// cumple las reglas indicadas (las de la entrada a la que va destinada)
+func uiGenerarContrasena(reglas utils.PasswordRules) string {
+	for {
+		if !reglas.Empty() {
+			fmt.Printf("Reglas de la contraseña: %s\n", reglas)
+		}
+
+		// Tipo de contraseña
+		fmt.Println("¿Qué tipo de contraseña deseas?")
+		fmt.Println("1. Aleatoria")
+		fmt.Println("2. Pronunciable (sílabas, con los números y símbolos al final)")
+		fmt.Println("3. Frase de contraseña (palabras al azar)")
+		fmt.Print("Selecciona una opción: ")
+		inputTipo := utils.CustomScanf()
+
+		var finalPassw string
+		var entropia float64
+		var err error
+		switch inputTipo {
+		case "1", "2":
+			opciones := utils.DefaultPasswordOptions(uiPedirNumero("¿Que tamaño de contraseña deseas?", 20))
+			opciones.Pronunciable = inputTipo == "2"
+			if !opciones.Pronunciable {
+				opciones.MinMinusculas = uiPedirMinimo("minúsculas")
+			}
+			opciones.MinMayusculas = uiPedirMinimo("mayúsculas")
+			opciones.MinNumeros = uiPedirMinimo("números")
+			opciones.MinSimbolos = uiPedirMinimo("símbolos")
+			if !opciones.Pronunciable {
+				fmt.Print("Otros caracteres que pueden aparecer (vacío para ninguno): ")
+				opciones.Adicionales = utils.CustomScanf()
+			}
+			fmt.Print("Caracteres que no deben aparecer (vacío para ninguno): ")
+			opciones.Excluidos = utils.CustomScanf()
+			fmt.Printf("¿Excluir los que se confunden (%s)? (si, no): ", utils.CaracteresAmbiguos)
+			inputAmbiguos := utils.CustomScanf()
+			opciones.SinAmbiguos = inputAmbiguos == "si" || inputAmbiguos == "s"
+			finalPassw, entropia, err = utils.GeneratePasswordWithOptions(reglas.Apply(opciones))
+		case "3":
+			opciones := utils.PassphraseOptions{Palabras: uiPedirNumero("¿Cuántas palabras deseas?", 6), Separador: "-"}
+			fmt.Print("Separador entre palabras [-]: ")
+			if inputSeparador := utils.CustomScanf(); inputSeparador != "" {
+				opciones.Separador = inputSeparador
+			}
+			fmt.Print("¿Empezar cada palabra en mayúscula? (si, no): ")
+			inputMayusculas := utils.CustomScanf()
+			opciones.Mayusculas = inputMayusculas == "si" || inputMayusculas == "s"
+			opciones.Digitos = uiPedirNumero("¿Cuántas cifras añadir a una de las palabras?", 0)
+			finalPassw, entropia, err = utils.GeneratePassphrase(opciones)
+		default:
+			continue
+		}
+		if err != nil {
+			color.HiRed("* %s\n", descripcionErrorGenerador(err))
+			continue
+		}
+		if incumplidas := reglas.Check(finalPassw); len(incumplidas) != 0 {
+			color.HiRed("* La contraseña generada no cumple las reglas: %s\n", strings.Join(incumplidas, ", "))
+			continue
+		}
+
+		// Mostramos la contraseña y preguntamos al usuario si está de acuerdo
+		fmt.Printf("La contraseña es: %s\nEntropía: %s\n¿Estás de acuerdo? (si, no): ", finalPassw, descripcionEntropia(entropia))
+		inputConfirm := utils.CustomScanf()
+		if inputConfirm == "si" || inputConfirm == "s" {
+			return finalPassw
+		}
+	}
+}
+
+// uiPedirNumero pide un número positivo (o 0) hasta que el valor es válido.
+// Si no se escribe nada, se usa el valor por defecto
+func uiPedirNumero(pregunta string, defecto int) int {
+	for {
+		fmt.Printf("%s [%d]: ", pregunta, defecto)
+		input := utils.CustomScanf()
+		if input == "" {
+			return defecto
+		}
+		if numero, err := strconv.Atoi(input); err == nil && numero >= 0 {
+			return numero
+		}
+	}
+}
+
+// uiPedirMinimo pide cuántos caracteres de una clase debe tener como mínimo
+// la contraseña generada ("no" para que no aparezca ninguno; devuelve -1)
+func uiPedirMinimo(clase string) int {
+	for {
+		fmt.Printf("Mínimo de %s (\"no\" para excluir) [1]: ", clase)
+		input := utils.CustomScanf()
+		switch input {
+		case "":
+			return 1
+		case "no", "n":
+			return -1
+		}
+		if numero, err := strconv.Atoi(input); err == nil && numero >= 0 {
+			return numero
+		}
+	}
+}
+
 // Pantalla de visualización de detalles de una entrada
-func uiDetailsEntry(showError string, entryName string) {
+func uiDetailsEntry(showError string, entryID string) {
 
 	// Limpiamos la pantalla
 	utils.ClearScreen()
 
-	// Título de la pantalla
-	fmt.Printf("# Detalles de la entrada [%s]\n\n", entryName)
-
 	// Petición al servidor
-	fmt.Printf("--------------------------------\n\n")
-	entry, err := detallesEntrada(httpClient, entryName)
+	entry, err := detallesEntrada(httpClient, entryID)
+	org, _ := leerOrganizacion(httpClient)
+
+	// Título de la pantalla
+	fmt.Printf("# Detalles de la entrada [%s]\n\n", entry.Title)
+	fmt.Printf("Carpeta: %s\n", org.rutaCarpeta(entry.Folder))
+	if etiquetas := org.nombresEtiquetas(entry.Tags); len(etiquetas) != 0 {
+		fmt.Printf("Etiquetas: #%s\n", strings.Join(etiquetas, " #"))
+	}
+	fmt.Printf("\n--------------------------------\n\n")
 	if err != nil {
 		// Si hay un error, mostramos el mensaje de error adecuado
 		switch err.Error() {
@@ -445,26 +1026,64 @@ func uiDetailsEntry(showError string, entryName string) {
 		}
 	} else {
 		// Si los detalles de la cuenta están vacios
-		if (model.VaultEntry{}) == entry {
+		if len(entry.Fields) == 0 {
 			// Volvemos al menú del usuario
 			uiUserMainMenu("No se han podido obtener detalles de la cuenta elegida.", "")
 		}
 
-		// Comprobamos el tipo de entrada (texto, cuenta) y la mostramos
-		if entry.Mode == 0 {
-			// Si es una entrada de tipo texto
-			fmt.Printf("[Texto] \n\n%s\n", entry.Text)
+		// Mostramos los campos en el orden del esquema del tipo de entrada
+		if esquema, ok := model.BuscarTipoEntrada(entry.Type); ok {
+			for _, campo := range esquema.Campos {
+				if valor := entry.Fields[campo.Nombre]; valor == "" {
+					continue
+				} else if campo.OTP {
+					fmt.Printf("[%s] -> %s \n", "Código 2FA", descripcionOTP(entry))
+				} else if campo.Multilinea {
+					fmt.Printf("[%s] \n\n%s\n\n", campo.Etiqueta, valor)
+				} else {
+					fmt.Printf("[%s] -> %s \n", campo.Etiqueta, valor)
+				}
+			}
+
+		} else {
+			// Si es un tipo que este cliente no conoce, lo mostramos tal cual
+			color.HiYellow("* Tipo de entrada desconocido [%s], actualiza el cliente para verla correctamente.\n\n", entry.Type)
+			for nombre, valor := range entry.Fields {
+				fmt.Printf("[%s] -> %s \n", nombre, valor)
+			}
+		}
+
+		// Campos personalizados y URLs
+		imprimirExtras(entry, false)
+
+		// Reglas de la contraseña
+		if reglas, origen, errReglas := reglasEntrada(entry); errReglas == nil && !reglas.Empty() {
+			fmt.Printf("\n[Reglas] -> %s (%s)\n", reglas, descripcionOrigenReglas(origen))
+		}
 
-		} else if entry.Mode == 1 {
-			// Si es una entrada de tipo cuenta de usuario
-			fmt.Printf("[Usuario] -> %s \n", entry.User)
-			fmt.Printf("[Contraseña] -> %s \n", entry.Password)
+		// Caducidad de la entrada
+		if vence := vencimientoEntrada(entry); caducada(vence) {
+			color.HiRed("\n[Caducidad] -> %s", descripcionCaducidad(vence))
+		} else if caducaPronto(vence) {
+			color.HiYellow("\n[Caducidad] -> %s", descripcionCaducidad(vence))
+		} else if !vence.IsZero() {
+			fmt.Printf("\n[Caducidad] -> %s\n", descripcionCaducidad(vence))
 		}
 	}
 	fmt.Printf("\n--------------------------------\n\n")
 
 	// Opciones
 	fmt.Println("1. Borrar entrada")
+	fmt.Println("2. Campos personalizados y URLs")
+	fmt.Println("3. Cambiar carpeta y etiquetas")
+	fmt.Println("4. Historial de versiones")
+	fmt.Println("5. Ficheros adjuntos")
+	_, tieneOTP := campoOTP(entry)
+	if tieneOTP {
+		fmt.Println("6. Verificación en dos pasos (códigos 2FA)")
+	}
+	fmt.Println("7. Caducidad y renovación de la contraseña")
+	fmt.Println("8. Reglas de la contraseña")
 	fmt.Println("0. Volver")
 
 	// Mensaje de error en caso de existir
@@ -478,12 +1097,12 @@ func uiDetailsEntry(showError string, entryName string) {
 
 	switch {
 	case inputSelectionStr == "1":
-		fmt.Print("¿Estás seguro? (si, no): ")
+		fmt.Printf("La entrada se podrá recuperar de la papelera durante %d días. ¿Estás seguro? (si, no): ", config.TrashRetentionDays)
 		inputDecission := utils.CustomScanf()
 		if inputDecission == "si" || inputDecission == "s" {
 
-			// Petición al servidor para eliminar la entrada de la BD
-			if errDel := eliminarEntrada(httpClient, entryName); errDel != nil {
+			// Petición al servidor para enviar la entrada a la papelera
+			if errDel := eliminarEntrada(httpClient, entryID); errDel != nil {
 				// Si hay un error, mostramos el mensaje de error adecuado
 				switch errDel.Error() {
 				case "unauthorized":
@@ -496,31 +1115,1011 @@ func uiDetailsEntry(showError string, entryName string) {
 
 			} else {
 				// Se ha eliminado correctamente
-				uiUserMainMenu("", "Entrada ["+entryName+"] eliminada correctamente")
+				uiUserMainMenu("", "Entrada ["+entry.Title+"] enviada a la papelera")
 			}
 		} else {
-			uiDetailsEntry("", entryName)
+			uiDetailsEntry("", entryID)
+		}
+	case inputSelectionStr == "2":
+		uiEntryExtras("", "", entryID, false)
+	case inputSelectionStr == "3":
+		fmt.Printf("Carpeta (ruta desde la raíz, ENTER para mantener [%s]): ", org.rutaCarpeta(entry.Folder))
+		if inputFolder := utils.CustomScanf(); inputFolder != "" {
+			folderID, ok := org.buscarCarpeta(inputFolder)
+			if !ok {
+				uiDetailsEntry("No existe ninguna carpeta con esa ruta.", entryID)
+			}
+			entry.Folder = folderID
+		}
+		fmt.Print("Etiquetas separadas por comas (ENTER para mantener, \"-\" para quitarlas): ")
+		if inputTags := utils.CustomScanf(); inputTags == "-" {
+			entry.Tags = nil
+		} else if inputTags != "" {
+			tagIDs, errTags := asegurarEtiquetas(httpClient, &org, strings.Split(inputTags, ","))
+			if errTags != nil {
+				uiDetailsEntry("No se han podido crear las etiquetas.", entryID)
+			}
+			entry.Tags = tagIDs
 		}
+		if errEdit := editarEntrada(httpClient, entryID, entry); errEdit != nil {
+			uiDetailsEntry("No se han podido guardar los cambios.", entryID)
+		}
+		uiDetailsEntry("", entryID)
+	case inputSelectionStr == "4":
+		uiRevisionesEntrada("", "", entryID, 0)
+	case inputSelectionStr == "5":
+		uiAdjuntosEntrada("", "", entryID)
+	case inputSelectionStr == "6" && tieneOTP:
+		uiOTPEntrada("", "", entryID)
+	case inputSelectionStr == "7":
+		uiCaducidadEntrada("", "", entryID)
+	case inputSelectionStr == "8":
+		uiReglasEntrada("", "", entryID)
 	case inputSelectionStr == "0":
 		uiUserMainMenu("", "")
 	default:
-		uiDetailsEntry("La opción elegida no es correcta", entryName)
+		uiDetailsEntry("La opción elegida no es correcta", entryID)
 	}
 }
 
-// Pantalla de visualización de detalles de un usuario
-func uiUserConfiguration(showError string) {
+// Pantalla del informe de salud de contraseñas: contraseñas débiles,
+// reutilizadas o antiguas, desde donde se puede ir a la entrada o
+// generar una contraseña nueva
+func uiSaludContrasenas(showError string, showSuccess string) {
 
 	// Limpiamos la pantalla
 	utils.ClearScreen()
 
 	// Título de la pantalla
-	fmt.Printf("# Página de configuración de usuario\n\n")
+	fmt.Printf("# Salud de contraseñas\n")
 
-	// Petición al servidor
-	fmt.Printf("------ Información de la cuenta ------\n\n")
-	userDetails, err := detallesUsuario(httpClient)
-	if err != nil {
+	// Mensaje de confirmación de acción en caso de existir
+	if showSuccess != "" {
+		color.HiGreen("\n* %s\n", showSuccess)
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Petición al servidor, las contraseñas se revisan en el cliente
+	vault, err := leerBoveda(httpClient)
+	if err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiUserMainMenu("Ocurrió un error al recuperar las entradas.", "")
+		}
+		return
+	}
+
+	problemas, errFiltradas := informeSalud(vault, func(password string) (int, error) {
+		return vecesFiltrada(httpClient, password)
+	})
+	total := 0
+	for _, entry := range vault {
+		total += len(contrasenasEntrada(entry))
+	}
+	fmt.Printf("Contraseñas revisadas: %d\n\n", total)
+	if errFiltradas != nil {
+		color.HiYellow("* No se ha podido comprobar si aparecen en filtraciones conocidas (%s)\n", descripcionErrorFiltradas(errFiltradas))
+	}
+	if len(problemas) == 0 {
+		color.HiGreen("* No se ha encontrado ningún problema\n")
+	}
+
+	boldBlue := color.New(color.FgHiBlue, color.Bold)
+	tipo := ""
+	for i, problema := range problemas {
+		if problema.Tipo != tipo {
+			if tipo != "" {
+				fmt.Printf("\n")
+			}
+			tipo = problema.Tipo
+			boldBlue.Printf(" %s\n", nombreProblema(tipo))
+		}
+		fmt.Printf("  %d. [%s] %s: %s\n", i+1, problema.Titulo, problema.Campo.Etiqueta, problema.Detalle)
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Mensaje de error en caso de existir
+	if showError != "" {
+		color.HiRed("* %s\n\n", showError)
+	}
+
+	// Lectura de opción elegida
+	fmt.Printf("Escribe el número de un problema para solucionarlo (0 para volver): ")
+	inputSelectionStr := utils.CustomScanf()
+	if inputSelectionStr == "0" || inputSelectionStr == "" {
+		uiUserMainMenu("", "")
+		return
+	}
+	n, errNum := strconv.Atoi(inputSelectionStr)
+	if errNum != nil || n < 1 || n > len(problemas) {
+		uiSaludContrasenas("El número elegido no es correcto.", "")
+		return
+	}
+	problema := problemas[n-1]
+
+	fmt.Printf("\n[%s] %s\n", problema.Titulo, problema.Campo.Etiqueta)
+	fmt.Println("1. Ver la entrada")
+	fmt.Println("2. Generar una contraseña nueva")
+	fmt.Println("0. Volver")
+	fmt.Printf("\nSeleccione una opción: ")
+	switch utils.CustomScanf() {
+	case "1":
+		uiDetailsEntry("", problema.ID)
+	case "2":
+		entry := vault[problema.ID]
+		reglas, _, _ := reglasEntrada(entry)
+		setContrasena(&entry, problema.Campo, uiGenerarContrasena(reglas))
+		renovarEntrada(&entry)
+		if errEdit := editarEntrada(httpClient, problema.ID, entry); errEdit != nil {
+			uiSaludContrasenas("No se han podido guardar los cambios.", "")
+		} else {
+			uiSaludContrasenas("", "Contraseña de ["+problema.Titulo+"] cambiada, recuerda cambiarla también en el servicio")
+		}
+	default:
+		uiSaludContrasenas("", "")
+	}
+}
+
+// Pantalla de caducidad de una entrada: fecha límite, intervalo de renovación
+// de la contraseña y aviso por correo (que el usuario decide compartir)
+func uiCaducidadEntrada(showError string, showSuccess string, entryID string) {
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Petición al servidor
+	entry, err := detallesEntrada(httpClient, entryID)
+	if err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiUserMainMenu("No se han podido obtener detalles de la entrada elegida.", "")
+		}
+		return
+	}
+
+	// Título de la pantalla
+	fmt.Printf("# Caducidad de la entrada [%s]\n", entry.Title)
+
+	// Mensaje de confirmación de acción en caso de existir
+	if showSuccess != "" {
+		color.HiGreen("\n* %s\n", showSuccess)
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	valor := func(v string, vacio string) string {
+		if v == "" {
+			return vacio
+		}
+		return v
+	}
+	fmt.Printf("Fecha de caducidad: %s\n", valor(entry.Expires, "sin fecha"))
+	if entry.RotationDays != "" {
+		fmt.Printf("Renovar cada: %s días\n", entry.RotationDays)
+	} else {
+		fmt.Printf("Renovar cada: sin intervalo\n")
+	}
+	fmt.Printf("Última renovación: %s\n", valor(entry.Renewed, "desconocida"))
+	vence := vencimientoEntrada(entry)
+	if caducada(vence) {
+		color.HiRed("Estado: %s", descripcionCaducidad(vence))
+	} else if caducaPronto(vence) {
+		color.HiYellow("Estado: %s", descripcionCaducidad(vence))
+	} else {
+		fmt.Printf("Estado: %s\n", descripcionCaducidad(vence))
+	}
+	if entry.Reminder != nil {
+		fmt.Printf("Aviso por correo: sí, como [%s]\n", entry.Reminder.Nombre)
+	} else {
+		fmt.Printf("Aviso por correo: no\n")
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Opciones
+	fmt.Println("1. Fijar la fecha de caducidad")
+	fmt.Println("2. Fijar cada cuántos días hay que renovar la contraseña")
+	fmt.Println("3. Marcar como renovada")
+	if entry.Reminder != nil {
+		fmt.Println("4. Dejar de recibir avisos por correo")
+	} else {
+		fmt.Println("4. Recibir avisos por correo")
+	}
+	fmt.Println("0. Volver")
+
+	// Mensaje de error en caso de existir
+	if showError != "" {
+		color.HiRed("\n* %s", showError)
+	}
+
+	// Lectura de opción elegida
+	fmt.Printf("\nSeleccione una opción: ")
+	inputSelectionStr := utils.CustomScanf()
+
+	var mensaje string
+	switch inputSelectionStr {
+	case "1":
+		fmt.Print("Fecha de caducidad (AAAA-MM-DD, \"-\" para quitarla): ")
+		expires, errFecha := validarFechaCaducidad(utils.CustomScanf())
+		if errFecha != nil {
+			uiCaducidadEntrada("La fecha no es correcta, el formato es AAAA-MM-DD.", "", entryID)
+			return
+		}
+		setCaducidad(&entry, expires, entry.RotationDays)
+		mensaje = "Fecha de caducidad guardada"
+	case "2":
+		fmt.Print("Días entre renovaciones (0 para no renovarla periódicamente): ")
+		rotationDays, errDias := validarRotacion(utils.CustomScanf())
+		if errDias != nil {
+			uiCaducidadEntrada("El número de días no es correcto.", "", entryID)
+			return
+		}
+		setCaducidad(&entry, entry.Expires, rotationDays)
+		mensaje = "Intervalo de renovación guardado"
+	case "3":
+		if _, ok := entry.Fields["password"]; ok {
+			fmt.Print("Nueva contraseña (ENTER para mantener la actual): ")
+			if inputPassw := utils.CustomScanf(); inputPassw != "" {
+				entry.Fields["password"] = inputPassw
+			}
+		}
+		renovarEntrada(&entry)
+		mensaje = "Entrada marcada como renovada hoy"
+	case "4":
+		nombre := ""
+		if entry.Reminder == nil {
+			if vence.IsZero() {
+				uiCaducidadEntrada("La entrada no caduca, fija antes una fecha o un intervalo de renovación.", "", entryID)
+				return
+			}
+			fmt.Println("El servidor verá en claro el nombre que elijas y la fecha de caducidad, nada más de la entrada.")
+			fmt.Print("Nombre con el que aparecerá en el correo (ENTER para cancelar): ")
+			if nombre = utils.CustomScanf(); nombre == "" {
+				uiCaducidadEntrada("", "", entryID)
+				return
+			}
+			mensaje = "Recibirás un aviso por correo antes de que caduque"
+		} else {
+			mensaje = "Ya no recibirás avisos por correo de esta entrada"
+		}
+		setRecordatorio(&entry, nombre)
+	case "0":
+		uiDetailsEntry("", entryID)
+		return
+	default:
+		uiCaducidadEntrada("La opción elegida no es correcta", "", entryID)
+		return
+	}
+
+	// Petición al servidor
+	if errEdit := editarEntrada(httpClient, entryID, entry); errEdit != nil {
+		uiCaducidadEntrada("No se han podido guardar los cambios.", "", entryID)
+	} else {
+		uiCaducidadEntrada("", mensaje, entryID)
+	}
+}
+
+// Pantalla de reglas de la contraseña de una entrada: las propias de la
+// entrada o las de su dominio en el fichero compartido, que se respetan al
+// generar una contraseña nueva
+func uiReglasEntrada(showError string, showSuccess string, entryID string) {
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Petición al servidor
+	entry, err := detallesEntrada(httpClient, entryID)
+	if err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiUserMainMenu("No se han podido obtener detalles de la entrada elegida.", "")
+		}
+		return
+	}
+
+	// Título de la pantalla
+	fmt.Printf("# Reglas de la contraseña de [%s]\n", entry.Title)
+
+	// Mensaje de confirmación de acción en caso de existir
+	if showSuccess != "" {
+		color.HiGreen("\n* %s\n", showSuccess)
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	reglas, origen, errReglas := reglasEntrada(entry)
+	if errReglas != nil {
+		color.HiYellow("* No se ha podido leer el fichero de reglas por dominio (%s)\n", errReglas.Error())
+	}
+	fmt.Printf("Reglas: %s (%s)\n", reglas, descripcionOrigenReglas(origen))
+	contrasenas := contrasenasEntrada(entry)
+	for _, contrasena := range contrasenas {
+		if incumplidas := reglas.Check(contrasena.Valor); len(incumplidas) != 0 {
+			color.HiRed("%s: no cumple las reglas, %s", contrasena.Etiqueta, strings.Join(incumplidas, ", "))
+		}
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Opciones
+	fmt.Println("1. Cambiar las reglas de la entrada")
+	if origen == "entrada" {
+		fmt.Println("2. Quitar las reglas de la entrada")
+	}
+	if len(contrasenas) != 0 {
+		fmt.Println("3. Generar una contraseña nueva que cumpla las reglas")
+	}
+	fmt.Println("0. Volver")
+
+	// Mensaje de error en caso de existir
+	if showError != "" {
+		color.HiRed("\n* %s", showError)
+	}
+
+	// Lectura de opción elegida
+	fmt.Printf("\nSeleccione una opción: ")
+	inputSelectionStr := utils.CustomScanf()
+
+	var mensaje string
+	switch {
+	case inputSelectionStr == "1":
+		var nuevas utils.PasswordRules
+		var errClases error
+		fmt.Printf("Clases de caracteres: %s (minúsculas, mayúsculas, números y símbolos)\n", strings.Join(utils.ClasesCaracteres, ", "))
+		fmt.Print("Clases permitidas, separadas por comas (ENTER para todas): ")
+		if nuevas.Permitidas, errClases = utils.ParseClasses(utils.CustomScanf()); errClases == nil {
+			fmt.Print("Clases obligatorias, separadas por comas (ENTER para ninguna): ")
+			nuevas.Obligatorias, errClases = utils.ParseClasses(utils.CustomScanf())
+		}
+		if errClases != nil {
+			uiReglasEntrada(descripcionErrorReglas(errClases), "", entryID)
+			return
+		}
+		nuevas.LongitudMaxima = uiPedirNumero("Longitud máxima (0 para no limitarla)", 0)
+		fmt.Print("Caracteres prohibidos (ENTER para ninguno): ")
+		nuevas.Prohibidos = utils.CustomScanf()
+		if errSet := setReglas(&entry, nuevas); errSet != nil {
+			uiReglasEntrada(descripcionErrorReglas(errSet), "", entryID)
+			return
+		}
+		mensaje = "Reglas guardadas"
+	case inputSelectionStr == "2" && origen == "entrada":
+		setReglas(&entry, utils.PasswordRules{})
+		mensaje = "Reglas de la entrada eliminadas"
+	case inputSelectionStr == "3" && len(contrasenas) != 0:
+		contrasena := contrasenas[0]
+		if len(contrasenas) > 1 {
+			for i, c := range contrasenas {
+				fmt.Printf("%d. %s\n", i+1, c.Etiqueta)
+			}
+			fmt.Print("¿Qué contraseña quieres cambiar? ")
+			n, errNum := strconv.Atoi(utils.CustomScanf())
+			if errNum != nil || n < 1 || n > len(contrasenas) {
+				uiReglasEntrada("El número elegido no es correcto.", "", entryID)
+				return
+			}
+			contrasena = contrasenas[n-1]
+		}
+		setContrasena(&entry, contrasena, uiGenerarContrasena(reglas))
+		renovarEntrada(&entry)
+		mensaje = "Contraseña cambiada, recuerda cambiarla también en el servicio"
+	case inputSelectionStr == "0":
+		uiDetailsEntry("", entryID)
+		return
+	default:
+		uiReglasEntrada("La opción elegida no es correcta", "", entryID)
+		return
+	}
+
+	// Petición al servidor
+	if errEdit := editarEntrada(httpClient, entryID, entry); errEdit != nil {
+		uiReglasEntrada("No se han podido guardar los cambios.", "", entryID)
+	} else {
+		uiReglasEntrada("", mensaje, entryID)
+	}
+}
+
+// Pantalla de la papelera: entradas eliminadas, que se pueden recuperar
+// hasta que se vacía o se eliminan automáticamente
+func uiPapelera(showError string, showSuccess string) {
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Título de la pantalla
+	fmt.Printf("# Papelera\n")
+
+	// Mensaje de confirmación de acción en caso de existir
+	if showSuccess != "" {
+		color.HiGreen("\n* %s\n", showSuccess)
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Petición al servidor
+	eliminadas, err := leerPapelera(httpClient)
+	if err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiUserMainMenu("No se ha podido recuperar la papelera ("+err.Error()+").", "")
+		}
+	} else if len(eliminadas) == 0 {
+		boldBlue := color.New(color.FgHiBlue, color.Bold)
+		boldBlue.Printf("* La papelera está vacía\n")
+	} else {
+		boldBlue := color.New(color.FgHiBlue, color.Bold)
+		for i, eliminada := range eliminadas {
+			boldBlue.Printf(" %d. [%s] ", i+1, eliminada.Entrada.Title)
+			fmt.Printf("(%s) eliminada el %s, se borrará el %s\n", nombreTipo(eliminada.Entrada.Type),
+				eliminada.Fecha.Local().Format("2006-01-02 15:04"), eliminada.Purga().Local().Format("2006-01-02"))
+		}
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Opciones
+	if len(eliminadas) != 0 {
+		fmt.Println("1. Recuperar una entrada")
+		fmt.Println("2. Vaciar papelera")
+	}
+	fmt.Println("0. Volver")
+
+	// Mensaje de error en caso de existir
+	if showError != "" {
+		color.HiRed("\n* %s", showError)
+	}
+
+	// Lectura de opción elegida
+	fmt.Printf("\nSeleccione una opción: ")
+	inputSelectionStr := utils.CustomScanf()
+
+	switch {
+	case inputSelectionStr == "1" && len(eliminadas) != 0:
+		fmt.Print("Número de la entrada: ")
+		n, errNum := strconv.Atoi(utils.CustomScanf())
+		if errNum != nil || n < 1 || n > len(eliminadas) {
+			uiPapelera("No existe esa entrada en la papelera.", "")
+			return
+		}
+		if errRestore := restaurarDePapelera(httpClient, eliminadas[n-1]); errRestore != nil {
+			switch errRestore.Error() {
+			case "unauthorized":
+				uiLoginUser("La sesión de usuario ha cadudado.")
+			case "entry already exists":
+				uiPapelera("Ya existe otra entrada con el título ["+eliminadas[n-1].Entrada.Title+"].", "")
+			default:
+				uiPapelera("No se ha podido recuperar la entrada ("+errRestore.Error()+").", "")
+			}
+		} else {
+			uiPapelera("", "Entrada ["+eliminadas[n-1].Entrada.Title+"] recuperada correctamente")
+		}
+	case inputSelectionStr == "2" && len(eliminadas) != 0:
+		fmt.Print("Las entradas se eliminarán definitivamente. ¿Estás seguro? (si, no): ")
+		if inputDecission := utils.CustomScanf(); inputDecission != "si" && inputDecission != "s" {
+			uiPapelera("", "")
+		} else if count, errEmpty := vaciarPapelera(httpClient); errEmpty != nil {
+			uiPapelera("No se ha podido vaciar la papelera ("+errEmpty.Error()+").", "")
+		} else {
+			uiPapelera("", strconv.Itoa(count)+" entradas eliminadas definitivamente")
+		}
+	case inputSelectionStr == "0":
+		uiUserMainMenu("", "")
+	default:
+		uiPapelera("La opción elegida no es correcta", "")
+	}
+}
+
+// descripcionOTP muestra el código TOTP actual con su validez. Los códigos
+// HOTP no se generan al mostrar la entrada, porque cada uno se usa una vez
+func descripcionOTP(entry model.VaultEntry) string {
+	otp, ok := otpEntrada(entry)
+	switch {
+	case !ok:
+		return "URI otpauth:// no válida"
+	case otp.Tipo == "hotp":
+		return fmt.Sprintf("HOTP, siguiente contador %d (el código se genera al pedirlo)", otp.Contador)
+	}
+	codigo, restante := otp.CodigoTOTP(time.Now())
+	return fmt.Sprintf("%s (válido %d s)", formatoCodigoOTP(codigo), restante)
+}
+
+// Pantalla de la verificación en dos pasos de una entrada: muestra el código
+// actual y permite importar la semilla desde una URI otpauth:// o quitarla
+func uiOTPEntrada(showError string, showSuccess string, entryID string) {
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Petición al servidor
+	entry, err := detallesEntrada(httpClient, entryID)
+
+	// Título de la pantalla
+	fmt.Printf("# Verificación en dos pasos de [%s]\n", entry.Title)
+
+	// Mensaje de confirmación de acción en caso de existir
+	if showSuccess != "" {
+		color.HiGreen("\n* %s\n", showSuccess)
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	campo, _ := campoOTP(entry)
+	otp, tieneOTP := otpEntrada(entry)
+	if err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiDetailsEntry("No se ha podido recuperar la entrada.", entryID)
+		}
+	} else if !tieneOTP {
+		boldBlue := color.New(color.FgHiBlue, color.Bold)
+		boldBlue.Printf("* La entrada no tiene configurada la verificación en dos pasos\n")
+	} else {
+		boldBlue := color.New(color.FgHiBlue, color.Bold)
+		fmt.Printf("Servicio: %s\nCuenta: %s\nTipo: %s, %d dígitos, %s\n\n", otp.Emisor, otp.Cuenta, strings.ToUpper(otp.Tipo), otp.Digitos, otp.Algoritmo)
+		if otp.Tipo == "totp" {
+			codigo, restante := otp.CodigoTOTP(time.Now())
+			boldBlue.Printf(" Código: %s ", formatoCodigoOTP(codigo))
+			fmt.Printf("(válido %d s)\n", restante)
+		} else {
+			fmt.Printf("Siguiente contador: %d\n", otp.Contador)
+		}
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Opciones
+	if tieneOTP && otp.Tipo == "totp" {
+		fmt.Println("1. Actualizar código")
+	} else if tieneOTP {
+		fmt.Println("1. Generar siguiente código")
+	}
+	fmt.Println("2. Importar URI otpauth://")
+	if entry.Fields[campo.Nombre] != "" {
+		fmt.Println("3. Quitar verificación en dos pasos")
+	}
+	fmt.Println("0. Volver")
+
+	// Mensaje de error en caso de existir
+	if showError != "" {
+		color.HiRed("\n* %s", showError)
+	}
+
+	// Lectura de opción elegida
+	fmt.Printf("\nSeleccione una opción: ")
+	inputSelectionStr := utils.CustomScanf()
+
+	switch {
+	case inputSelectionStr == "1" && tieneOTP && otp.Tipo == "totp":
+		uiOTPEntrada("", "", entryID)
+	case inputSelectionStr == "1" && tieneOTP:
+		if codigo, _, errCode := generarCodigoOTP(httpClient, entryID, entry); errCode != nil {
+			uiOTPEntrada("No se ha podido guardar el contador ("+errCode.Error()+").", "", entryID)
+		} else {
+			uiOTPEntrada("", "Código: "+formatoCodigoOTP(codigo), entryID)
+		}
+	case inputSelectionStr == "2":
+		fmt.Print("URI otpauth:// (la del código QR del servicio): ")
+		if valor, errOTP := validarCampoOTP(utils.CustomScanf()); errOTP != nil || valor == "" {
+			uiOTPEntrada("La URI no es válida, debe empezar por otpauth://totp/ u otpauth://hotp/", "", entryID)
+		} else {
+			entry.Fields[campo.Nombre] = valor
+			if errEdit := editarEntrada(httpClient, entryID, entry); errEdit != nil {
+				uiOTPEntrada("No se han podido guardar los cambios.", "", entryID)
+			} else {
+				uiOTPEntrada("", "Verificación en dos pasos importada correctamente", entryID)
+			}
+		}
+	case inputSelectionStr == "3" && entry.Fields[campo.Nombre] != "":
+		delete(entry.Fields, campo.Nombre)
+		if errEdit := editarEntrada(httpClient, entryID, entry); errEdit != nil {
+			uiOTPEntrada("No se han podido guardar los cambios.", "", entryID)
+		} else {
+			uiOTPEntrada("", "Verificación en dos pasos eliminada de la entrada", entryID)
+		}
+	case inputSelectionStr == "0":
+		uiDetailsEntry("", entryID)
+	default:
+		uiOTPEntrada("La opción elegida no es correcta", "", entryID)
+	}
+}
+
+// Pantalla de los ficheros adjuntos de una entrada
+func uiAdjuntosEntrada(showError string, showSuccess string, entryID string) {
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Petición al servidor
+	entry, err := detallesEntrada(httpClient, entryID)
+	var adjuntos []adjuntoEntrada
+	if err == nil {
+		adjuntos, err = listarAdjuntos(httpClient, entryID)
+	}
+
+	// Título de la pantalla
+	fmt.Printf("# Ficheros adjuntos de [%s]\n", entry.Title)
+
+	// Mensaje de confirmación de acción en caso de existir
+	if showSuccess != "" {
+		color.HiGreen("\n* %s\n", showSuccess)
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	if err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiDetailsEntry("No se han podido recuperar los adjuntos de la entrada.", entryID)
+		}
+	} else if len(adjuntos) == 0 {
+		boldBlue := color.New(color.FgHiBlue, color.Bold)
+		boldBlue.Printf("* La entrada no tiene ficheros adjuntos\n")
+	} else {
+		boldBlue := color.New(color.FgHiBlue, color.Bold)
+		for i, adjunto := range adjuntos {
+			boldBlue.Printf(" %d. [%s] ", i+1, adjunto.Nombre)
+			fmt.Printf("%s, %s", formatoTamano(adjunto.Tamano), adjunto.Fecha.Local().Format("2006-01-02 15:04"))
+			if !adjunto.Completo {
+				color.New(color.FgHiYellow).Printf(" (subida incompleta)")
+			}
+			fmt.Printf("\n")
+		}
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Opciones
+	fmt.Println("1. Adjuntar fichero")
+	if len(adjuntos) != 0 {
+		fmt.Println("2. Descargar fichero")
+		fmt.Println("3. Eliminar fichero")
+	}
+	fmt.Println("0. Volver")
+
+	// Mensaje de error en caso de existir
+	if showError != "" {
+		color.HiRed("\n* %s", showError)
+	}
+
+	// Lectura de opción elegida
+	fmt.Printf("\nSeleccione una opción: ")
+	inputSelectionStr := utils.CustomScanf()
+
+	switch {
+	case inputSelectionStr == "1":
+		fmt.Print("Ruta del fichero: ")
+		ruta := utils.CustomScanf()
+		_, errUpload := subirAdjunto(httpClient, entryID, ruta, func(subido int64, total int64) {
+			fmt.Printf("\rSubiendo... %d%%", subido*100/total)
+		})
+		switch {
+		case errUpload == nil:
+			uiAdjuntosEntrada("", "Fichero ["+filepath.Base(ruta)+"] adjuntado correctamente", entryID)
+		case errUpload.Error() == "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		case errUpload.Error() == "unable to read":
+			uiAdjuntosEntrada("No se ha podido leer el fichero.", "", entryID)
+		case errUpload.Error() == "quota exceeded":
+			uiAdjuntosEntrada("No queda espacio suficiente para adjuntar el fichero.", "", entryID)
+		default:
+			uiAdjuntosEntrada("No se ha podido adjuntar el fichero ("+errUpload.Error()+").", "", entryID)
+		}
+	case inputSelectionStr == "2" && len(adjuntos) != 0:
+		fmt.Print("Número del fichero: ")
+		n, errNum := strconv.Atoi(utils.CustomScanf())
+		if errNum != nil || n < 1 || n > len(adjuntos) {
+			uiAdjuntosEntrada("No existe ese fichero.", "", entryID)
+			return
+		}
+		fmt.Printf("Guardar como (ENTER para [%s]): ", adjuntos[n-1].Nombre)
+		destino := utils.CustomScanf()
+		if destino == "" {
+			destino = filepath.Base(adjuntos[n-1].Nombre)
+		}
+		if errDownload := descargarAdjunto(httpClient, adjuntos[n-1].ID, destino); errDownload != nil {
+			switch errDownload.Error() {
+			case "unauthorized":
+				uiLoginUser("La sesión de usuario ha cadudado.")
+			case "unable to write":
+				uiAdjuntosEntrada("No se ha podido crear el fichero ["+destino+"] (¿ya existe?).", "", entryID)
+			case "incomplete":
+				uiAdjuntosEntrada("El fichero no se terminó de subir.", "", entryID)
+			default:
+				uiAdjuntosEntrada("No se ha podido descargar el fichero ("+errDownload.Error()+").", "", entryID)
+			}
+		} else {
+			uiAdjuntosEntrada("", "Fichero guardado en ["+destino+"]", entryID)
+		}
+	case inputSelectionStr == "3" && len(adjuntos) != 0:
+		fmt.Print("Número del fichero: ")
+		n, errNum := strconv.Atoi(utils.CustomScanf())
+		if errNum != nil || n < 1 || n > len(adjuntos) {
+			uiAdjuntosEntrada("No existe ese fichero.", "", entryID)
+			return
+		}
+		fmt.Print("El fichero se eliminará definitivamente. ¿Estás seguro? (si, no): ")
+		if inputDecission := utils.CustomScanf(); inputDecission != "si" && inputDecission != "s" {
+			uiAdjuntosEntrada("", "", entryID)
+		} else if errDelete := eliminarAdjunto(httpClient, adjuntos[n-1].ID); errDelete != nil {
+			uiAdjuntosEntrada("No se ha podido eliminar el fichero ("+errDelete.Error()+").", "", entryID)
+		} else {
+			uiAdjuntosEntrada("", "Fichero ["+adjuntos[n-1].Nombre+"] eliminado correctamente", entryID)
+		}
+	case inputSelectionStr == "0":
+		uiDetailsEntry("", entryID)
+	default:
+		uiAdjuntosEntrada("La opción elegida no es correcta", "", entryID)
+	}
+}
+
+// Pantalla del historial de versiones de una entrada. Si se indica una
+// versión (desde 1), se muestran sus diferencias con la versión actual
+func uiRevisionesEntrada(showError string, showSuccess string, entryID string, verRevision int) {
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Petición al servidor
+	entry, err := detallesEntrada(httpClient, entryID)
+	org, _ := leerOrganizacion(httpClient)
+	var revisiones []revisionEntrada
+	if err == nil {
+		revisiones, err = leerRevisiones(httpClient, entryID)
+	}
+
+	// Título de la pantalla
+	fmt.Printf("# Historial de la entrada [%s]\n", entry.Title)
+
+	// Mensaje de confirmación de acción en caso de existir
+	if showSuccess != "" {
+		color.HiGreen("\n* %s\n", showSuccess)
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	if err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiDetailsEntry("No se ha podido recuperar el historial de la entrada.", entryID)
+		}
+	} else if len(revisiones) == 0 {
+		boldBlue := color.New(color.FgHiBlue, color.Bold)
+		boldBlue.Printf("* La entrada no se ha modificado todavía\n")
+	} else {
+		// Cada versión se compara con la siguiente (la más reciente, con la actual)
+		boldBlue := color.New(color.FgHiBlue, color.Bold)
+		for i, revision := range revisiones {
+			siguiente := entry
+			if i > 0 {
+				siguiente = revisiones[i-1].Entrada
+			}
+			boldBlue.Printf(" %d. %s ", i+1, revision.Fecha.Local().Format("2006-01-02 15:04:05"))
+			fmt.Printf("(%s)\n", nombresCambios(diferenciasEntradas(org, revision.Entrada, siguiente)))
+		}
+
+		if verRevision >= 1 && verRevision <= len(revisiones) {
+			fmt.Printf("\nCambios de la versión %d a la actual:\n\n", verRevision)
+			cambios := diferenciasEntradas(org, revisiones[verRevision-1].Entrada, entry)
+			for _, cambio := range cambios {
+				fmt.Printf("[%s]\n", cambio.texto(true))
+			}
+			if len(cambios) == 0 {
+				fmt.Println("Es igual que la versión actual")
+			}
+		}
+	}
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Opciones
+	if len(revisiones) != 0 {
+		fmt.Println("1. Ver cambios de una versión")
+		fmt.Println("2. Restaurar una versión")
+	}
+	fmt.Println("0. Volver")
+
+	// Mensaje de error en caso de existir
+	if showError != "" {
+		color.HiRed("\n* %s", showError)
+	}
+
+	// Lectura de opción elegida
+	fmt.Printf("\nSeleccione una opción: ")
+	inputSelectionStr := utils.CustomScanf()
+
+	switch {
+	case inputSelectionStr == "1" && len(revisiones) != 0:
+		fmt.Print("Número de la versión: ")
+		if n, errNum := strconv.Atoi(utils.CustomScanf()); errNum != nil || n < 1 || n > len(revisiones) {
+			uiRevisionesEntrada("No existe esa versión.", "", entryID, 0)
+		} else {
+			uiRevisionesEntrada("", "", entryID, n)
+		}
+	case inputSelectionStr == "2" && len(revisiones) != 0:
+		fmt.Print("Número de la versión: ")
+		n, errNum := strconv.Atoi(utils.CustomScanf())
+		if errNum != nil || n < 1 || n > len(revisiones) {
+			uiRevisionesEntrada("No existe esa versión.", "", entryID, 0)
+			return
+		}
+		fmt.Print("La versión actual se guardará en el historial. ¿Estás seguro? (si, no): ")
+		if inputDecission := utils.CustomScanf(); inputDecission != "si" && inputDecission != "s" {
+			uiRevisionesEntrada("", "", entryID, 0)
+		} else if errRestore := restaurarRevision(httpClient, entryID, n-1); errRestore != nil {
+			uiRevisionesEntrada("No se ha podido restaurar la versión ("+errRestore.Error()+").", "", entryID, 0)
+		} else {
+			uiRevisionesEntrada("", "Versión "+strconv.Itoa(n)+" restaurada correctamente", entryID, 0)
+		}
+	case inputSelectionStr == "0":
+		uiDetailsEntry("", entryID)
+	default:
+		uiRevisionesEntrada("La opción elegida no es correcta", "", entryID, verRevision)
+	}
+}
+
+// Pantalla de edición de los campos personalizados y URLs de una entrada
+func uiEntryExtras(showError string, showSuccess string, entryID string, mostrarOcultos bool) {
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Petición al servidor
+	entry, err := detallesEntrada(httpClient, entryID)
+
+	// Título de la pantalla
+	fmt.Printf("# Campos personalizados y URLs de [%s]\n", entry.Title)
+
+	// Mensaje de confirmación de acción en caso de existir
+	if showSuccess != "" {
+		color.HiGreen("\n* %s\n", showSuccess)
+	}
+
+	fmt.Printf("\n--------------------------------\n")
+	if err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiUserMainMenu("No se han podido obtener detalles de la cuenta elegida.", "")
+		}
+	}
+	imprimirExtras(entry, mostrarOcultos)
+	fmt.Printf("\n--------------------------------\n\n")
+
+	// Opciones
+	fmt.Println("1. Añadir o modificar campo")
+	fmt.Println("2. Eliminar campo")
+	fmt.Println("3. Añadir URL")
+	fmt.Println("4. Eliminar URL")
+	if mostrarOcultos {
+		fmt.Println("5. Ocultar campos ocultos")
+	} else {
+		fmt.Println("5. Mostrar campos ocultos")
+	}
+	fmt.Println("0. Volver")
+
+	// Mensaje de error en caso de existir
+	if showError != "" {
+		color.HiRed("\n* %s", showError)
+	}
+
+	// Lectura de opción elegida
+	fmt.Printf("\nSeleccione una opción: ")
+	inputSelectionStr := utils.CustomScanf()
+
+	var success string
+	switch {
+	case inputSelectionStr == "1":
+		var campo model.CampoPersonalizado
+		fmt.Print("Nombre del campo: ")
+		campo.Nombre = utils.CustomScanf()
+		fmt.Print("Valor: ")
+		campo.Valor = utils.CustomScanf()
+		for {
+			fmt.Printf("Tipo (%s): ", strings.Join(model.TiposCampoPersonalizado, ", "))
+			campo.Tipo = utils.CustomScanf()
+			if campo.Tipo == "" {
+				campo.Tipo = "text"
+			}
+			if tipoCampoValido(campo.Tipo) {
+				break
+			}
+		}
+		fmt.Print("¿Ocultar el valor? (si, no): ")
+		inputHidden := utils.CustomScanf()
+		campo.Oculto = inputHidden == "si" || inputHidden == "s"
+		if campo.Nombre == "" {
+			uiEntryExtras("El nombre del campo no puede estar vacío.", "", entryID, mostrarOcultos)
+		}
+		setCampoPersonalizado(&entry, campo)
+		success = "Campo [" + campo.Nombre + "] guardado correctamente"
+	case inputSelectionStr == "2":
+		fmt.Print("Nombre del campo: ")
+		inputName := utils.CustomScanf()
+		if !eliminarCampoPersonalizado(&entry, inputName) {
+			uiEntryExtras("No existe ningún campo con ese nombre.", "", entryID, mostrarOcultos)
+		}
+		success = "Campo [" + inputName + "] eliminado correctamente"
+	case inputSelectionStr == "3":
+		fmt.Print("URL: ")
+		inputURL := utils.CustomScanf()
+		if inputURL == "" {
+			uiEntryExtras("La URL no puede estar vacía.", "", entryID, mostrarOcultos)
+		}
+		entry.URLs = append(entry.URLs, inputURL)
+		success = "URL añadida correctamente"
+	case inputSelectionStr == "4":
+		fmt.Print("URL: ")
+		inputURL := utils.CustomScanf()
+		if !eliminarURL(&entry, inputURL) {
+			uiEntryExtras("La entrada no tiene esa URL.", "", entryID, mostrarOcultos)
+		}
+		success = "URL eliminada correctamente"
+	case inputSelectionStr == "5":
+		uiEntryExtras("", "", entryID, !mostrarOcultos)
+	case inputSelectionStr == "0":
+		uiDetailsEntry("", entryID)
+	default:
+		uiEntryExtras("La opción elegida no es correcta", "", entryID, mostrarOcultos)
+	}
+
+	// Petición al servidor para guardar los cambios
+	if errEdit := editarEntrada(httpClient, entryID, entry); errEdit != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch errEdit.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		default:
+			uiEntryExtras("No se han podido guardar los cambios.", "", entryID, mostrarOcultos)
+		}
+	} else {
+		uiEntryExtras("", success, entryID, mostrarOcultos)
+	}
+}
+
+// imprimirExtras muestra los campos personalizados y las URLs de una entrada
+func imprimirExtras(entry model.VaultEntry, mostrarOcultos bool) {
+	if len(entry.CustomFields) != 0 {
+		fmt.Printf("\n")
+		for _, campo := range entry.CustomFields {
+			valor := campo.Valor
+			if campo.Oculto && !mostrarOcultos {
+				valor = "********"
+			}
+			fmt.Printf("[%s] (%s) -> %s \n", campo.Nombre, campo.Tipo, valor)
+		}
+	}
+	if len(entry.URLs) != 0 {
+		fmt.Printf("\n")
+		for _, url := range entry.URLs {
+			fmt.Printf("[URL] -> %s \n", url)
+		}
+	}
+}
+
+// Pantalla de visualización de detalles de un usuario
+func uiUserConfiguration(showError string) {
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Título de la pantalla
+	fmt.Printf("# Página de configuración de usuario\n\n")
+
+	// Petición al servidor
+	fmt.Printf("------ Información de la cuenta ------\n\n")
+	userDetails, err := detallesUsuario(httpClient)
+	if err != nil {
 		// Si hay un error, mostramos el mensaje de error adecuado
 		switch err.Error() {
 		case "unauthorized":
@@ -548,6 +2147,8 @@ func uiUserConfiguration(showError string) {
 			boldRed := color.New(color.FgWhite, color.BgHiRed, color.Bold)
 			boldRed.Println(" Desactivado ")
 		}
+		fmt.Printf("Idioma de las notificaciones: ")
+		boldBlue.Println(nombreIdioma(userDetails.Idioma))
 	}
 	fmt.Printf("\n------------------------------------\n\n")
 
@@ -559,6 +2160,8 @@ func uiUserConfiguration(showError string) {
 	} else {
 		fmt.Println("3. Activar 2FA")
 	}
+	fmt.Println("4. Actividad reciente")
+	fmt.Println("5. Cambiar idioma de las notificaciones")
 	fmt.Println("0. Volver")
 
 	// Mensaje de error en caso de existir
@@ -611,9 +2214,186 @@ func uiUserConfiguration(showError string) {
 		} else {
 			uiUserConfiguration("")
 		}
+	case inputSelectionStr == "4":
+		uiUserActivity("", 1)
+	case inputSelectionStr == "5":
+		// Mostramos los idiomas disponibles
+		fmt.Println()
+		for i, idioma := range utils.SupportedLanguages {
+			fmt.Printf("  %d. %s\n", i+1, nombreIdioma(idioma))
+		}
+		fmt.Print("Idioma: ")
+		inputIdioma, errIdioma := strconv.Atoi(utils.CustomScanf())
+		if errIdioma != nil || inputIdioma < 1 || inputIdioma > len(utils.SupportedLanguages) {
+			uiUserConfiguration("La opción elegida no es correcta")
+		} else if errUpdate := updateIdioma(httpClient, utils.SupportedLanguages[inputIdioma-1]); errUpdate != nil {
+			// Si hay un error, mostramos el mensaje de error adecuado
+			switch errUpdate.Error() {
+			case "unauthorized":
+				uiLoginUser("La sesión de usuario ha cadudado.")
+			case "user not found":
+				uiLoginUser("No se ha podido obtener la configuración.")
+			default:
+				uiUserConfiguration("No se ha podido cambiar el idioma.")
+			}
+		} else {
+			uiUserConfiguration("")
+		}
 	case inputSelectionStr == "0":
 		uiUserMainMenu("", "")
 	default:
 		uiUserConfiguration("La opción elegida no es correcta")
 	}
 }
+
+// Pantalla del historial de actividad de la cuenta
+func uiUserActivity(showError string, pagina int) {
+
+	// Limpiamos la pantalla
+	utils.ClearScreen()
+
+	// Título de la pantalla
+	fmt.Printf("# Actividad reciente\n\n")
+
+	// Petición al servidor
+	fmt.Printf("------ Eventos de la cuenta ------\n\n")
+	page, err := actividadUsuario(httpClient, pagina)
+
+	// El servidor solo conoce el identificador de las entradas, buscamos sus títulos
+	titulos := make(map[string]string)
+	if entradas, errList := listarEntradas(httpClient); errList == nil {
+		for _, entrada := range entradas {
+			titulos[entrada.ID] = entrada.Titulo
+		}
+	}
+	if err != nil {
+		// Si hay un error, mostramos el mensaje de error adecuado
+		switch err.Error() {
+		case "unauthorized":
+			uiLoginUser("La sesión de usuario ha cadudado.")
+		case "user not found":
+			uiLoginUser("No se ha podido obtener la información del usuario.")
+		default:
+			uiUserConfiguration("No se ha podido recuperar la actividad de la cuenta.")
+		}
+	} else if len(page.Eventos) == 0 {
+		boldBlue := color.New(color.FgHiBlue, color.Bold)
+		boldBlue.Printf("* No hay actividad registrada\n")
+	} else {
+		// Mostramos los eventos, del más reciente al más antiguo
+		boldBlue := color.New(color.FgHiBlue, color.Bold)
+		for _, evento := range page.Eventos {
+			boldBlue.Printf(" %s ", evento.Fecha.Local().Format("2006-01-02 15:04:05"))
+			fmt.Printf("%s (IP %s)\n", descripcionEvento(evento, titulos), evento.IP)
+		}
+		fmt.Printf("\nPágina %d de %d\n", page.Pagina, page.TotalPaginas)
+	}
+	fmt.Printf("\n----------------------------------\n\n")
+
+	// Opciones
+	if page.Pagina < page.TotalPaginas {
+		fmt.Println("1. Eventos anteriores")
+	}
+	if pagina > 1 {
+		fmt.Println("2. Eventos más recientes")
+	}
+	fmt.Println("0. Volver")
+
+	// Mensaje de error en caso de existir
+	if showError != "" {
+		color.HiRed("\n* %s", showError)
+	}
+
+	// Lectura de opción elegida
+	fmt.Printf("\nSeleccione una opción: ")
+	inputSelectionStr := utils.CustomScanf()
+
+	switch {
+	case inputSelectionStr == "1" && page.Pagina < page.TotalPaginas:
+		uiUserActivity("", pagina+1)
+	case inputSelectionStr == "2" && pagina > 1:
+		uiUserActivity("", pagina-1)
+	case inputSelectionStr == "0":
+		uiUserConfiguration("")
+	default:
+		uiUserActivity("La opción elegida no es correcta", pagina)
+	}
+}
+
+// nombreIdioma devuelve el nombre que se muestra al usuario de un idioma
+func nombreIdioma(idioma string) string {
+	var result string
+	switch idioma {
+	case "es":
+		result = "Español"
+	case "en":
+		result = "English"
+	default:
+		result = idioma
+	}
+	return result
+}
+
+// descripcionEvento devuelve el texto que se muestra al usuario para un evento,
+// con el título de la entrada afectada si todavía existe
+func descripcionEvento(evento model.EventoActividad, titulos map[string]string) string {
+	var result string
+	entrada := evento.Detalles["entry"]
+	if titulo, ok := titulos[entrada]; ok {
+		entrada = titulo
+	}
+	switch evento.Evento {
+	case utils.AuditRegister:
+		result = "Creación de la cuenta"
+	case utils.AuditLogin:
+		result = "Inicio de sesión"
+	case utils.AuditLoginFailed:
+		result = "Intento de inicio de sesión fallido"
+		if intentos := evento.Detalles["attempts"]; intentos != "" {
+			result = "Intentos de inicio de sesión fallidos: " + intentos + " seguidos (fecha e IP del último)"
+		}
+	case utils.AuditA2FResolved:
+		result = "Verificación en dos pasos correcta"
+	case utils.AuditA2FFailed:
+		result = "Verificación en dos pasos fallida"
+	case utils.AuditA2FEnabled:
+		result = "Configuración: 2FA activado"
+	case utils.AuditA2FDisabled:
+		result = "Configuración: 2FA desactivado"
+	case utils.AuditLanguageChanged:
+		result = "Configuración: idioma cambiado a " + nombreIdioma(evento.Detalles["language"])
+	case utils.AuditEntryCreated:
+		result = "Entrada creada [" + entrada + "]"
+	case utils.AuditEntryRead:
+		result = "Entrada consultada [" + entrada + "]"
+	case utils.AuditEntryDeleted:
+		result = "Entrada enviada a la papelera [" + entrada + "]"
+	case utils.AuditEntryUpdated:
+		result = "Entrada modificada [" + entrada + "]"
+	case utils.AuditVaultRead:
+		result = "Lectura de todas las entradas (búsqueda)"
+	case utils.AuditEntryRestored:
+		result = "Entrada restaurada a una versión anterior [" + entrada + "]"
+	case utils.AuditTrashRestored:
+		result = "Entrada recuperada de la papelera [" + entrada + "]"
+	case utils.AuditTrashEmptied:
+		result = "Papelera vaciada (" + evento.Detalles["entries"] + " entradas)"
+	case utils.AuditTrashPurged:
+		result = "Borrado automático de la papelera (" + evento.Detalles["entries"] + " entradas)"
+	case utils.AuditAttachmentAdded:
+		result = "Fichero adjuntado [" + entrada + "]"
+	case utils.AuditAttachmentRead:
+		result = "Fichero adjunto descargado [" + entrada + "]"
+	case utils.AuditAttachmentDeleted:
+		result = "Fichero adjunto eliminado [" + entrada + "]"
+	case utils.AuditExpiryDigest:
+		result = "Aviso por correo de entradas a punto de caducar (" + evento.Detalles["entries"] + " entradas)"
+	case utils.AuditNewDevice:
+		result = "Inicio de sesión desde un dispositivo nuevo [" + evento.Detalles["device"] + "]"
+	case utils.AuditRevoked:
+		result = "Cierre de todas las sesiones desde el enlace del aviso"
+	default:
+		result = evento.Evento
+	}
+	return result
+}
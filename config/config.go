@@ -16,6 +16,86 @@ var MaxTimeSession = 60 * 30
 // el reto de segundo factor de autenticación (segundos)
 var MaxA2FTime = 60 * 5
 
+// MaxUserActivity es el número máximo de eventos que se guardan
+// en el historial de actividad de cada usuario
+var MaxUserActivity = 200
+
+// MaxEntryRevisions es el número de versiones anteriores que se
+// guardan de cada entrada (las más antiguas se descartan)
+var MaxEntryRevisions = 10
+
+// TrashRetentionDays es el número de días que se guardan las entradas
+// eliminadas en la papelera antes de borrarlas definitivamente
+var TrashRetentionDays = 30
+
+// TrashPurgeInterval es cada cuánto tiempo (segundos) se borran las
+// entradas de la papelera que han superado TrashRetentionDays
+var TrashPurgeInterval = 60 * 60
+
+// ExpiryWarningDays es con cuántos días de antelación se avisa de que una
+// entrada va a caducar (en el menú principal y en el correo de avisos)
+var ExpiryWarningDays = 14
+
+// ExpiryDigestInterval es el tiempo mínimo (segundos) entre dos correos de
+// avisos de caducidad al mismo usuario
+var ExpiryDigestInterval = 60 * 60 * 24
+
+// ExpiryDigestCheckInterval es cada cuánto tiempo (segundos) se comprueba
+// si hay que enviar el correo de avisos de caducidad a algún usuario
+var ExpiryDigestCheckInterval = 60 * 60
+
+// HealthMinPasswordLength es la longitud mínima para que el informe de
+// salud no marque una contraseña como demasiado corta
+var HealthMinPasswordLength = 12
+
+// HealthMaxPasswordAgeDays es el número de días sin cambiar una contraseña
+// a partir del cual el informe de salud la marca como antigua
+var HealthMaxPasswordAgeDays = 365
+
+// PwnedPasswordsFile es la lista local de contraseñas filtradas (formato
+// Pwned Passwords de HIBP, SHA-1 ordenados por hash) con la que el cliente
+// comprueba las contraseñas. Si no existe, pregunta al servidor por rangos
+var PwnedPasswordsFile = "./pwned-passwords.txt"
+
+// PwnedPasswordsServerFile es la lista con la que el servidor responde a las
+// consultas por rango de los clientes (solo reciben el inicio del hash)
+var PwnedPasswordsServerFile = "./server/pwned/pwned-passwords.txt"
+
+// PasswordRulesFile son las reglas de contraseña compartidas por dominio
+// (JSON: dominio -> utils.PasswordRules) que el cliente aplica a las entradas
+// sin reglas propias cuyas URLs son de ese dominio o de sus subdominios
+var PasswordRulesFile = "./password-rules.json"
+
+// AttachmentsDir es la carpeta donde se guarda el contenido de los
+// adjuntos, fuera de la base de datos (un directorio por usuario)
+var AttachmentsDir = "./server/attachments/"
+
+// AttachmentQuota es el espacio máximo (bytes) de adjuntos por usuario
+var AttachmentQuota int64 = 100 * 1024 * 1024
+
+// AttachmentChunkSize es el tamaño máximo (bytes) de cada parte en la que se
+// sube un adjunto (el cliente cifra cada parte por separado)
+var AttachmentChunkSize = 1024 * 1024
+
+// BackupDir es la carpeta de las copias de seguridad de la base de datos
+// (con el mismo cifrado que el fichero de la base de datos)
+var BackupDir = "./server/backups/"
+
+// BackupInterval es cada cuánto tiempo (segundos) el servidor hace una copia
+// de seguridad de la base de datos mientras está en marcha
+var BackupInterval = 60 * 60 * 6
+
+// BackupKeepLast es el número de copias de seguridad más recientes que se
+// conservan siempre
+var BackupKeepLast = 10
+
+// BackupKeepDays es el número de días de los que se conserva, además, la
+// última copia de seguridad de cada día
+var BackupKeepDays = 30
+
+// ActivityPageSize es el número de eventos por página del historial de actividad
+var ActivityPageSize = 10
+
 // SizeA2FCode es el número de digitos que contendrá la clave
 // que se envía al los usuario con A2F activado
 var SizeA2FCode = 6
@@ -26,15 +106,64 @@ var PassDBEncrypt = []byte("a very very very very secret key")
 // Account2FA contiene los datos de la cuenta de correo
 // encargada de enviar los códigos de inicio de sesión
 var Account2FA = map[string]string{
-	"email":      "",
-	"passw":      "",
-	"smtpServer": "smtp.gmail.com",
-	"smtpPort":   "587",
+	"email":        "",
+	"passw":        "",
+	"smtpServer":   "smtp.gmail.com",
+	"smtpPort":     "587",
+	"smtpSecurity": "starttls", // "starttls", "tls" (TLS implícito) o "none"
+}
+
+// EmailNotifier indica cómo se entregan los correos: "smtp", "file"
+// (ficheros .eml en EmailDropDir) o "console" (salida estándar)
+var EmailNotifier = "smtp"
+
+// EmailDropDir es la carpeta donde se dejan los correos con EmailNotifier = "file"
+var EmailDropDir = "./server/maildrop/"
+
+// OutboxDir es la carpeta de la bandeja de salida de correos pendientes
+var OutboxDir = "./server/outbox/"
+
+// OutboxMaxAttempts es el número de intentos de envío de un correo antes de descartarlo
+var OutboxMaxAttempts = 8
+
+// OutboxRetryBase es la espera (segundos) antes del primer reintento,
+// que se duplica en cada intento fallido
+var OutboxRetryBase = 30
+
+// NotificationRules indica qué eventos de seguridad (y avisos) se notifican por
+// correo al propietario de la cuenta
+var NotificationRules = map[string]bool{
+	"new_device_login": true,
+	"2fa_enabled":      true,
+	"2fa_disabled":     true,
+	"account_deleted":  true,
+	"expiry_digest":    true,
 }
 
+// RevokeLinkTime es el tiempo de validez (segundos) del enlace "no he sido yo"
+// que se incluye en el aviso de inicio de sesión desde un dispositivo nuevo
+var RevokeLinkTime = 60 * 60 * 24 * 7
+
+// PublicURL es la dirección con la que los usuarios llegan al servidor desde
+// su navegador, sin "/" al final. Con ella se construyen los enlaces de los
+// correos ("no he sido yo"), por lo que hay que cambiarla al desplegarlo
+var PublicURL = "https://127.0.0.1:10443"
+
+// MaxUserDevices es el número máximo de dispositivos conocidos que se
+// recuerdan por usuario (se olvidan primero los de acceso más antiguo)
+var MaxUserDevices = 20
+
+// DefaultLanguage es el idioma de los correos cuando el usuario no ha elegido uno
+var DefaultLanguage = "es"
+
+// EmailTemplatesDir es la carpeta donde el operador puede sustituir las
+// plantillas de correo incluidas ("es/2fa_code.txt", "layout.html", "branding.json"...)
+var EmailTemplatesDir = "./templates/email/"
+
 // EmailDebug permite comprobar las funcionalidades que
 // hacen uso de correos electrónicos sin realizar el envío.
-// Una vez puesto a "true", los correos se mostrarán por la salida estandar.
+// Una vez puesto a "true", los correos se mostrarán por la salida estandar
+// (equivale a EmailNotifier = "console").
 var EmailDebug = true
 
 // EncryptLogs se encarga de indicar si se desea cifrar el log del servidor
@@ -42,3 +171,23 @@ var EncryptLogs = true
 
 // PassEncryptLogs Clave de cifrado de los ficheros de logs
 var PassEncryptLogs = []byte("a really difficult logg password")
+
+// LogLevel es el nivel mínimo de los mensajes que se guardan
+// en el log ("DEBUG", "INFO", "WARN" o "ERROR")
+var LogLevel = "INFO"
+
+// LogMaxSize es el tamaño máximo (bytes) de un fichero de log,
+// al superarlo se rota y se continúa en uno nuevo
+var LogMaxSize int64 = 10 * 1024 * 1024
+
+// LogMaxFiles es el número máximo de ficheros de log que se conservan
+var LogMaxFiles = 60
+
+// LogMaxAgeDays es el número de días que se conservan los ficheros de log
+var LogMaxAgeDays = 90
+
+// AuditDir es la carpeta del log de auditoría (eventos de seguridad)
+var AuditDir = "./server/audit/"
+
+// PassAudit es la clave con la que se encadenan (HMAC) los registros de auditoría
+var PassAudit = []byte("an audit chain key nobody knows!")
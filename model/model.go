@@ -8,16 +8,75 @@ type Usuario struct {
 	UserPassword     string
 	UserPasswordSalt string
 	A2FEnabled       bool
-	Vault            map[string]VaultEntry
+	Idioma           string
+	Vault            map[string]VaultEntry // Por identificador (o título en las entradas antiguas)
+	Actividad        []EventoActividad
+	Dispositivos     []Dispositivo
+	Revocaciones     map[string]time.Time
+	Carpetas         map[string]Carpeta          `json:",omitempty"`
+	Etiquetas        map[string]Etiqueta         `json:",omitempty"`
+	Revisiones       map[string][]Revision       `json:",omitempty"` // Por identificador de entrada
+	Papelera         map[string]EntradaEliminada `json:",omitempty"` // Por identificador de entrada
+	Adjuntos         map[string]Adjunto          `json:",omitempty"` // Por identificador de adjunto
+	ResumenCaducidad time.Time                   // Último correo con las entradas a punto de caducar
 }
 
 type VaultEntry struct {
 	Mode int
 	// Mode 0 - Plain text
-	Text string
+	Text string `json:",omitempty"`
 	// Mode 1 - Account
-	User     string
-	Password string
+	User     string `json:",omitempty"`
+	Password string `json:",omitempty"`
+
+	// Entradas con tipo (ver TiposEntrada), sustituyen a "Mode".
+	// El servidor guarda los campos sin interpretarlos
+	Type   string            `json:",omitempty"`
+	Fields map[string]string `json:",omitempty"`
+
+	// Versión 2: la entrada se guarda con un identificador aleatorio y el
+	// cliente cifra todo su contenido, incluidos el título y el tipo
+	Version int    `json:",omitempty"`
+	Title   string `json:",omitempty"`
+
+	// Carpeta y etiquetas de la entrada (identificadores)
+	Folder string   `json:",omitempty"`
+	Tags   []string `json:",omitempty"`
+
+	// Campos añadidos por el usuario (en orden) y direcciones asociadas,
+	// el cliente los cifra igual que los campos del tipo
+	CustomFields []CampoPersonalizado `json:",omitempty"`
+	URLs         []string             `json:",omitempty"`
+
+	// Caducidad: fecha límite (AAAA-MM-DD) y/o cada cuántos días hay que
+	// renovar la contraseña desde la última renovación. El cliente los cifra
+	Expires      string `json:",omitempty"`
+	RotationDays string `json:",omitempty"`
+	Renewed      string `json:",omitempty"`
+
+	// Reglas que el sistema impone a la contraseña (utils.PasswordRules en
+	// JSON), para que se respeten al generarla. El cliente las cifra
+	Rules string `json:",omitempty"`
+
+	// Aviso que el usuario decide compartir en claro para recibir por correo
+	// las entradas a punto de caducar (no contiene nada de la entrada)
+	Reminder *Recordatorio `json:",omitempty"`
+}
+
+// Recordatorio es lo único que el servidor sabe de la caducidad de una
+// entrada: el nombre que el usuario ha elegido mostrar y cuándo vence
+type Recordatorio struct {
+	Nombre string
+	Vence  time.Time
+}
+
+// CampoPersonalizado es un campo extra de una entrada (URL de acceso,
+// preguntas de seguridad, PIN, claves de API, etc)
+type CampoPersonalizado struct {
+	Nombre string
+	Valor  string
+	Tipo   string // Ver TiposCampoPersonalizado
+	Oculto bool   // No se muestra salvo que se pida expresamente
 }
 
 /* Demo estructura en json (sin cifrados)
@@ -33,11 +92,72 @@ type VaultEntry struct {
                "Mode": "1",
                "User": "usuarioTwitter",
                "Password": "54321"
+           },
+           "visa": {
+               "Mode": "0",
+               "Type": "card",
+               "Fields": {"holder": "...", "number": "...", "expiry": "...", "cvv": "..."}
            }
        }
    }
 */
 
+// Revision es una versión anterior (cifrada) de una entrada, que se guarda
+// cada vez que la entrada se modifica o se elimina
+type Revision struct {
+	Fecha   time.Time
+	Entrada VaultEntry
+}
+
+// EntradaEliminada es una entrada en la papelera, de la que se puede
+// recuperar hasta que se vacía o pasan config.TrashRetentionDays días
+type EntradaEliminada struct {
+	Fecha   time.Time
+	Entrada VaultEntry
+}
+
+// Adjunto es un fichero asociado a una entrada. El contenido (cifrado por
+// el cliente) se guarda fuera de la base de datos, en config.AttachmentsDir
+type Adjunto struct {
+	Entrada string // Identificador de la entrada
+	Nombre  string // Cifrado por el cliente
+	Tamano  int64  // Tamaño del fichero cifrado, reservado en la cuota al crearlo
+	Subido  int64  // Bytes recibidos hasta ahora (se sube por partes)
+	Fecha   time.Time
+}
+
+// Completo indica si ya se ha recibido todo el contenido del adjunto
+func (a Adjunto) Completo() bool {
+	return a.Subido == a.Tamano
+}
+
+// Carpeta sirve para organizar las entradas, puede estar dentro de otra.
+// El nombre lo cifra el cliente
+type Carpeta struct {
+	Nombre string
+	Padre  string `json:",omitempty"`
+}
+
+// Etiqueta se puede asignar a varias entradas. El nombre lo cifra el cliente
+type Etiqueta struct {
+	Nombre string
+}
+
+// EventoActividad es cada uno de los eventos del historial del usuario
+type EventoActividad struct {
+	Fecha    time.Time
+	Evento   string
+	IP       string
+	Detalles map[string]string `json:",omitempty"`
+}
+
+// Dispositivo es cada combinación de IP y cliente desde la que el usuario ha iniciado sesión
+type Dispositivo struct {
+	IP           string
+	UserAgent    string
+	UltimoAcceso time.Time
+}
+
 /* -------------------------------- */
 
 /*  ----- USUARIO ACTIVO ----- */
@@ -58,11 +178,41 @@ type DetallesUsuario struct {
 	Email      string
 	A2FEnabled bool
 	NumEntries int
+	Idioma     string
 }
 
 type ListaEntradas struct {
 	Texts    []string
 	Accounts []string
+	// Resumen (cifrado) de todas las entradas por identificador
+	Entradas map[string]ResumenEntrada
+}
+
+// ResumenEntrada es lo necesario para mostrar una entrada en el listado
+type ResumenEntrada struct {
+	Version int      `json:",omitempty"`
+	Title   string   `json:",omitempty"`
+	Type    string   `json:",omitempty"`
+	Mode    int      `json:",omitempty"`
+	Folder  string   `json:",omitempty"`
+	Tags    []string `json:",omitempty"`
+
+	// Caducidad (cifrada por el cliente) para avisar de las entradas caducadas
+	Expires      string `json:",omitempty"`
+	RotationDays string `json:",omitempty"`
+	Renewed      string `json:",omitempty"`
+}
+
+// Organizacion contiene las carpetas y etiquetas del usuario
+type Organizacion struct {
+	Carpetas  map[string]Carpeta
+	Etiquetas map[string]Etiqueta
+}
+
+type PaginaActividad struct {
+	Eventos      []EventoActividad
+	Pagina       int
+	TotalPaginas int
 }
 
 /* ----------------------- */
@@ -0,0 +1,110 @@
+package model
+
+// Tipos de entrada conocidos por el cliente
+const (
+	TipoTexto     = "text"
+	TipoCuenta    = "account"
+	TipoTarjeta   = "card"
+	TipoIdentidad = "identity"
+	TipoSSH       = "ssh"
+	TipoWifi      = "wifi"
+)
+
+// TiposCampoPersonalizado son los tipos de campo personalizado
+// que se pueden elegir (solo cambian cómo se muestran)
+var TiposCampoPersonalizado = []string{"text", "password", "pin", "email", "question", "apikey"}
+
+// CampoEntrada describe uno de los campos de un tipo de entrada
+type CampoEntrada struct {
+	Nombre     string // Clave con la que se guarda en VaultEntry.Fields
+	Etiqueta   string // Texto que se muestra al usuario
+	Cifrado    bool   // Valor secreto, el único que se cifraba antes de la versión 2
+	Multilinea bool   // Se lee hasta encontrar una línea vacía
+	Buscable   bool   // Se tiene en cuenta en las búsquedas
+	Opcional   bool   // Se puede dejar vacío
+	OTP        bool   // URI otpauth:// de la que el cliente calcula los códigos 2FA
+	Contrasena bool   // Se revisa en el informe de salud de contraseñas
+}
+
+// TipoEntrada es el esquema de un tipo de entrada
+type TipoEntrada struct {
+	ID     string
+	Nombre string
+	Campos []CampoEntrada
+}
+
+// TiposEntrada contiene los esquemas de los tipos de entrada, en el
+// orden en el que se muestran. El servidor no los necesita: guarda
+// cualquier tipo (incluso los que todavía no existen) tal y como llega
+var TiposEntrada = []TipoEntrada{
+	{ID: TipoCuenta, Nombre: "Cuentas de usuario", Campos: []CampoEntrada{
+		{Nombre: "user", Etiqueta: "Usuario", Buscable: true},
+		{Nombre: "password", Etiqueta: "Contraseña", Cifrado: true, Contrasena: true},
+		{Nombre: "otp", Etiqueta: "Verificación en dos pasos (URI otpauth://)", Cifrado: true, Opcional: true, OTP: true},
+	}},
+	{ID: TipoTexto, Nombre: "Notas seguras", Campos: []CampoEntrada{
+		{Nombre: "text", Etiqueta: "Texto", Cifrado: true, Multilinea: true, Buscable: true},
+	}},
+	{ID: TipoTarjeta, Nombre: "Tarjetas de pago", Campos: []CampoEntrada{
+		{Nombre: "holder", Etiqueta: "Titular", Cifrado: true},
+		{Nombre: "number", Etiqueta: "Número", Cifrado: true},
+		{Nombre: "expiry", Etiqueta: "Caducidad (MM/AA)", Cifrado: true},
+		{Nombre: "cvv", Etiqueta: "CVV", Cifrado: true},
+		{Nombre: "pin", Etiqueta: "PIN", Cifrado: true},
+	}},
+	{ID: TipoIdentidad, Nombre: "Documentos de identidad", Campos: []CampoEntrada{
+		{Nombre: "docType", Etiqueta: "Tipo de documento (DNI, pasaporte, etc)"},
+		{Nombre: "number", Etiqueta: "Número", Cifrado: true},
+		{Nombre: "fullName", Etiqueta: "Nombre completo", Cifrado: true},
+		{Nombre: "birthDate", Etiqueta: "Fecha de nacimiento", Cifrado: true},
+		{Nombre: "expiry", Etiqueta: "Caducidad", Cifrado: true},
+		{Nombre: "country", Etiqueta: "País de expedición"},
+	}},
+	{ID: TipoSSH, Nombre: "Claves SSH", Campos: []CampoEntrada{
+		{Nombre: "publicKey", Etiqueta: "Clave pública", Multilinea: true},
+		{Nombre: "privateKey", Etiqueta: "Clave privada", Cifrado: true, Multilinea: true},
+		{Nombre: "passphrase", Etiqueta: "Frase de paso", Cifrado: true, Contrasena: true},
+	}},
+	{ID: TipoWifi, Nombre: "Redes Wi-Fi", Campos: []CampoEntrada{
+		{Nombre: "ssid", Etiqueta: "Nombre de la red (SSID)", Buscable: true},
+		{Nombre: "security", Etiqueta: "Seguridad (WPA2, WPA3, etc)"},
+		{Nombre: "password", Etiqueta: "Contraseña", Cifrado: true, Contrasena: true},
+	}},
+}
+
+// BuscarTipoEntrada devuelve el esquema del tipo indicado
+func BuscarTipoEntrada(id string) (TipoEntrada, bool) {
+	for _, tipo := range TiposEntrada {
+		if tipo.ID == id {
+			return tipo, true
+		}
+	}
+	return TipoEntrada{}, false
+}
+
+// VersionEntrada es la versión con la que se guardan las nuevas entradas
+const VersionEntrada = 2
+
+// Tipo devuelve el tipo de la entrada, traduciendo el "Mode"
+// de las entradas guardadas antes de existir los tipos
+func (e VaultEntry) Tipo() string {
+	if e.Type != "" {
+		return e.Type
+	}
+	if e.Mode == 1 {
+		return TipoCuenta
+	}
+	return TipoTexto
+}
+
+// Campos devuelve los campos de la entrada, incluidas las
+// entradas antiguas (texto y cuenta) que no usan "Fields"
+func (e VaultEntry) Campos() map[string]string {
+	if e.Type != "" {
+		return e.Fields
+	}
+	if e.Mode == 1 {
+		return map[string]string{"user": e.User, "password": e.Password}
+	}
+	return map[string]string{"text": e.Text}
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/model"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// El contenido de una parte (AppendAttachment) se recibe sin bloquear la base
+// de datos (bdMutex), que no puede esperar a la red: las partes de cada
+// usuario se bloquean para que la comprobación del offset y la escritura no
+// se mezclen con otra subida en paralelo. Este bloqueo se toma siempre antes
+// que bdMutex
+var adjuntosMutex sync.Mutex
+var adjuntosUsuario = make(map[string]*sync.Mutex)
+
+// bloqueoAdjuntos devuelve el bloqueo de los adjuntos del usuario
+func bloqueoAdjuntos(email string) *sync.Mutex {
+	adjuntosMutex.Lock()
+	defer adjuntosMutex.Unlock()
+	if _, ok := adjuntosUsuario[email]; !ok {
+		adjuntosUsuario[email] = &sync.Mutex{}
+	}
+	return adjuntosUsuario[email]
+}
+
+// userAttachmentsDir devuelve el directorio de adjuntos del usuario, con un
+// nombre derivado del email para no guardarlo en claro en el disco
+func userAttachmentsDir(email string) string {
+	hash := utils.HashSha512([]byte(email))
+	return filepath.Join(config.AttachmentsDir, hex.EncodeToString(hash[:16]))
+}
+
+// AttachmentPath devuelve el fichero con el contenido de un adjunto
+func AttachmentPath(email string, attachmentID string) string {
+	return filepath.Join(userAttachmentsDir(email), attachmentID)
+}
+
+// usedQuota es el espacio ocupado (o reservado) por los adjuntos del usuario
+func usedQuota(user *model.Usuario) int64 {
+	var total int64
+	for _, adjunto := range user.Adjuntos {
+		total += adjunto.Tamano
+	}
+	return total
+}
+
+// CreateAttachment reserva el espacio de un nuevo adjunto de la entrada y
+// crea su fichero (vacío). El contenido se añade después con AppendAttachment
+func CreateAttachment(email string, entryID string, nombre string, tamano int64) (string, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var idResult string
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if entry, okEntry := user.Vault[entryID]; !okEntry || entry.Version < model.VersionEntrada {
+		// Si no existe una entrada con ese identificador (las antiguas se migran antes)
+		errResult = errors.New("entry not found")
+	} else if tamano < 0 {
+		errResult = errors.New("invalid size")
+	} else if usedQuota(user)+tamano > config.AttachmentQuota {
+		// No queda espacio suficiente para el usuario
+		errResult = errors.New("quota exceeded")
+	} else if idResult, errResult = newID(func(id string) bool {
+		_, okAttachment := user.Adjuntos[id]
+		return okAttachment
+	}); errResult == nil {
+		if errDir := os.MkdirAll(userAttachmentsDir(email), 0700); errDir != nil {
+			return "", errDir
+		}
+		if errFile := ioutil.WriteFile(AttachmentPath(email, idResult), nil, 0600); errFile != nil {
+			return "", errFile
+		}
+		if user.Adjuntos == nil {
+			user.Adjuntos = make(map[string]model.Adjunto)
+		}
+		user.Adjuntos[idResult] = model.Adjunto{Entrada: entryID, Nombre: nombre, Tamano: tamano, Fecha: time.Now()}
+	}
+
+	return idResult, errResult
+}
+
+// AppendAttachment añade una parte al contenido de un adjunto. La parte debe
+// empezar justo donde terminó la anterior (offset), así la subida se puede
+// reanudar. Devuelve los bytes recibidos hasta ahora
+func AppendAttachment(email string, attachmentID string, offset int64, parte io.Reader) (int64, error) {
+	bloqueo := bloqueoAdjuntos(email)
+	bloqueo.Lock()
+	defer bloqueo.Unlock()
+
+	bdMutex.Lock()
+	var adjunto model.Adjunto
+	var errResult error
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if adjuntoUsuario, okAttachment := user.Adjuntos[attachmentID]; !okAttachment {
+		errResult = errors.New("attachment not found")
+	} else {
+		adjunto = adjuntoUsuario
+	}
+	bdMutex.Unlock()
+
+	if errResult != nil {
+		return 0, errResult
+	} else if offset != adjunto.Subido {
+		// La parte no continúa donde terminó la anterior
+		return adjunto.Subido, errors.New("invalid offset")
+	}
+
+	fichero, errOpen := os.OpenFile(AttachmentPath(email, attachmentID), os.O_WRONLY, 0600)
+	if errOpen != nil {
+		return 0, errOpen
+	}
+	defer fichero.Close()
+
+	// Nunca se escribe más de lo reservado al crear el adjunto
+	fichero.Seek(offset, io.SeekStart)
+	n, errCopy := io.Copy(fichero, io.LimitReader(parte, adjunto.Tamano-offset+1))
+	if errCopy == nil && offset+n > adjunto.Tamano {
+		errCopy = errors.New("invalid size")
+	}
+	if errCopy != nil {
+		// Descartamos lo escrito de esta parte, se puede volver a enviar
+		fichero.Truncate(offset)
+		return offset, errCopy
+	}
+
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	// Mientras se recibía la parte se ha podido borrar el adjunto (o el usuario)
+	user, okUser := gestor[email]
+	if !okUser {
+		return 0, errors.New("user not found")
+	}
+	adjunto, okAttachment := user.Adjuntos[attachmentID]
+	if !okAttachment {
+		return 0, errors.New("attachment not found")
+	}
+	adjunto.Subido = offset + n
+	user.Adjuntos[attachmentID] = adjunto
+	return adjunto.Subido, nil
+}
+
+// ReadAttachments recupera los adjuntos de una entrada del usuario (los de
+// todas sus entradas si no se indica ninguna)
+func ReadAttachments(email string, entryID string) (map[string]model.Adjunto, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var attachmentsResult map[string]model.Adjunto
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else {
+		attachmentsResult = make(map[string]model.Adjunto)
+		for attachmentID, adjunto := range user.Adjuntos {
+			if entryID == "" || adjunto.Entrada == entryID {
+				attachmentsResult[attachmentID] = adjunto
+			}
+		}
+	}
+
+	return attachmentsResult, errResult
+}
+
+// ReadAttachment recupera los datos de un adjunto del usuario
+func ReadAttachment(email string, attachmentID string) (model.Adjunto, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var attachmentResult model.Adjunto
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if adjunto, okAttachment := user.Adjuntos[attachmentID]; !okAttachment {
+		errResult = errors.New("attachment not found")
+	} else {
+		attachmentResult = adjunto
+	}
+
+	return attachmentResult, errResult
+}
+
+// DeleteAttachment elimina un adjunto del usuario y su contenido
+func DeleteAttachment(email string, attachmentID string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if _, okAttachment := user.Adjuntos[attachmentID]; !okAttachment {
+		errResult = errors.New("attachment not found")
+	} else {
+		os.Remove(AttachmentPath(email, attachmentID))
+		delete(user.Adjuntos, attachmentID)
+	}
+
+	return errResult
+}
+
+// eliminarAdjuntosEntrada elimina los adjuntos de una entrada que se ha
+// borrado definitivamente (papelera). Se llama con bdMutex bloqueado
+func eliminarAdjuntosEntrada(email string, user *model.Usuario, entryID string) {
+	for attachmentID, adjunto := range user.Adjuntos {
+		if adjunto.Entrada == entryID {
+			os.Remove(AttachmentPath(email, attachmentID))
+			delete(user.Adjuntos, attachmentID)
+		}
+	}
+}
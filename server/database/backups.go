@@ -0,0 +1,209 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+)
+
+// Nombre de las copias de seguridad: bd-AAAAMMDD-HHMMSS.txt (con un número
+// al final si se hace más de una en el mismo segundo)
+const (
+	prefijoCopia = "bd-"
+	formatoCopia = "20060102-150405"
+)
+
+// BackupInfo describe una copia de seguridad de la base de datos
+type BackupInfo struct {
+	Fichero string
+	Fecha   time.Time
+	Tamano  int64
+}
+
+// Backup guarda una copia de la base de datos en config.BackupDir, con el
+// mismo cifrado que el fichero de la base de datos (guardarCopia)
+func Backup() (BackupInfo, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	return copiarBD()
+}
+
+// copiarBD guarda una copia de la base de datos (con bdMutex bloqueado)
+func copiarBD() (BackupInfo, error) {
+	if errorCarga != nil {
+		// No se ha leído la base de datos: se copiaría vacía
+		return BackupInfo{}, errorCarga
+	}
+	contenido, err := serializar(gestor)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	return guardarCopia(contenido)
+}
+
+// guardarCopia guarda el contenido de un fichero de la base de datos como una
+// nueva copia de seguridad. La copia se vuelve a leer después de escribirla
+// para comprobar que es idéntica y se puede descifrar; después se borran las
+// copias que ya no hay que conservar (pruneBackups)
+func guardarCopia(contenido []byte) (BackupInfo, error) {
+	if err := os.MkdirAll(config.BackupDir, 0700); err != nil {
+		return BackupInfo{}, err
+	}
+
+	fecha := time.Now()
+	nombre := prefijoCopia + fecha.Format(formatoCopia)
+	fichero := filepath.Join(config.BackupDir, nombre+".txt")
+	for n := 2; ; n++ {
+		if _, errStat := os.Stat(fichero); os.IsNotExist(errStat) {
+			break
+		}
+		fichero = filepath.Join(config.BackupDir, nombre+"-"+strconv.Itoa(n)+".txt")
+	}
+	if err := escribirFichero(fichero, contenido); err != nil {
+		return BackupInfo{}, err
+	}
+
+	// Verificación de la copia
+	leido, err := ioutil.ReadFile(fichero)
+	if err == nil && !bytes.Equal(leido, contenido) {
+		err = errors.New("backup verification failed")
+	}
+	if err == nil {
+		if _, _, errCopia := decodificar(leido); errCopia != nil {
+			err = errors.New("backup verification failed")
+		}
+	}
+	if err != nil {
+		os.Remove(fichero)
+		return BackupInfo{}, err
+	}
+
+	pruneBackups(time.Now())
+	return BackupInfo{Fichero: fichero, Fecha: fecha, Tamano: int64(len(contenido))}, nil
+}
+
+// ListBackups devuelve las copias de seguridad, de la más antigua a la más reciente
+func ListBackups() []BackupInfo {
+	var result []BackupInfo
+	ficheros, _ := ioutil.ReadDir(config.BackupDir)
+	for _, fichero := range ficheros {
+		nombre := fichero.Name()
+		if fichero.IsDir() || !strings.HasPrefix(nombre, prefijoCopia) || !strings.HasSuffix(nombre, ".txt") ||
+			len(nombre) < len(prefijoCopia)+len(formatoCopia) {
+			continue
+		}
+		fecha, err := time.ParseInLocation(formatoCopia, nombre[len(prefijoCopia):len(prefijoCopia)+len(formatoCopia)], time.Local)
+		if err != nil {
+			continue
+		}
+		result = append(result, BackupInfo{Fichero: filepath.Join(config.BackupDir, nombre), Fecha: fecha, Tamano: fichero.Size()})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if !result[i].Fecha.Equal(result[j].Fecha) {
+			return result[i].Fecha.Before(result[j].Fecha)
+		}
+		return len(result[i].Fichero) < len(result[j].Fichero) || (len(result[i].Fichero) == len(result[j].Fichero) && result[i].Fichero < result[j].Fichero)
+	})
+	return result
+}
+
+// pruneBackups borra las copias que no hay que conservar. Se conservan las
+// config.BackupKeepLast más recientes y, además, la última de cada uno de los
+// últimos config.BackupKeepDays días
+func pruneBackups(ahora time.Time) {
+	copias := ListBackups()
+	limite := ahora.AddDate(0, 0, -config.BackupKeepDays)
+	dias := make(map[string]bool)
+	for i := len(copias) - 1; i >= 0; i-- {
+		copia := copias[i]
+		dia := copia.Fecha.Format("2006-01-02")
+		conservar := len(copias)-i <= config.BackupKeepLast || (copia.Fecha.After(limite) && !dias[dia])
+		dias[dia] = true
+		if !conservar {
+			os.Remove(copia.Fichero)
+		}
+	}
+}
+
+// RestoreBackup sustituye la base de datos por la última copia hecha antes
+// del momento indicado (o en ese mismo momento). Antes de sustituirla se hace
+// una copia del estado actual, para poder deshacer la restauración (si el
+// fichero actual está dañado, se conserva con otro nombre). Las copias de
+// versiones anteriores del esquema quedan pendientes de migrar. Devuelve la
+// copia restaurada y dónde ha quedado el estado anterior
+func RestoreBackup(momento time.Time) (BackupInfo, BackupInfo, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var restaurada BackupInfo
+	for _, copia := range ListBackups() {
+		if !copia.Fecha.After(momento) {
+			restaurada = copia
+		}
+	}
+	if restaurada.Fichero == "" {
+		return BackupInfo{}, BackupInfo{}, errors.New("backup not found")
+	}
+	contenido, err := ioutil.ReadFile(restaurada.Fichero)
+	if err != nil {
+		return BackupInfo{}, BackupInfo{}, err
+	}
+	version, _, err := decodificar(contenido)
+	if err != nil {
+		return BackupInfo{}, BackupInfo{}, err
+	}
+	if version > SchemaVersion {
+		return BackupInfo{}, BackupInfo{}, errors.New("newer version")
+	}
+
+	var anterior BackupInfo
+	switch {
+	case errorCarga == nil:
+		anterior, err = copiarBD()
+	case pendienteMigrar != nil:
+		anterior, err = guardarCopia(contenidoCargado)
+	default:
+		anterior = BackupInfo{Fichero: ficheroBD + "." + time.Now().Format(formatoCopia), Fecha: time.Now()}
+		err = os.Rename(ficheroBD, anterior.Fichero)
+	}
+	if err != nil {
+		return BackupInfo{}, BackupInfo{}, err
+	}
+	if err := escribirFichero(ficheroBD, contenido); err != nil {
+		return BackupInfo{}, BackupInfo{}, err
+	}
+	cargar(contenido)
+	return restaurada, anterior, nil
+}
+
+// escribirFichero escribe el fichero completo o no lo modifica: se escribe en
+// un fichero temporal, se fuerza su escritura en el disco y se renombra
+func escribirFichero(fichero string, contenido []byte) error {
+	temporal := fichero + ".tmp"
+	salida, err := os.OpenFile(temporal, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = salida.Write(contenido); err == nil {
+		err = salida.Sync()
+	}
+	if errClose := salida.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(temporal, fichero)
+	}
+	if err != nil {
+		os.Remove(temporal)
+	}
+	return err
+}
@@ -2,11 +2,15 @@ package database
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/bertus193/gestorSDS/config"
 	"github.com/bertus193/gestorSDS/model"
@@ -16,32 +20,61 @@ import (
 // Base de datos de la aplicación
 var gestor = make(map[string]*model.Usuario)
 
+// bdMutex protege la base de datos: las peticiones se atienden a la vez
+// (bloqueoTareas solo las separa de las tareas periódicas), por lo que todas
+// las funciones exportadas del paquete lo bloquean antes de usar gestor
+var bdMutex sync.Mutex
+
+// ficheroBD es el fichero donde se guarda la base de datos (cifrada y comprimida)
+const ficheroBD = "./server/database/bd.txt"
+
 func init() {
 	// Leer el fichero de la base de datos
 	before()
 }
 
-// Descomprime y descifra el fichero de la base de datos
+// Descomprime y descifra el fichero de la base de datos. Si no se puede leer o
+// hay que migrarlo, la base de datos queda vacía y Ready indica el motivo
 func before() {
-	result := make(map[string]*model.Usuario)
-
-	bytesEntrada, err := ioutil.ReadFile("./server/database/bd.txt")
+	bytesEntrada, err := ioutil.ReadFile(ficheroBD)
 	error := false
 	if err != nil {
 		error = true
 	}
 	if error == true || len(string(bytesEntrada)) == 0 {
 		//fileData := []byte("{}")
-		ioutil.WriteFile("./server/database/bd.txt", []byte(""), 0644)
+		ioutil.WriteFile(ficheroBD, []byte(""), 0644)
+		gestor = make(map[string]*model.Usuario)
 	} else {
-		decompress := []byte(utils.ZLibDecompress(bytesEntrada))
-		decompress = utils.DecryptAES(decompress, config.PassDBEncrypt)
-		if err := json.Unmarshal(decompress, &result); err != nil {
-			panic("Error al leer fichero de entrada")
-		}
+		cargar(bytesEntrada)
 	}
+}
 
-	gestor = result
+// serializar convierte la base de datos al contenido del fichero (con la
+// versión actual del esquema)
+func serializar(usuarios map[string]*model.Usuario) ([]byte, error) {
+	j, err := json.Marshal(usuarios)
+	if err != nil {
+		return nil, err
+	}
+	return codificar(SchemaVersion, j), nil
+}
+
+// deserializar lee el contenido del fichero de la base de datos (o de una
+// copia), que tiene que estar en la versión actual del esquema
+func deserializar(contenido []byte) (map[string]*model.Usuario, error) {
+	version, datos, err := decodificar(contenido)
+	if err != nil {
+		return nil, err
+	}
+	if version != SchemaVersion {
+		return nil, errors.New("migration required")
+	}
+	result := make(map[string]*model.Usuario)
+	if err := json.Unmarshal(datos, &result); err != nil {
+		return nil, errors.New("invalid database")
+	}
+	return result, nil
 }
 
 // CreateUser guarda un nuevo usuario en la BD
@@ -49,17 +82,25 @@ func CreateUser(email string, passw string) error {
 
 	var errResult error
 
+	// El hash de la contraseña se calcula antes de bloquear la base de datos
+	salt, errSalt := utils.GenerateRandomBytes(64)
+	var hashPass []byte
+	if errSalt == nil {
+		hashPass, _ = utils.HashScrypt([]byte(passw), salt)
+	}
+
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
 	// Comprobamos si existe el email en la BD
 	if _, ok := gestor[email]; ok {
 		// Si existe el email, no modificamos nada
 		errResult = errors.New("user already exists")
-	} else if salt, errSalt := utils.GenerateRandomBytes(64); errSalt != nil {
+	} else if errSalt != nil {
 		// Error al generar "salt"
 		errResult = errors.New("unable to save")
 	} else {
 		// Hash de la contraseña también en servidor
-		bytePass := []byte(passw)
-		hashPass, _ := utils.HashScrypt(bytePass, salt)
 		saltBase64 := utils.EncodeBase64(salt)
 
 		// Guardamos el nuevo usuario
@@ -67,13 +108,53 @@ func CreateUser(email string, passw string) error {
 			UserPassword:     string(hashPass),
 			UserPasswordSalt: saltBase64,
 			A2FEnabled:       false,
+			Idioma:           config.DefaultLanguage,
 			Vault:            make(map[string]model.VaultEntry)}
 	}
 	return errResult
 }
 
-// ReadUser el usuario indicado a partir del email
+// copiaUsuario copia los datos del usuario, para que se puedan leer sin
+// bloquear la base de datos mientras otra petición los modifica
+func copiaUsuario(user *model.Usuario) *model.Usuario {
+	copia := *user
+	copia.Vault = make(map[string]model.VaultEntry, len(user.Vault))
+	for entryID, entry := range user.Vault {
+		copia.Vault[entryID] = entry
+	}
+	copia.Actividad = append([]model.EventoActividad(nil), user.Actividad...)
+	copia.Dispositivos = append([]model.Dispositivo(nil), user.Dispositivos...)
+	copia.Revocaciones = make(map[string]time.Time, len(user.Revocaciones))
+	for codigo, caducidad := range user.Revocaciones {
+		copia.Revocaciones[codigo] = caducidad
+	}
+	copia.Carpetas = make(map[string]model.Carpeta, len(user.Carpetas))
+	for folderID, carpeta := range user.Carpetas {
+		copia.Carpetas[folderID] = carpeta
+	}
+	copia.Etiquetas = make(map[string]model.Etiqueta, len(user.Etiquetas))
+	for tagID, etiqueta := range user.Etiquetas {
+		copia.Etiquetas[tagID] = etiqueta
+	}
+	copia.Revisiones = make(map[string][]model.Revision, len(user.Revisiones))
+	for entryID, revisiones := range user.Revisiones {
+		copia.Revisiones[entryID] = append([]model.Revision(nil), revisiones...)
+	}
+	copia.Papelera = make(map[string]model.EntradaEliminada, len(user.Papelera))
+	for entryID, eliminada := range user.Papelera {
+		copia.Papelera[entryID] = eliminada
+	}
+	copia.Adjuntos = make(map[string]model.Adjunto, len(user.Adjuntos))
+	for attachmentID, adjunto := range user.Adjuntos {
+		copia.Adjuntos[attachmentID] = adjunto
+	}
+	return &copia
+}
+
+// ReadUser recupera (una copia de) el usuario indicado a partir del email
 func ReadUser(email string) (*model.Usuario, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
 
 	var userResult *model.Usuario
 	var errResult error
@@ -82,21 +163,29 @@ func ReadUser(email string) (*model.Usuario, error) {
 		// Si no existe el el usuario indicado, no modificamos nada
 		errResult = errors.New("user not found")
 	} else {
-		userResult = user
+		userResult = copiaUsuario(user)
 	}
 
 	return userResult, errResult
 }
 
-// GetUser recupera un usuario de la BD que contenta el mismo
+// GetUser recupera (una copia de) un usuario de la BD que contenta el mismo
 // email y contraseña que las indicads
 func GetUser(email string, passw string) (*model.Usuario, error) {
 
 	var userResult *model.Usuario
 	var errResult error
 
+	// La contraseña se comprueba sobre una copia, sin bloquear la base de datos
+	bdMutex.Lock()
+	user, ok := gestor[email]
+	if ok {
+		user = copiaUsuario(user)
+	}
+	bdMutex.Unlock()
+
 	// Comprobamos si existe el email en la BD
-	if user, ok := gestor[email]; !ok {
+	if !ok {
 		// Si no existe el el usuario indicado
 		errResult = errors.New("user not found")
 	} else if salt, errSalt := base64.StdEncoding.DecodeString(user.UserPasswordSalt); errSalt != nil {
@@ -120,6 +209,9 @@ func GetUser(email string, passw string) (*model.Usuario, error) {
 
 // CreateTextVaultEntry crea una entrada de tipo texto en el usaurio
 func CreateTextVaultEntry(email string, entryTitle string, entryText string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
 	var errResult error
 
 	if user, okUser := gestor[email]; !okUser {
@@ -140,6 +232,9 @@ func CreateTextVaultEntry(email string, entryTitle string, entryText string) err
 
 // CreateAccountVaultEntry crea una entrada de tipo cuenta en el usaurio
 func CreateAccountVaultEntry(email string, entryTitle string, userAccount string, passwAccount string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
 	var errResult error
 
 	if user, okUser := gestor[email]; !okUser {
@@ -159,9 +254,204 @@ func CreateAccountVaultEntry(email string, entryTitle string, userAccount string
 	return errResult
 }
 
-// ReadVaultEntry recupera la lista de entradas (sin detalles)
-// de un usuario
-func ReadVaultEntry(email string, entryTitle string) (model.VaultEntry, error) {
+// CreateTypedVaultEntry crea una entrada de cualquier tipo en el usuario con un
+// identificador aleatorio, los campos se guardan tal y como los envía el cliente
+func CreateTypedVaultEntry(email string, entry model.VaultEntry) (string, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var idResult string
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else {
+		idResult, errResult = newID(func(id string) bool {
+			_, okEntry := user.Vault[id]
+			return okEntry
+		})
+		if errResult == nil {
+			user.Vault[idResult] = entry
+		}
+	}
+
+	return idResult, errResult
+}
+
+// newID genera un identificador aleatorio que no esté ya en uso
+func newID(exists func(string) bool) (string, error) {
+	for {
+		idRaw, errRandom := utils.GenerateRandomBytes(16)
+		if errRandom != nil {
+			return "", errRandom
+		}
+		// Evitamos (aunque es improbable) repetir un identificador
+		if id := hex.EncodeToString(idRaw); !exists(id) {
+			return id, nil
+		}
+	}
+}
+
+// UpdateVaultEntry sustituye el contenido de una entrada existente del usuario
+func UpdateVaultEntry(email string, entryID string, entry model.VaultEntry) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if _, okEntry := user.Vault[entryID]; !okEntry {
+		// Si no existe una entrada con ese identificador
+		errResult = errors.New("entry not found")
+	} else {
+		guardarRevision(user, entryID)
+		user.Vault[entryID] = entry
+	}
+
+	return errResult
+}
+
+// UpdateOTPField sustituye solo la URI otpauth:// de una entrada, sin guardar
+// una revisión: en HOTP cambia el contador cada vez que se muestra un código
+// y llenaría el historial. Solo se admiten los campos OTP de los tipos de
+// entrada que ya tenga la entrada
+func UpdateOTPField(email string, entryID string, campo string, valor string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if entry, okEntry := user.Vault[entryID]; !okEntry {
+		// Si no existe una entrada con ese identificador
+		errResult = errors.New("entry not found")
+	} else if _, okCampo := entry.Fields[campo]; !okCampo || !esCampoOTP(campo) || valor == "" {
+		errResult = errors.New("invalid fields")
+	} else {
+		// El mapa de campos puede ser el de una revisión (RestoreRevision)
+		campos := make(map[string]string, len(entry.Fields))
+		for nombre, valorCampo := range entry.Fields {
+			campos[nombre] = valorCampo
+		}
+		campos[campo] = valor
+		entry.Fields = campos
+		user.Vault[entryID] = entry
+	}
+
+	return errResult
+}
+
+// esCampoOTP indica si el campo es el de la URI otpauth:// de algún tipo de
+// entrada (el tipo va cifrado, el servidor solo conoce el nombre del campo)
+func esCampoOTP(campo string) bool {
+	for _, tipo := range model.TiposEntrada {
+		for _, campoTipo := range tipo.Campos {
+			if campoTipo.OTP && campoTipo.Nombre == campo {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// guardarRevision guarda el contenido actual de la entrada en su historial
+// antes de modificarla. Las entradas antiguas (identificadas por el título
+// en claro) no se guardan, al migrarlas el título no debe quedar en la
+// base de datos
+func guardarRevision(user *model.Usuario, entryID string) {
+	entry := user.Vault[entryID]
+	if entry.Version < model.VersionEntrada {
+		delete(user.Revisiones, entryID)
+		return
+	}
+	if user.Revisiones == nil {
+		user.Revisiones = make(map[string][]model.Revision)
+	}
+	revisiones := append(user.Revisiones[entryID], model.Revision{Fecha: time.Now(), Entrada: entry})
+	if len(revisiones) > config.MaxEntryRevisions {
+		revisiones = revisiones[len(revisiones)-config.MaxEntryRevisions:]
+	}
+	user.Revisiones[entryID] = revisiones
+}
+
+// ReadRevisions recupera las versiones anteriores de una entrada, empezando
+// por la más reciente. También las de las entradas en la papelera
+func ReadRevisions(email string, entryID string) ([]model.Revision, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var revisionsResult []model.Revision
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if _, okEntry := user.Vault[entryID]; !okEntry && !enPapelera(user, entryID) {
+		// Si no existe una entrada con ese identificador
+		errResult = errors.New("entry not found")
+	} else {
+		revisionsResult = []model.Revision{}
+		revisiones := user.Revisiones[entryID]
+		for i := len(revisiones) - 1; i >= 0; i-- {
+			revisionsResult = append(revisionsResult, revisiones[i])
+		}
+	}
+
+	return revisionsResult, errResult
+}
+
+// RestoreRevision vuelve a dejar la entrada como estaba en la versión
+// indicada (0 es la más reciente, como en ReadRevisions). La versión actual
+// se guarda antes en el historial, por lo que también se puede deshacer
+func RestoreRevision(email string, entryID string, revision int) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if _, okEntry := user.Vault[entryID]; !okEntry {
+		// Las entradas de la papelera se recuperan antes con RestoreTrashEntry
+		errResult = errors.New("entry not found")
+	} else if revisiones := user.Revisiones[entryID]; revision < 0 || revision >= len(revisiones) {
+		// Si no existe esa versión de la entrada
+		errResult = errors.New("revision not found")
+	} else {
+		entry := revisiones[len(revisiones)-1-revision].Entrada
+		guardarRevision(user, entryID)
+		user.Vault[entryID] = organizacionVigente(user, entry)
+	}
+
+	return errResult
+}
+
+// organizacionVigente quita de la entrada la carpeta y las etiquetas que se
+// han eliminado desde que se guardó (versiones anteriores, papelera)
+func organizacionVigente(user *model.Usuario, entry model.VaultEntry) model.VaultEntry {
+	if _, okFolder := user.Carpetas[entry.Folder]; !okFolder {
+		entry.Folder = ""
+	}
+	var tags []string
+	for _, tagID := range entry.Tags {
+		if _, okTag := user.Etiquetas[tagID]; okTag {
+			tags = append(tags, tagID)
+		}
+	}
+	entry.Tags = tags
+	return entry
+}
+
+// ReadVaultEntry recupera una entrada concreta del usuario
+func ReadVaultEntry(email string, entryID string) (model.VaultEntry, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
 
 	var entryResult model.VaultEntry
 	var errResult error
@@ -169,8 +459,8 @@ func ReadVaultEntry(email string, entryTitle string) (model.VaultEntry, error) {
 	if user, okUser := gestor[email]; !okUser {
 		// Si no existe el el usuario indicado, no modificamos nada
 		errResult = errors.New("user not found")
-	} else if entry, okEntry := user.Vault[entryTitle]; !okEntry {
-		// Si no existe una entrada con el mismo título
+	} else if entry, okEntry := user.Vault[entryID]; !okEntry {
+		// Si no existe una entrada con ese identificador
 		errResult = errors.New("entry not found")
 	} else {
 		entryResult = entry
@@ -179,19 +469,354 @@ func ReadVaultEntry(email string, entryTitle string) (model.VaultEntry, error) {
 	return entryResult, errResult
 }
 
-// DeleteVaultEntry eliina una entrada concreta del usuario
-func DeleteVaultEntry(email string, entryTitle string) error {
+// DeleteVaultEntry envía una entrada del usuario a la papelera, también las
+// antiguas (identificadas por el título en claro) que no se han podido migrar
+func DeleteVaultEntry(email string, entryID string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
 
 	var errResult error
 
 	if user, okUser := gestor[email]; !okUser {
 		// Si no existe el el usuario indicado, no modificamos nada
 		errResult = errors.New("user not found")
-	} else if _, okEntry := user.Vault[entryTitle]; !okEntry {
-		// Si no existe una entrada con el mismo título
+	} else if entry, okEntry := user.Vault[entryID]; !okEntry {
+		// Si no existe una entrada con ese identificador
 		errResult = errors.New("entry not found")
 	} else {
-		delete(gestor[email].Vault, entryTitle)
+		if user.Papelera == nil {
+			user.Papelera = make(map[string]model.EntradaEliminada)
+		}
+		user.Papelera[entryID] = model.EntradaEliminada{Fecha: time.Now(), Entrada: entry}
+		delete(user.Vault, entryID)
+	}
+
+	return errResult
+}
+
+// MigrateVaultEntry sustituye una entrada antigua (identificada por el título
+// en claro) por su versión actual, cifrada por el cliente, con un
+// identificador aleatorio. Se hace de una vez: si la entrada antigua ya no
+// está (otro cliente la ha migrado) no se guarda otra copia. La antigua no
+// pasa por la papelera, el título en claro no debe quedar en la base de datos
+func MigrateVaultEntry(email string, entryID string, entry model.VaultEntry) (string, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var idResult string
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if antigua, okEntry := user.Vault[entryID]; !okEntry {
+		// Si no existe una entrada con ese identificador
+		errResult = errors.New("entry not found")
+	} else if antigua.Version >= model.VersionEntrada || entry.Version < model.VersionEntrada {
+		// Solo se migran entradas antiguas, al formato actual
+		errResult = errors.New("entry not migrated")
+	} else {
+		idResult, errResult = newID(func(id string) bool {
+			_, okEntry := user.Vault[id]
+			return okEntry
+		})
+		if errResult == nil {
+			user.Vault[idResult] = organizacionVigente(user, entry)
+			delete(user.Vault, entryID)
+			delete(user.Revisiones, entryID)
+		}
+	}
+
+	return idResult, errResult
+}
+
+// enPapelera indica si la entrada está en la papelera del usuario
+func enPapelera(user *model.Usuario, entryID string) bool {
+	_, ok := user.Papelera[entryID]
+	return ok
+}
+
+// ReadTrash recupera las entradas de la papelera del usuario
+func ReadTrash(email string) (map[string]model.EntradaEliminada, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var trashResult map[string]model.EntradaEliminada
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else {
+		trashResult = make(map[string]model.EntradaEliminada)
+		for entryID, eliminada := range user.Papelera {
+			trashResult[entryID] = eliminada
+		}
+	}
+
+	return trashResult, errResult
+}
+
+// RestoreTrashEntry devuelve una entrada de la papelera a la bóveda
+func RestoreTrashEntry(email string, entryID string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if eliminada, okEntry := user.Papelera[entryID]; !okEntry {
+		// Si no hay ninguna entrada con ese identificador en la papelera
+		errResult = errors.New("entry not found")
+	} else if _, okVault := user.Vault[entryID]; okVault {
+		// Las entradas antiguas se identifican por el título, que puede
+		// haberse vuelto a usar
+		errResult = errors.New("entry already exists")
+	} else {
+		user.Vault[entryID] = organizacionVigente(user, eliminada.Entrada)
+		delete(user.Papelera, entryID)
+	}
+
+	return errResult
+}
+
+// EmptyTrash elimina definitivamente las entradas de la papelera del usuario,
+// junto con sus versiones anteriores, y devuelve cuántas había
+func EmptyTrash(email string) (int, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var countResult int
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else {
+		for entryID := range user.Papelera {
+			delete(user.Revisiones, entryID)
+			eliminarAdjuntosEntrada(email, user, entryID)
+		}
+		countResult = len(user.Papelera)
+		user.Papelera = nil
+	}
+
+	return countResult, errResult
+}
+
+// PurgeTrash elimina definitivamente las entradas de todas las papeleras que
+// se eliminaron antes de la fecha indicada y devuelve cuántas por usuario
+func PurgeTrash(antesDe time.Time) map[string]int {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	purged := make(map[string]int)
+	for email, user := range gestor {
+		for entryID, eliminada := range user.Papelera {
+			if eliminada.Fecha.Before(antesDe) {
+				delete(user.Papelera, entryID)
+				delete(user.Revisiones, entryID)
+				eliminarAdjuntosEntrada(email, user, entryID)
+				purged[email]++
+			}
+		}
+	}
+	return purged
+}
+
+// ExpiringReminders devuelve, por usuario, los recordatorios (en claro) de las
+// entradas que vencen antes de "hasta", solo de los usuarios a los que no se
+// ha enviado el resumen desde "ultimoAntesDe". Se anota el envío en "ahora"
+func ExpiringReminders(hasta time.Time, ultimoAntesDe time.Time, ahora time.Time) map[string][]model.Recordatorio {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	reminders := make(map[string][]model.Recordatorio)
+	for email, user := range gestor {
+		if !user.ResumenCaducidad.Before(ultimoAntesDe) {
+			continue
+		}
+		for _, entry := range user.Vault {
+			if entry.Reminder != nil && entry.Reminder.Vence.Before(hasta) {
+				reminders[email] = append(reminders[email], *entry.Reminder)
+			}
+		}
+		if len(reminders[email]) != 0 {
+			sort.Slice(reminders[email], func(i, j int) bool {
+				return reminders[email][i].Vence.Before(reminders[email][j].Vence)
+			})
+			user.ResumenCaducidad = ahora
+		}
+	}
+	return reminders
+}
+
+// CreateFolder crea una carpeta del usuario, dentro de otra si se indica
+func CreateFolder(email string, nombre string, padre string) (string, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var idResult string
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if _, okParent := user.Carpetas[padre]; padre != "" && !okParent {
+		// Si no existe la carpeta en la que se quiere crear
+		errResult = errors.New("folder not found")
+	} else {
+		if user.Carpetas == nil {
+			user.Carpetas = make(map[string]model.Carpeta)
+		}
+		idResult, errResult = newID(func(id string) bool {
+			_, okFolder := user.Carpetas[id]
+			return okFolder
+		})
+		if errResult == nil {
+			user.Carpetas[idResult] = model.Carpeta{Nombre: nombre, Padre: padre}
+		}
+	}
+
+	return idResult, errResult
+}
+
+// UpdateFolder cambia el nombre de una carpeta y la carpeta que la contiene
+func UpdateFolder(email string, folderID string, nombre string, padre string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if _, okFolder := user.Carpetas[folderID]; !okFolder {
+		// Si no existe la carpeta indicada
+		errResult = errors.New("folder not found")
+	} else if _, okParent := user.Carpetas[padre]; padre != "" && !okParent {
+		// Si no existe la nueva carpeta contenedora
+		errResult = errors.New("folder not found")
+	} else {
+		// Una carpeta no puede acabar dentro de sí misma
+		for id := padre; id != ""; id = user.Carpetas[id].Padre {
+			if id == folderID {
+				return errors.New("invalid parent")
+			}
+		}
+		user.Carpetas[folderID] = model.Carpeta{Nombre: nombre, Padre: padre}
+	}
+
+	return errResult
+}
+
+// DeleteFolder elimina una carpeta, sus subcarpetas y entradas
+// pasan a la carpeta que la contenía
+func DeleteFolder(email string, folderID string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if folder, okFolder := user.Carpetas[folderID]; !okFolder {
+		// Si no existe la carpeta indicada
+		errResult = errors.New("folder not found")
+	} else {
+		for id, child := range user.Carpetas {
+			if child.Padre == folderID {
+				child.Padre = folder.Padre
+				user.Carpetas[id] = child
+			}
+		}
+		for id, entry := range user.Vault {
+			if entry.Folder == folderID {
+				entry.Folder = folder.Padre
+				user.Vault[id] = entry
+			}
+		}
+		delete(user.Carpetas, folderID)
+	}
+
+	return errResult
+}
+
+// CreateTag crea una etiqueta del usuario
+func CreateTag(email string, nombre string) (string, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var idResult string
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else {
+		if user.Etiquetas == nil {
+			user.Etiquetas = make(map[string]model.Etiqueta)
+		}
+		idResult, errResult = newID(func(id string) bool {
+			_, okTag := user.Etiquetas[id]
+			return okTag
+		})
+		if errResult == nil {
+			user.Etiquetas[idResult] = model.Etiqueta{Nombre: nombre}
+		}
+	}
+
+	return idResult, errResult
+}
+
+// RenameTag cambia el nombre de una etiqueta
+func RenameTag(email string, tagID string, nombre string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if _, okTag := user.Etiquetas[tagID]; !okTag {
+		// Si no existe la etiqueta indicada
+		errResult = errors.New("tag not found")
+	} else {
+		user.Etiquetas[tagID] = model.Etiqueta{Nombre: nombre}
+	}
+
+	return errResult
+}
+
+// DeleteTag elimina una etiqueta y la quita de todas las entradas
+func DeleteTag(email string, tagID string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if _, okTag := user.Etiquetas[tagID]; !okTag {
+		// Si no existe la etiqueta indicada
+		errResult = errors.New("tag not found")
+	} else {
+		for id, entry := range user.Vault {
+			var tags []string
+			for _, tag := range entry.Tags {
+				if tag != tagID {
+					tags = append(tags, tag)
+				}
+			}
+			entry.Tags = tags
+			user.Vault[id] = entry
+		}
+		delete(user.Etiquetas, tagID)
 	}
 
 	return errResult
@@ -199,6 +824,8 @@ func DeleteVaultEntry(email string, entryTitle string) error {
 
 // UpdateA2F cambia el estado de activación de A2F para el usuario
 func UpdateA2F(email string, newState bool) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
 
 	var errResult error
 
@@ -212,8 +839,216 @@ func UpdateA2F(email string, newState bool) error {
 	return errResult
 }
 
+// UpdateLanguage cambia el idioma de las notificaciones del usuario
+func UpdateLanguage(email string, idioma string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if utils.NormalizeLanguage(idioma) != idioma {
+		// Solo se admiten idiomas con plantillas de correo
+		errResult = errors.New("unsupported language")
+	} else {
+		user.Idioma = idioma
+	}
+
+	return errResult
+}
+
+// RegisterDevice anota el acceso del usuario desde un dispositivo (IP y
+// cliente) e indica si es la primera vez que se usa
+func RegisterDevice(email string, ip string, userAgent string) (bool, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var isNew bool
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else {
+		isNew = true
+		for i := range user.Dispositivos {
+			if user.Dispositivos[i].IP == ip && user.Dispositivos[i].UserAgent == userAgent {
+				user.Dispositivos[i].UltimoAcceso = time.Now()
+				isNew = false
+			}
+		}
+		if isNew {
+			// El primer acceso de una cuenta no se considera un dispositivo nuevo
+			isNew = len(user.Dispositivos) > 0
+			user.Dispositivos = append(user.Dispositivos, model.Dispositivo{
+				IP:           ip,
+				UserAgent:    userAgent,
+				UltimoAcceso: time.Now(),
+			})
+			if len(user.Dispositivos) > config.MaxUserDevices {
+				sort.Slice(user.Dispositivos, func(i, j int) bool {
+					return user.Dispositivos[i].UltimoAcceso.After(user.Dispositivos[j].UltimoAcceso)
+				})
+				user.Dispositivos = user.Dispositivos[:config.MaxUserDevices]
+			}
+		}
+	}
+
+	return isNew, errResult
+}
+
+// AddRevokeCode guarda (su hash) el código del enlace que permite al
+// usuario cerrar todas sus sesiones
+func AddRevokeCode(email string, codeHash string, expiration time.Time) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else {
+		if user.Revocaciones == nil {
+			user.Revocaciones = make(map[string]time.Time)
+		}
+		// Aprovechamos para descartar los caducados
+		for k, exp := range user.Revocaciones {
+			if time.Now().After(exp) {
+				delete(user.Revocaciones, k)
+			}
+		}
+		user.Revocaciones[codeHash] = expiration
+	}
+
+	return errResult
+}
+
+// CheckRevokeCode comprueba que el código (su hash) existe y no ha caducado,
+// sin consumirlo
+func CheckRevokeCode(codeHash string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	errResult := errors.New("code not found")
+
+	for _, user := range gestor {
+		if exp, ok := user.Revocaciones[codeHash]; ok {
+			if time.Now().After(exp) {
+				errResult = errors.New("code expired")
+			} else {
+				errResult = nil
+			}
+			break
+		}
+	}
+
+	return errResult
+}
+
+// UseRevokeCode busca el usuario al que pertenece el código (su hash) y lo
+// consume, de forma que cada enlace solo se pueda usar una vez
+func UseRevokeCode(codeHash string) (string, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var emailResult string
+	errResult := errors.New("code not found")
+
+	for email, user := range gestor {
+		if exp, ok := user.Revocaciones[codeHash]; ok {
+			delete(user.Revocaciones, codeHash)
+			if time.Now().After(exp) {
+				errResult = errors.New("code expired")
+			} else {
+				emailResult = email
+				errResult = nil
+			}
+			break
+		}
+	}
+
+	return emailResult, errResult
+}
+
+// AddActivity añade un evento al historial de actividad del usuario,
+// descartando los más antiguos si se supera el máximo (los inicios de
+// sesión fallidos seguidos se guardan como uno solo)
+func AddActivity(email string, evento string, ip string, detalles map[string]string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if ultimo := len(user.Actividad) - 1; evento == utils.AuditLoginFailed && ultimo >= 0 && user.Actividad[ultimo].Evento == evento {
+		// Los intentos fallidos seguidos se agrupan en un solo evento (con el
+		// número de intentos), para que no desplacen al resto del historial.
+		// Cada intento queda en el log de auditoría
+		intentos, errAtoi := strconv.Atoi(user.Actividad[ultimo].Detalles["attempts"])
+		if errAtoi != nil {
+			intentos = 1
+		}
+		agrupados := map[string]string{"attempts": strconv.Itoa(intentos + 1)}
+		for clave, valor := range detalles {
+			agrupados[clave] = valor
+		}
+		user.Actividad[ultimo] = model.EventoActividad{
+			Fecha:    time.Now(),
+			Evento:   evento,
+			IP:       ip,
+			Detalles: agrupados,
+		}
+	} else {
+		user.Actividad = append(user.Actividad, model.EventoActividad{
+			Fecha:    time.Now(),
+			Evento:   evento,
+			IP:       ip,
+			Detalles: detalles,
+		})
+		if len(user.Actividad) > config.MaxUserActivity {
+			user.Actividad = user.Actividad[len(user.Actividad)-config.MaxUserActivity:]
+		}
+	}
+
+	return errResult
+}
+
+// ReadActivity recupera una página del historial de actividad del
+// usuario, empezando por los eventos más recientes
+func ReadActivity(email string, pagina int, tamano int) (model.PaginaActividad, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	var pageResult model.PaginaActividad
+	var errResult error
+
+	if user, okUser := gestor[email]; !okUser {
+		// Si no existe el el usuario indicado, no modificamos nada
+		errResult = errors.New("user not found")
+	} else if pagina < 1 || tamano < 1 {
+		errResult = errors.New("invalid page")
+	} else {
+		total := len(user.Actividad)
+		pageResult.Pagina = pagina
+		pageResult.TotalPaginas = (total + tamano - 1) / tamano
+		pageResult.Eventos = []model.EventoActividad{}
+		for i := total - 1 - (pagina-1)*tamano; i >= 0 && len(pageResult.Eventos) < tamano; i-- {
+			pageResult.Eventos = append(pageResult.Eventos, user.Actividad[i])
+		}
+	}
+
+	return pageResult, errResult
+}
+
 // DeleteUser Elimina cuenta de usuario
 func DeleteUser(email string) error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
 
 	var errResult error
 
@@ -221,6 +1056,7 @@ func DeleteUser(email string) error {
 		// Si no existe el el usuario indicado, no modificamos nada
 		errResult = errors.New("user not found")
 	} else {
+		os.RemoveAll(userAttachmentsDir(email))
 		delete(gestor, email)
 	}
 
@@ -228,24 +1064,22 @@ func DeleteUser(email string) error {
 
 }
 
-// After Persistencia Base de Datos
-func After() {
-	salida, err := os.Create("./server/database/bd.txt")
-	if err != nil {
-		panic(0)
+// After Persistencia Base de Datos. El fichero se sustituye completo
+// (escribirFichero): si falla, el anterior queda intacto
+func After() error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	if errorCarga != nil {
+		// No se ha leído la base de datos, no se sobrescribe el fichero
+		return nil
 	}
 
 	// todo: comprobar y validar contraseña
 
-	j, err := json.Marshal(gestor)
-
+	usuarios, err := serializar(gestor)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
-
-	//usuarios := string(j)
-	usuarios := string(utils.EncryptAES(j, config.PassDBEncrypt)) //Encriptar
-	usuarios = utils.ZLibCompress(usuarios)                       //Comprimir
-
-	salida.Write([]byte(usuarios))
+	return escribirFichero(ficheroBD, usuarios)
 }
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/model"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// SchemaVersion es la versión del esquema de la base de datos con la que
+// trabaja el servidor. Cada cambio en model.Usuario que no se pueda leer tal
+// cual desde la versión anterior necesita una nueva versión y su migración
+const SchemaVersion = 2
+
+// El fichero empieza con una cabecera en claro con la versión del esquema
+// ("gestorSDS-db 2\n") seguida del JSON cifrado y comprimido. Los ficheros
+// sin cabecera son de la versión 1
+const cabeceraBD = "gestorSDS-db "
+
+// migracion convierte la base de datos de la versión anterior a Version. Se
+// aplica al JSON sin tipar (usuarios por email) para no depender de que el
+// fichero se pueda leer con el model.Usuario actual
+type migracion struct {
+	Version     int
+	Descripcion string
+	Aplicar     func(usuarios map[string]map[string]interface{}) error
+}
+
+// migraciones son las migraciones del esquema, en orden
+var migraciones = []migracion{
+	{2, "idioma de los correos y bóveda vacía en los usuarios anteriores", migrarUsuariosV2},
+}
+
+// Estado de la carga de la base de datos: el error que impide usarla ("invalid
+// database", "newer version" o "migration required") y, si hay que migrarla,
+// el fichero leído, su versión y el JSON pendiente de migrar
+var errorCarga error
+var contenidoCargado []byte
+var versionCargada int
+var pendienteMigrar []byte
+
+// cargar lee el contenido del fichero de la base de datos. Si es de una
+// versión anterior queda pendiente de migrar (Migrate) y la base de datos vacía
+func cargar(contenido []byte) {
+	gestor = make(map[string]*model.Usuario)
+	errorCarga, contenidoCargado, versionCargada, pendienteMigrar = nil, contenido, 0, nil
+
+	version, datos, err := decodificar(contenido)
+	switch {
+	case err != nil:
+		errorCarga = err
+	case version > SchemaVersion:
+		errorCarga, versionCargada = errors.New("newer version"), version
+	case version < SchemaVersion:
+		errorCarga, versionCargada, pendienteMigrar = errors.New("migration required"), version, datos
+	default:
+		versionCargada = version
+		if errJSON := json.Unmarshal(datos, &gestor); errJSON != nil {
+			errorCarga = errors.New("invalid database")
+		}
+		if gestor == nil {
+			gestor = make(map[string]*model.Usuario)
+		}
+	}
+	if errorCarga != nil {
+		gestor = make(map[string]*model.Usuario)
+	}
+}
+
+// Ready indica si la base de datos se ha leído y está en la versión actual
+func Ready() error {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	return errorCarga
+}
+
+// FileVersion es la versión del esquema del fichero de la base de datos leído
+// (0 si no se ha podido leer o todavía no existía)
+func FileVersion() int {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	return versionCargada
+}
+
+// Migrate actualiza la base de datos a la versión actual del esquema si es de
+// una anterior: guarda antes una copia del fichero tal y como está, aplica las
+// migraciones en orden y guarda el resultado. Devuelve las migraciones
+// aplicadas (vacío si no había que migrar) y la copia
+func Migrate() ([]string, BackupInfo, error) {
+	bdMutex.Lock()
+	defer bdMutex.Unlock()
+
+	if errorCarga == nil {
+		return nil, BackupInfo{}, nil
+	}
+	if pendienteMigrar == nil {
+		return nil, BackupInfo{}, errorCarga
+	}
+
+	copia, err := guardarCopia(contenidoCargado)
+	if err != nil {
+		return nil, BackupInfo{}, err
+	}
+
+	usuarios := make(map[string]map[string]interface{})
+	if err := json.Unmarshal(pendienteMigrar, &usuarios); err != nil {
+		return nil, copia, errors.New("invalid database")
+	}
+	var aplicadas []string
+	for _, m := range migraciones {
+		if m.Version <= versionCargada {
+			continue
+		}
+		if err := m.Aplicar(usuarios); err != nil {
+			return nil, copia, errors.New("migration " + strconv.Itoa(m.Version) + " failed: " + err.Error())
+		}
+		aplicadas = append(aplicadas, strconv.Itoa(m.Version)+": "+m.Descripcion)
+	}
+
+	// El resultado tiene que poderse leer con el esquema actual
+	datos, _ := json.Marshal(usuarios)
+	result := make(map[string]*model.Usuario)
+	if err := json.Unmarshal(datos, &result); err != nil {
+		return nil, copia, errors.New("migration failed: " + err.Error())
+	}
+	contenido, err := serializar(result)
+	if err == nil {
+		err = escribirFichero(ficheroBD, contenido)
+	}
+	if err != nil {
+		return nil, copia, err
+	}
+
+	gestor = result
+	errorCarga, contenidoCargado, versionCargada, pendienteMigrar = nil, contenido, SchemaVersion, nil
+	return aplicadas, copia, nil
+}
+
+// migrarUsuariosV2: los usuarios anteriores a los correos localizados no
+// tienen idioma y los que nunca guardaron entradas pueden tener la bóveda a null
+func migrarUsuariosV2(usuarios map[string]map[string]interface{}) error {
+	for email, usuario := range usuarios {
+		if usuario == nil {
+			return errors.New("empty user " + email)
+		}
+		if idioma, _ := usuario["Idioma"].(string); idioma == "" {
+			usuario["Idioma"] = config.DefaultLanguage
+		}
+		if usuario["Vault"] == nil {
+			usuario["Vault"] = map[string]interface{}{}
+		}
+	}
+	return nil
+}
+
+// codificar genera el contenido del fichero: cabecera con la versión y JSON
+// cifrado con config.PassDBEncrypt y comprimido
+func codificar(version int, datos []byte) []byte {
+	contenido := string(utils.EncryptAES(datos, config.PassDBEncrypt)) //Encriptar
+	contenido = utils.ZLibCompress(contenido)                         //Comprimir
+	return append([]byte(cabeceraBD+strconv.Itoa(version)+"\n"), contenido...)
+}
+
+// decodificar lee la versión y el JSON del contenido de un fichero de la
+// base de datos o de una copia
+func decodificar(contenido []byte) (version int, datos []byte, err error) {
+	// Un fichero dañado puede hacer fallar la descompresión o el descifrado
+	defer func() {
+		if recover() != nil {
+			version, datos, err = 0, nil, errors.New("invalid database")
+		}
+	}()
+
+	version = 1
+	if bytes.HasPrefix(contenido, []byte(cabeceraBD)) {
+		fin := bytes.IndexByte(contenido, '\n')
+		if fin < 0 {
+			return 0, nil, errors.New("invalid database")
+		}
+		if version, err = strconv.Atoi(string(contenido[len(cabeceraBD):fin])); err != nil || version < 1 {
+			return 0, nil, errors.New("invalid database")
+		}
+		contenido = contenido[fin+1:]
+	}
+
+	datos = []byte(utils.ZLibDecompress(contenido))
+	datos = utils.DecryptAES(datos, config.PassDBEncrypt)
+	if !json.Valid(datos) {
+		return 0, nil, errors.New("invalid database")
+	}
+	return version, datos, nil
+}
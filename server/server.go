@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -16,8 +17,14 @@ import (
 // Launch lanza el servidor
 func Launch() {
 
+	// Actualiza la base de datos si es de una versión anterior del esquema
+	// (no se arranca si no se puede usar)
+	if !migrarBaseDatos() {
+		os.Exit(1)
+	}
+
 	// suscripción SIGINT
-	stopChan := make(chan os.Signal)
+	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, os.Interrupt)
 
 	// Rutas disponibles
@@ -26,15 +33,54 @@ func Launch() {
 	mux.Handle("/usuario/registro", http.HandlerFunc(registroUsuario))
 	mux.Handle("/usuario/eliminar", http.HandlerFunc(eliminarUsuario))
 	mux.Handle("/usuario/detalles", http.HandlerFunc(detallesUsuario))
+	mux.Handle("/usuario/actividad", http.HandlerFunc(actividadUsuario))
+	mux.Handle("/usuario/idioma", http.HandlerFunc(idiomaUsuario))
+	mux.Handle("/usuario/revocar", http.HandlerFunc(revocarSesiones))
 	mux.Handle("/a2f/activar", http.HandlerFunc(activarA2F))
 	mux.Handle("/a2f/desactivar", http.HandlerFunc(desactivarA2F))
 	mux.Handle("/a2f/desbloquear", http.HandlerFunc(desbloquearA2F))
 	mux.Handle("/vault", http.HandlerFunc(listarEntradas))
+	mux.Handle("/vault/completo", http.HandlerFunc(bovedaCompleta))
+	mux.Handle("/vault/revisiones", http.HandlerFunc(revisionesEntrada))
+	mux.Handle("/vault/restaurar", http.HandlerFunc(restaurarRevision))
 	mux.Handle("/vault/nueva", http.HandlerFunc(crearEntrada))
 	mux.Handle("/vault/detalles", http.HandlerFunc(detallesEntrada))
+	mux.Handle("/vault/editar", http.HandlerFunc(editarEntrada))
+	mux.Handle("/vault/otp", http.HandlerFunc(contadorOTPEntrada))
 	mux.Handle("/vault/eliminar", http.HandlerFunc(eliminarEntrada))
+	mux.Handle("/vault/migrar", http.HandlerFunc(migrarEntrada))
+	mux.Handle("/papelera", http.HandlerFunc(papeleraUsuario))
+	mux.Handle("/papelera/restaurar", http.HandlerFunc(restaurarDePapelera))
+	mux.Handle("/papelera/vaciar", http.HandlerFunc(vaciarPapelera))
+	mux.Handle("/adjuntos", http.HandlerFunc(listarAdjuntos))
+	mux.Handle("/adjuntos/nuevo", http.HandlerFunc(crearAdjunto))
+	mux.Handle("/adjuntos/subir", http.HandlerFunc(subirParteAdjunto))
+	mux.Handle("/adjuntos/descargar", http.HandlerFunc(descargarAdjunto))
+	mux.Handle("/adjuntos/eliminar", http.HandlerFunc(eliminarAdjunto))
+	mux.Handle("/filtradas/rango", http.HandlerFunc(rangoFiltradas))
+	mux.Handle("/organizacion", http.HandlerFunc(organizacionUsuario))
+	mux.Handle("/carpetas/nueva", http.HandlerFunc(crearCarpeta))
+	mux.Handle("/carpetas/editar", http.HandlerFunc(editarCarpeta))
+	mux.Handle("/carpetas/eliminar", http.HandlerFunc(eliminarCarpeta))
+	mux.Handle("/etiquetas/nueva", http.HandlerFunc(crearEtiqueta))
+	mux.Handle("/etiquetas/renombrar", http.HandlerFunc(renombrarEtiqueta))
+	mux.Handle("/etiquetas/eliminar", http.HandlerFunc(eliminarEtiqueta))
+
+	// Envío de correos pendientes en segundo plano
+	utils.StartOutbox(utils.NewNotifier())
+
+	// Tareas periódicas: purga de la papelera y avisos de caducidad
+	startTareas()
+
+	// Lista de contraseñas filtradas para las consultas por rango
+	abrirListaFiltradas()
+
+	// Las tareas de administración esperan a que terminen las peticiones en curso
+	raiz := http.NewServeMux()
+	raiz.Handle("/", bloqueoTareas(mux))
+	raiz.Handle("/admin/backup", http.HandlerFunc(copiaSeguridadAdmin))
 
-	srv := &http.Server{Addr: config.SecureServerPort, Handler: mux}
+	srv := &http.Server{Addr: config.SecureServerPort, Handler: raiz}
 
 	go func() {
 		if err := srv.ListenAndServeTLS("cert.pem", "key.pem"); err != nil {
@@ -45,8 +91,20 @@ func Launch() {
 	<-stopChan // espera señal SIGINT
 	log.Println("Apagando servidor ...")
 
+	// Detiene las tareas periódicas antes de guardar la BD
+	stopTareas()
+
 	// Guarda la información de la BD en un fichero
-	database.After()
+	if err := database.After(); err != nil {
+		utils.LogError("guardarBaseDatos", "error", err.Error())
+		log.Printf("* No se ha podido guardar la base de datos: %s\n", err)
+	}
+
+	// Detiene el envío de correos (los pendientes se envían al volver a lanzar)
+	utils.StopOutbox()
+
+	// Cierra la lista de contraseñas filtradas
+	cerrarListaFiltradas()
 
 	//Guarda logs en fichero
 	utils.AfterLogs()
@@ -58,3 +116,14 @@ func Launch() {
 
 	log.Println("Servidor detenido correctamente")
 }
+
+// VerifyAudit comprueba la integridad del log de auditoría y muestra el resultado
+func VerifyAudit() bool {
+	count, err := utils.VerifyAudit()
+	if err != nil {
+		fmt.Printf("* Log de auditoría NO válido (%d registros correctos): %s\n", count, err)
+		return false
+	}
+	fmt.Printf("* Log de auditoría válido: %d registros\n", count)
+	return true
+}
@@ -81,6 +81,27 @@ func GetUserFromSession(token string) (string, error) {
 	return userEmail, err
 }
 
+// RevokeUserSessions cierra todas las sesiones activas del usuario
+func RevokeUserSessions(userEmail string) int {
+	count := 0
+	for k, session := range activeUsers {
+		if session.UserEmail == userEmail {
+			delete(activeUsers, k)
+			count++
+		}
+	}
+	return count
+}
+
+// peekUserFromSession devuelve el correo asociado al token (o una cadena vacía)
+// sin comprobar ni renovar la sesión, se usa para identificar al usuario en los logs.
+func peekUserFromSession(token string) string {
+	if tempUser, ok := activeUsers[token]; ok {
+		return tempUser.UserEmail
+	}
+	return ""
+}
+
 func resetSessionExpireTime(token string) {
 	if tempUser, ok := activeUsers[token]; ok {
 		tempUser.SesssionExpireTime = time.Now().Add(time.Second * time.Duration(config.MaxTimeSession))
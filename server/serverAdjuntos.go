@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/server/database"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// Recupera los adjuntos de una entrada (con los nombres cifrados)
+func listarAdjuntos(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	entryID := req.Form.Get("id")
+
+	// Logs
+	utils.LogInfo("listarAdjuntos", "user", peekUserFromSession(token), "entry", entryID)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if adjuntos, errRead := database.ReadAttachments(email, entryID); errRead != nil {
+		responseAdjuntoError(w, errRead)
+	} else if adjuntosJSON, errJSON := json.Marshal(adjuntos); errJSON != nil {
+		response(w, 500, "") // (500 - Internal Server Error)
+	} else {
+		response(w, 200, string(adjuntosJSON))
+	}
+}
+
+// Crea un adjunto en una entrada reservando su tamaño (cifrado) en la cuota
+// del usuario. El contenido se envía después por partes a /adjuntos/subir
+func crearAdjunto(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	entryID := req.Form.Get("id")
+	nombre := req.Form.Get("nombre")
+	tamano, errTamano := strconv.ParseInt(req.Form.Get("tamano"), 10, 64)
+
+	// Logs
+	utils.LogInfo("crearAdjunto", "user", peekUserFromSession(token), "entry", entryID, "size", tamano)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if errTamano != nil || nombre == "" {
+		response(w, 400, "") // (400 - Bad Request)
+	} else if attachmentID, errCreate := database.CreateAttachment(email, entryID, nombre, tamano); errCreate != nil {
+		responseAdjuntoError(w, errCreate)
+	} else {
+		registrarEvento(req, utils.AuditAttachmentAdded, email, map[string]string{"entry": entryID, "attachment": attachmentID})
+		response(w, 201, attachmentID)
+	}
+}
+
+// Recibe una parte del contenido de un adjunto. Los datos de la petición van
+// en la URL y la parte (cifrada) en el cuerpo, como application/octet-stream
+func subirParteAdjunto(w http.ResponseWriter, req *http.Request) {
+	// Parseamos los parámetros de la URL
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	attachmentID := req.Form.Get("adjunto")
+	offset, errOffset := strconv.ParseInt(req.Form.Get("offset"), 10, 64)
+
+	// Logs
+	utils.LogInfo("subirParteAdjunto", "user", peekUserFromSession(token), "attachment", attachmentID, "offset", offset)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Ninguna parte puede superar el tamaño máximo
+	parte := http.MaxBytesReader(w, req.Body, int64(config.AttachmentChunkSize))
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if errOffset != nil {
+		response(w, 400, "") // (400 - Bad Request)
+	} else if subido, errAppend := database.AppendAttachment(email, attachmentID, offset, parte); errAppend != nil {
+		if _, tooLarge := errAppend.(*http.MaxBytesError); tooLarge {
+			response(w, 413, "") // (413 - Request Entity Too Large)
+		} else if errAppend.Error() == "invalid offset" {
+			// Indicamos al cliente desde dónde debe continuar
+			response(w, 409, strconv.FormatInt(subido, 10)) // (409 - Conflict)
+		} else {
+			responseAdjuntoError(w, errAppend)
+		}
+	} else {
+		response(w, 200, strconv.FormatInt(subido, 10))
+	}
+}
+
+// Envía el contenido (cifrado) de un adjunto sin cargarlo entero en memoria
+func descargarAdjunto(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	attachmentID := req.Form.Get("adjunto")
+
+	// Logs
+	utils.LogInfo("descargarAdjunto", "user", peekUserFromSession(token), "attachment", attachmentID)
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if adjunto, errRead := database.ReadAttachment(email, attachmentID); errRead != nil {
+		responseAdjuntoError(w, errRead)
+	} else if !adjunto.Completo() {
+		// Todavía no se ha terminado de subir
+		response(w, 409, "") // (409 - Conflict)
+	} else if fichero, errOpen := os.Open(database.AttachmentPath(email, attachmentID)); errOpen != nil {
+		response(w, 500, "") // (500 - Internal Server Error)
+	} else {
+		defer fichero.Close()
+		registrarEvento(req, utils.AuditAttachmentRead, email, map[string]string{"entry": adjunto.Entrada, "attachment": attachmentID})
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, req, "", adjunto.Fecha, fichero)
+	}
+}
+
+// Elimina un adjunto y su contenido
+func eliminarAdjunto(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	attachmentID := req.Form.Get("adjunto")
+
+	// Logs
+	utils.LogInfo("eliminarAdjunto", "user", peekUserFromSession(token), "attachment", attachmentID)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if adjunto, errRead := database.ReadAttachment(email, attachmentID); errRead != nil {
+		responseAdjuntoError(w, errRead)
+	} else if errDelete := database.DeleteAttachment(email, attachmentID); errDelete != nil {
+		responseAdjuntoError(w, errDelete)
+	} else {
+		registrarEvento(req, utils.AuditAttachmentDeleted, email, map[string]string{"entry": adjunto.Entrada, "attachment": attachmentID})
+		response(w, 200, "")
+	}
+}
+
+// responseAdjuntoError responde con el código http adecuado al error
+func responseAdjuntoError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "user not found", "entry not found", "attachment not found":
+		response(w, 404, "") // (404 - Not found)
+	case "invalid size":
+		response(w, 400, "") // (400 - Bad Request)
+	case "quota exceeded":
+		response(w, 413, "") // (413 - Request Entity Too Large)
+	default:
+		response(w, 500, "") // (500 - Internal Server Error)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/server/database"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// enviarResumenCaducidad envía a cada usuario un correo con las entradas que
+// han caducado o caducan en los próximos config.ExpiryWarningDays días. El
+// servidor no puede leer la caducidad (está cifrada), solo se usan los avisos
+// que el usuario ha decidido compartir en claro, como mucho uno cada
+// config.ExpiryDigestInterval
+func enviarResumenCaducidad() {
+	if !config.NotificationRules[utils.EmailExpiryDigest] {
+		return
+	}
+
+	ahora := time.Now()
+	hasta := ahora.AddDate(0, 0, config.ExpiryWarningDays)
+	ultimoAntesDe := ahora.Add(-time.Duration(config.ExpiryDigestInterval) * time.Second)
+	for email, recordatorios := range database.ExpiringReminders(hasta, ultimoAntesDe, ahora) {
+		var caducadas, proximas []string
+		for _, recordatorio := range recordatorios {
+			linea := "- " + recordatorio.Nombre + " (" + recordatorio.Vence.Format("2006-01-02") + ")"
+			if recordatorio.Vence.Before(ahora) {
+				caducadas = append(caducadas, linea)
+			} else {
+				proximas = append(proximas, linea)
+			}
+		}
+
+		idioma := ""
+		if user, err := database.ReadUser(email); err == nil {
+			idioma = user.Idioma
+		}
+		utils.SendTemplateEmail(email, idioma, utils.EmailExpiryDigest, map[string]string{
+			"Days":     strconv.Itoa(config.ExpiryWarningDays),
+			"Expired":  strings.Join(caducadas, "\n"),
+			"Expiring": strings.Join(proximas, "\n"),
+		})
+
+		detalles := map[string]string{"entries": strconv.Itoa(len(recordatorios))}
+		utils.LogInfo("enviarResumenCaducidad", "user", email, "entries", len(recordatorios))
+		utils.AddAudit(utils.AuditExpiryDigest, email, "", detalles)
+		database.AddActivity(email, utils.AuditExpiryDigest, "", detalles)
+	}
+}
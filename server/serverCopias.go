@@ -0,0 +1,254 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/server/database"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// Formatos de fecha que admite "admin restore --at" (hora local)
+var formatosRestaurar = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02", "20060102-150405"}
+
+// hacerCopiaSeguridad guarda una copia de la base de datos (tal y como está en
+// memoria) y la registra en el log y en la auditoría
+func hacerCopiaSeguridad() (database.BackupInfo, error) {
+	copia, err := database.Backup()
+	if err != nil {
+		utils.LogError("copiaSeguridad", "error", err.Error())
+		return copia, err
+	}
+	utils.LogInfo("copiaSeguridad", "file", copia.Fichero, "size", copia.Tamano)
+	utils.AddAudit(utils.AuditBackupCreated, "", "", map[string]string{"file": filepath.Base(copia.Fichero)})
+	return copia, nil
+}
+
+// copiaSeguridadProgramada es la tarea periódica de copias de seguridad
+func copiaSeguridadProgramada() {
+	hacerCopiaSeguridad()
+}
+
+// Hace una copia de seguridad al momento ("admin backup now" con el servidor
+// en marcha). Solo se atiende desde la propia máquina y fuera de
+// bloqueoTareas: espera a que terminen las peticiones en curso para copiar la
+// base de datos sin cambios a medias
+func copiaSeguridadAdmin(w http.ResponseWriter, req *http.Request) {
+	// Logs
+	utils.LogInfo("copiaSeguridadAdmin", "ip", clientIP(req))
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if ip := net.ParseIP(clientIP(req)); ip == nil || !ip.IsLoopback() {
+		// Solo se puede pedir desde el servidor
+		response(w, 403, "") // (403 - Forbidden)
+		return
+	}
+
+	tareasMutex.Lock()
+	copia, err := hacerCopiaSeguridad()
+	tareasMutex.Unlock()
+
+	if err != nil {
+		response(w, 500, "") // (500 - Internal Server Error)
+	} else {
+		response(w, 201, copia.Fichero) // (201 - Created)
+	}
+}
+
+// servidorEnMarcha indica si hay un servidor escuchando en el puerto configurado
+func servidorEnMarcha() bool {
+	conexion, err := net.DialTimeout("tcp", "127.0.0.1"+config.SecureServerPort, time.Second)
+	if err != nil {
+		return false
+	}
+	conexion.Close()
+	return true
+}
+
+// pedirCopiaSeguridad pide la copia de seguridad al servidor en marcha,
+// devuelve el fichero de la copia
+func pedirCopiaSeguridad() (string, error) {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	response, err := client.PostForm("https://127.0.0.1"+config.SecureServerPort+"/admin/backup", nil)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	// Comprobamos el código de estado recibido
+	switch response.StatusCode {
+	case 201: // (201 - Created)
+		fichero, _ := ioutil.ReadAll(response.Body)
+		return string(fichero), nil
+	case 403: // (403 - Forbidden)
+		return "", errors.New("forbidden")
+	case 500: // (500 - Internal Server Error)
+		return "", errors.New("backup failed")
+	default:
+		return "", errors.New("unknown")
+	}
+}
+
+// migrarBaseDatos actualiza la base de datos si es de una versión anterior
+// del esquema (ver database.Migrate) e indica si se puede usar
+func migrarBaseDatos() bool {
+	version := database.FileVersion()
+	aplicadas, copia, err := database.Migrate()
+	if err != nil {
+		utils.LogError("migrarBaseDatos", "version", version, "error", err.Error())
+		fmt.Fprintf(os.Stderr, "* No se puede usar la base de datos: %s\n", descripcionErrorBD(err))
+		return false
+	}
+	if len(aplicadas) != 0 {
+		utils.LogInfo("migrarBaseDatos", "from", version, "to", database.SchemaVersion, "backup", copia.Fichero)
+		utils.AddAudit(utils.AuditDBMigrated, "", "", map[string]string{
+			"from":   strconv.Itoa(version),
+			"to":     strconv.Itoa(database.SchemaVersion),
+			"backup": filepath.Base(copia.Fichero),
+		})
+		fmt.Printf("* Copia de la base de datos anterior guardada en %s\n", copia.Fichero)
+		for _, migracion := range aplicadas {
+			fmt.Printf("* Migración %s\n", migracion)
+		}
+		fmt.Printf("* Base de datos actualizada de la versión %d a la %d\n", version, database.SchemaVersion)
+	}
+	return true
+}
+
+// descripcionErrorBD explica por qué no se puede usar la base de datos
+func descripcionErrorBD(err error) string {
+	switch err.Error() {
+	case "invalid database":
+		return "el fichero está dañado o no se puede descifrar con config.PassDBEncrypt (se puede restaurar una copia con \"admin restore --at\")"
+	case "newer version":
+		return fmt.Sprintf("es de la versión %d del esquema, posterior a la de este servidor (%d)", database.FileVersion(), database.SchemaVersion)
+	case "migration required":
+		return fmt.Sprintf("es de la versión %d del esquema y hay que actualizarla (\"admin migrate\")", database.FileVersion())
+	}
+	return err.Error()
+}
+
+// LaunchAdmin ejecuta las tareas de administración del servidor:
+//
+//	admin backup now
+//	admin backup list
+//	admin restore --at <fecha>
+//	admin migrate
+//
+// Con el servidor en marcha, "backup now" se lo pide al servidor (copia lo que
+// tiene en memoria); si no, copia el fichero de la base de datos. "restore" y
+// "migrate" solo se pueden hacer con el servidor detenido, que si no
+// sobrescribiría la base de datos al apagarse
+func LaunchAdmin(args []string) {
+	switch {
+	case len(args) == 2 && args[0] == "backup" && args[1] == "now":
+		if servidorEnMarcha() {
+			fichero, err := pedirCopiaSeguridad()
+			if err != nil {
+				adminFail("* No se ha podido hacer la copia de seguridad en el servidor (%s)", err.Error())
+			}
+			fmt.Printf("* Copia de seguridad del servidor en marcha guardada en %s\n", fichero)
+			return
+		}
+		copia, err := hacerCopiaSeguridad()
+		if err != nil {
+			adminFail("* No se ha podido hacer la copia de seguridad (%s)", descripcionErrorBD(err))
+		}
+		fmt.Printf("* Copia de seguridad guardada en %s (%d bytes)\n", copia.Fichero, copia.Tamano)
+
+	case len(args) == 2 && args[0] == "backup" && args[1] == "list":
+		for _, copia := range database.ListBackups() {
+			fmt.Printf("%s\t%d\t%s\n", copia.Fecha.Format("2006-01-02 15:04:05"), copia.Tamano, copia.Fichero)
+		}
+
+	case len(args) >= 1 && args[0] == "restore":
+		flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+		at := flags.String("at", "", "fecha y hora (AAAA-MM-DD[ HH:MM[:SS]] o RFC 3339): se restaura la última copia anterior")
+		if err := flags.Parse(args[1:]); err != nil {
+			os.Exit(2)
+		}
+		if *at == "" || flags.NArg() != 0 {
+			adminFail("El número de parámetros introducido no es correcto.")
+		}
+		momento, err := parsearMomento(*at)
+		if err != nil {
+			adminFail("* La fecha %s no es válida (formato AAAA-MM-DD HH:MM:SS)", *at)
+		}
+		if servidorEnMarcha() {
+			adminFail("* Detén el servidor antes de restaurar una copia de seguridad")
+		}
+
+		restaurada, anterior, err := database.RestoreBackup(momento)
+		if err != nil {
+			switch err.Error() {
+			case "backup not found":
+				adminFail("* No hay ninguna copia de seguridad anterior a %s", momento.Format("2006-01-02 15:04:05"))
+			case "newer version":
+				adminFail("* La copia es de una versión del esquema posterior a la de este servidor (%d)", database.SchemaVersion)
+			case "invalid database":
+				adminFail("* La copia está dañada o no se puede descifrar con config.PassDBEncrypt")
+			}
+			adminFail("* No se ha podido restaurar la copia de seguridad (%s)", descripcionErrorBD(err))
+		}
+		utils.LogInfo("restaurarCopia", "file", restaurada.Fichero, "previous", anterior.Fichero)
+		utils.AddAudit(utils.AuditBackupRestored, "", "", map[string]string{
+			"file":     filepath.Base(restaurada.Fichero),
+			"previous": filepath.Base(anterior.Fichero),
+			"at":       strconv.FormatInt(momento.Unix(), 10),
+		})
+		fmt.Printf("* Restaurada la copia de seguridad del %s (%s)\n", restaurada.Fecha.Format("2006-01-02 15:04:05"), restaurada.Fichero)
+		fmt.Printf("* El estado anterior se ha guardado en %s\n", anterior.Fichero)
+		if err := database.Ready(); err != nil {
+			fmt.Printf("* La copia %s\n", descripcionErrorBD(err))
+		}
+
+	case len(args) == 1 && args[0] == "migrate":
+		if servidorEnMarcha() {
+			adminFail("* Detén el servidor antes de actualizar la base de datos")
+		}
+		if database.Ready() == nil {
+			fmt.Printf("* La base de datos ya está en la versión %d\n", database.SchemaVersion)
+			return
+		}
+		if !migrarBaseDatos() {
+			os.Exit(1)
+		}
+
+	default:
+		adminFail("El número de parámetros introducido no es correcto.")
+	}
+}
+
+// parsearMomento lee la fecha de "admin restore --at" en cualquiera de los
+// formatos admitidos (una fecha sin hora es el final de ese día)
+func parsearMomento(valor string) (time.Time, error) {
+	for _, formato := range formatosRestaurar {
+		if momento, err := time.ParseInLocation(formato, valor, time.Local); err == nil {
+			if formato == "2006-01-02" {
+				momento = momento.AddDate(0, 0, 1).Add(-time.Second)
+			}
+			return momento, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid date")
+}
+
+// adminFail muestra el error de la tarea de administración y termina con
+// código de salida 1
+func adminFail(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(1)
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// Lista de contraseñas filtradas del servidor, nil si no hay ninguna
+var listaFiltradas *utils.PwnedList
+
+// abrirListaFiltradas abre la lista de contraseñas filtradas, si existe
+func abrirListaFiltradas() {
+	lista, err := utils.OpenPwnedList(config.PwnedPasswordsServerFile)
+	if err != nil {
+		utils.LogInfo("abrirListaFiltradas", "file", config.PwnedPasswordsServerFile, "error", err.Error())
+		return
+	}
+	listaFiltradas = lista
+}
+
+// cerrarListaFiltradas cierra la lista de contraseñas filtradas
+func cerrarListaFiltradas() {
+	if listaFiltradas != nil {
+		listaFiltradas.Close()
+		listaFiltradas = nil
+	}
+}
+
+// Devuelve los hashes de contraseñas filtradas que empiezan por el prefijo
+// indicado (5 caracteres del SHA-1), sin el prefijo. El cliente busca en
+// ellos su contraseña, así el servidor nunca llega a saber cuál es
+func rangoFiltradas(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	prefijo := req.Form.Get("prefijo")
+
+	// Logs (sin el prefijo, no hace falta guardarlo)
+	utils.LogInfo("rangoFiltradas", "user", peekUserFromSession(token))
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if _, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if listaFiltradas == nil {
+		// El servidor no tiene lista de contraseñas filtradas
+		response(w, 404, "") // (404 - Not found)
+	} else if rango, errRange := listaFiltradas.Range(prefijo); errRange != nil {
+
+		// Si ha ocurrido un error al buscar, comprobamos
+		// el error y respondemos con el código http adecuado
+		switch errRange.Error() {
+		case "invalid prefix":
+			response(w, 400, "") // (400 - Bad Request)
+		default:
+			response(w, 500, "") // (500 - Internal Server Error)
+		}
+
+	} else {
+		response(w, 200, strings.Join(rango, "\n"))
+	}
+}
@@ -2,9 +2,13 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 
+	"github.com/bertus193/gestorSDS/config"
 	"github.com/bertus193/gestorSDS/model"
 	"github.com/bertus193/gestorSDS/server/database"
 	"github.com/bertus193/gestorSDS/utils"
@@ -13,7 +17,31 @@ import (
 // función para escribir una respuesta del servidor
 func response(w http.ResponseWriter, code int, payloadJSON string) {
 	w.WriteHeader(code)
-	fmt.Fprintf(w, payloadJSON)
+	fmt.Fprint(w, payloadJSON)
+}
+
+// clientIP devuelve la dirección IP desde la que se realiza la petición
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// userLanguage devuelve el idioma de las notificaciones del usuario
+func userLanguage(email string) string {
+	if user, err := database.ReadUser(email); err == nil {
+		return user.Idioma
+	}
+	return ""
+}
+
+// registrarEvento guarda un evento de seguridad en el log de auditoría
+// y en el historial de actividad del usuario
+func registrarEvento(req *http.Request, evento string, email string, detalles map[string]string) {
+	utils.AddAudit(evento, email, clientIP(req), detalles)
+	database.AddActivity(email, evento, clientIP(req), detalles)
 }
 
 // Añade un usuario a la BD
@@ -26,7 +54,7 @@ func registroUsuario(w http.ResponseWriter, req *http.Request) {
 	pass := req.Form.Get("pass")
 
 	// Logs
-	utils.AddLog("registroUsuario: [" + email + ", " + pass + "]")
+	utils.LogInfo("registroUsuario", "user", email)
 
 	// Cabecera estándar
 	w.Header().Set("Content-Type", "text/plain")
@@ -45,6 +73,7 @@ func registroUsuario(w http.ResponseWriter, req *http.Request) {
 
 	} else {
 		// Si la inserción se ha realizado correctamente
+		registrarEvento(req, utils.AuditRegister, email, nil)
 		response(w, 201, "")
 	}
 }
@@ -59,7 +88,7 @@ func loginUsuario(w http.ResponseWriter, req *http.Request) {
 	passw := req.Form.Get("pass")
 
 	// Logs
-	utils.AddLog("loginUsuario: [" + email + ", " + passw + "]")
+	utils.LogInfo("loginUsuario", "user", email)
 
 	// Cabecera estándar
 	w.Header().Set("Content-Type", "text/plain")
@@ -67,6 +96,9 @@ func loginUsuario(w http.ResponseWriter, req *http.Request) {
 	// Añadimos el usuario a la base de datos
 	if user, err := database.GetUser(email, passw); err != nil {
 
+		utils.LogWarn("loginUsuario fallido", "user", email, "error", err.Error())
+		registrarEvento(req, utils.AuditLoginFailed, email, map[string]string{"reason": err.Error()})
+
 		// Si ha ocurrido un error al recuperar el usuario, comprobamos
 		// el error y respondemos con el código http adecuado
 		switch err.Error() {
@@ -82,13 +114,16 @@ func loginUsuario(w http.ResponseWriter, req *http.Request) {
 		// Si el usuario existe pero tiene A2F activado
 		// Creamos la sesión con activación vía A2F
 		token, a2fcode := CreateUserSession(email, true)
+		registrarEvento(req, utils.AuditLogin, email, map[string]string{"2fa": "pending"})
 		// Enviamos el código de A2F por correo
-		utils.Send2FACode(email, a2fcode)
+		utils.Send2FACode(email, user.Idioma, a2fcode)
 		// Respondemos con el token e informando
 		response(w, 250, token) // (250 - A2F required [custom])
 	} else {
 		// Si el usuario existe y no tiene A2F activado
 		token, _ := CreateUserSession(email, false)
+		registrarEvento(req, utils.AuditLogin, email, nil)
+		comprobarDispositivo(req, email, user.Idioma)
 		response(w, 200, token)
 	}
 }
@@ -103,13 +138,16 @@ func desbloquearA2F(w http.ResponseWriter, req *http.Request) {
 	a2fcode := req.Form.Get("a2fcode")
 
 	// Logs
-	utils.AddLog("desbloquearA2F: [" + token + ", " + a2fcode + "]")
+	utils.LogInfo("desbloquearA2F", "user", peekUserFromSession(token))
 
 	// Cabecera estándar
 	w.Header().Set("Content-Type", "text/plain")
 
+	userEmail := peekUserFromSession(token)
 	if err := UnlockSessionWith2FA(token, a2fcode); err != nil {
 
+		registrarEvento(req, utils.AuditA2FFailed, userEmail, map[string]string{"reason": err.Error()})
+
 		// Si ha ocurrido un error al recuperar el usuario, comprobamos
 		// el error y respondemos con el código http adecuado
 		switch err.Error() {
@@ -126,6 +164,8 @@ func desbloquearA2F(w http.ResponseWriter, req *http.Request) {
 		}
 	} else {
 		// La sesión se ha desbloqueado correctamente
+		registrarEvento(req, utils.AuditA2FResolved, userEmail, nil)
+		comprobarDispositivo(req, userEmail, userLanguage(userEmail))
 		response(w, 200, "")
 	}
 }
@@ -139,7 +179,7 @@ func listarEntradas(w http.ResponseWriter, req *http.Request) {
 	token := req.Form.Get("token")
 
 	// Logs
-	utils.AddLog("listarCuentas: [" + token + "]")
+	utils.LogInfo("listarEntradas", "user", peekUserFromSession(token))
 
 	// Cabecera estándar
 	w.Header().Set("Content-Type", "text/plain")
@@ -151,14 +191,27 @@ func listarEntradas(w http.ResponseWriter, req *http.Request) {
 	} else if user, errUser := database.ReadUser(email); errUser != nil {
 		response(w, 500, "") // (500 - Internal Server Error)
 	} else {
-		entriesList := model.ListaEntradas{}
+		entriesList := model.ListaEntradas{Entradas: make(map[string]model.ResumenEntrada)}
 		for entry := range user.Vault {
+			// Guardamos solo lo que mostraremos (cifrado por el cliente)
 			tempEntry := user.Vault[entry]
-			if tempEntry.Mode == 0 { // Texto
-				// Guardamos solo lo que mostraremos, el título
+			entriesList.Entradas[entry] = model.ResumenEntrada{
+				Version: tempEntry.Version,
+				Title:   tempEntry.Title,
+				Type:    tempEntry.Type,
+				Mode:    tempEntry.Mode,
+				Folder:  tempEntry.Folder,
+				Tags:    tempEntry.Tags,
+
+				Expires:      tempEntry.Expires,
+				RotationDays: tempEntry.RotationDays,
+				Renewed:      tempEntry.Renewed,
+			}
+
+			// Listas anteriores a los tipos de entrada (clientes antiguos)
+			if tempEntry.Version < model.VersionEntrada && tempEntry.Tipo() == model.TipoTexto {
 				entriesList.Texts = append(entriesList.Texts, entry)
-			} else if tempEntry.Mode == 1 { //Account
-				// Guardamos solo lo que mostraremos, el título
+			} else if tempEntry.Version < model.VersionEntrada && tempEntry.Tipo() == model.TipoCuenta {
 				entriesList.Accounts = append(entriesList.Accounts, entry)
 			}
 		}
@@ -172,6 +225,35 @@ func listarEntradas(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// Recupera todas las entradas del usuario (cifradas) para que el cliente
+// pueda buscar en ellas, sin registrar una lectura por cada entrada
+func bovedaCompleta(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+
+	// Logs
+	utils.LogInfo("bovedaCompleta", "user", peekUserFromSession(token))
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if user, errUser := database.ReadUser(email); errUser != nil {
+		response(w, 500, "") // (500 - Internal Server Error)
+	} else if vaultJSON, errJSON := json.Marshal(user.Vault); errJSON != nil {
+		response(w, 500, "") // (500 - Internal Server Error)
+	} else {
+		registrarEvento(req, utils.AuditVaultRead, email, nil)
+		response(w, 200, string(vaultJSON))
+	}
+}
+
 // Añade una entrada a un usuario de la BD
 func crearEntrada(w http.ResponseWriter, req *http.Request) {
 	// Parseamos el formulario
@@ -179,11 +261,12 @@ func crearEntrada(w http.ResponseWriter, req *http.Request) {
 
 	// Recuperamos los datos
 	token := req.Form.Get("token")
-	tituloEntrada := req.Form.Get("tituloEntrada")
-	mode := req.Form.Get("mode") // Indica el tipo de entrada
+	tituloEntrada := req.Form.Get("tituloEntrada") // Clientes antiguos
+	mode := req.Form.Get("mode")                   // Indica el tipo de entrada (clientes antiguos)
+	tipo := req.Form.Get("tipo")                   // Tipo de entrada (cifrado)
 
 	// Logs
-	utils.AddLog("crearCuenta: [" + token + ", " + tituloEntrada + ", " + mode + "]")
+	utils.LogInfo("crearEntrada", "user", peekUserFromSession(token), "entry", tituloEntrada, "mode", mode)
 
 	// Recogemos el email del usuario
 	if email, errSession := GetUserFromSession(token); errSession != nil {
@@ -192,8 +275,18 @@ func crearEntrada(w http.ResponseWriter, req *http.Request) {
 	} else {
 
 		var errCreate error
+		entryID := tituloEntrada
 		// Comprobamos el tipo de entrada que estamos creando
-		if mode == "0" {
+		if tipo != "" {
+			// Si es una entrada con tipo, guardamos los campos sin interpretarlos
+			// con un identificador aleatorio (el título va cifrado en la entrada)
+			if entry, errForm := leerEntradaConTipo(req); errForm != nil {
+				errCreate = errForm
+			} else {
+				entryID, errCreate = database.CreateTypedVaultEntry(email, entry)
+			}
+
+		} else if mode == "0" {
 			// Si es una entrada de tipo texto
 			textoEntrada := req.Form.Get("textoEntrada")
 			errCreate = database.CreateTextVaultEntry(email, tituloEntrada, textoEntrada)
@@ -215,17 +308,238 @@ func crearEntrada(w http.ResponseWriter, req *http.Request) {
 				response(w, 404, "") // (404 - Not found)
 			case "entry already exists":
 				response(w, 409, "") // (409 - Conflict)
+			case "invalid fields":
+				response(w, 400, "") // (400 - Bad Request)
 			default:
 				response(w, 500, "") // (500 - Internal Server Error)
 			}
 
 		} else {
-			// Devolvemos la información
-			response(w, 201, "")
+			// Devolvemos el identificador de la nueva entrada
+			registrarEvento(req, utils.AuditEntryCreated, email, map[string]string{"entry": entryID})
+			response(w, 201, entryID)
+		}
+	}
+}
+
+// Sustituye el contenido de una entrada existente (campos, campos
+// personalizados y URLs), el cliente envía la entrada completa
+func editarEntrada(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	entryID := entryIDFromForm(req)
+
+	// Logs
+	utils.LogInfo("editarEntrada", "user", peekUserFromSession(token), "entry", entryID)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if entry, errForm := leerEntradaConTipo(req); errForm != nil {
+		response(w, 400, "") // (400 - Bad Request)
+	} else if errUpdate := database.UpdateVaultEntry(email, entryID, entry); errUpdate != nil {
+
+		// Si ha ocurrido un error al modificar, comprobamos
+		// el error y respondemos con el código http adecuado
+		switch errUpdate.Error() {
+		case "user not found":
+			response(w, 404, "") // (404 - Not found)
+		case "entry not found":
+			response(w, 404, "") // (404 - Not found)
+		default:
+			response(w, 500, "") // (500 - Internal Server Error)
 		}
+
+	} else {
+		registrarEvento(req, utils.AuditEntryUpdated, email, map[string]string{"entry": entryID})
+		response(w, 200, "")
 	}
 }
 
+// Guarda el siguiente contador HOTP de una entrada (la URI otpauth:// cifrada)
+// sin crear una versión nueva en su historial
+func contadorOTPEntrada(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	entryID := entryIDFromForm(req)
+	campo := req.Form.Get("campo")
+	valor := req.Form.Get("valor")
+
+	// Logs
+	utils.LogInfo("contadorOTPEntrada", "user", peekUserFromSession(token), "entry", entryID)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if errUpdate := database.UpdateOTPField(email, entryID, campo, valor); errUpdate != nil {
+
+		// Si ha ocurrido un error al modificar, comprobamos
+		// el error y respondemos con el código http adecuado
+		switch errUpdate.Error() {
+		case "user not found":
+			response(w, 404, "") // (404 - Not found)
+		case "entry not found":
+			response(w, 404, "") // (404 - Not found)
+		case "invalid fields":
+			response(w, 400, "") // (400 - Bad Request)
+		default:
+			response(w, 500, "") // (500 - Internal Server Error)
+		}
+
+	} else {
+		response(w, 200, "")
+	}
+}
+
+// Recupera las versiones anteriores (cifradas) de una entrada
+func revisionesEntrada(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	entryID := entryIDFromForm(req)
+
+	// Logs
+	utils.LogInfo("revisionesEntrada", "user", peekUserFromSession(token), "entry", entryID)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if revisiones, errRead := database.ReadRevisions(email, entryID); errRead != nil {
+
+		// Si ha ocurrido un error al leer, comprobamos
+		// el error y respondemos con el código http adecuado
+		switch errRead.Error() {
+		case "user not found":
+			response(w, 404, "") // (404 - Not found)
+		case "entry not found":
+			response(w, 404, "") // (404 - Not found)
+		default:
+			response(w, 500, "") // (500 - Internal Server Error)
+		}
+
+	} else if revisionesJSON, errJSON := json.Marshal(revisiones); errJSON != nil {
+		response(w, 500, "") // (500 - Internal Server Error)
+	} else {
+		registrarEvento(req, utils.AuditEntryRead, email, map[string]string{"entry": entryID})
+		response(w, 200, string(revisionesJSON))
+	}
+}
+
+// Restaura una versión anterior de una entrada
+func restaurarRevision(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	entryID := entryIDFromForm(req)
+	revision, errRevision := strconv.Atoi(req.Form.Get("revision"))
+
+	// Logs
+	utils.LogInfo("restaurarRevision", "user", peekUserFromSession(token), "entry", entryID, "revision", req.Form.Get("revision"))
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if errRevision != nil {
+		response(w, 400, "") // (400 - Bad Request)
+	} else if errRestore := database.RestoreRevision(email, entryID, revision); errRestore != nil {
+
+		// Si ha ocurrido un error al restaurar, comprobamos
+		// el error y respondemos con el código http adecuado
+		switch errRestore.Error() {
+		case "user not found":
+			response(w, 404, "") // (404 - Not found)
+		case "revision not found":
+			response(w, 404, "") // (404 - Not found)
+		default:
+			response(w, 500, "") // (500 - Internal Server Error)
+		}
+
+	} else {
+		registrarEvento(req, utils.AuditEntryRestored, email, map[string]string{"entry": entryID, "revision": strconv.Itoa(revision)})
+		response(w, 200, "")
+	}
+}
+
+// entryIDFromForm devuelve el identificador de la entrada de la
+// petición (los clientes antiguos envían el título)
+func entryIDFromForm(req *http.Request) string {
+	if id := req.Form.Get("id"); id != "" {
+		return id
+	}
+	return req.Form.Get("tituloEntrada")
+}
+
+// leerEntradaConTipo construye una entrada con tipo a partir del formulario
+// (version, titulo, tipo, carpeta, caducidad, rotacion, renovada, reglas,
+// etiquetas, campos, camposPersonalizados, urls y recordatorio, estos cinco
+// últimos en JSON)
+func leerEntradaConTipo(req *http.Request) (model.VaultEntry, error) {
+	entry := model.VaultEntry{Type: req.Form.Get("tipo"), Title: req.Form.Get("titulo"), Folder: req.Form.Get("carpeta")}
+	entry.Expires = req.Form.Get("caducidad")
+	entry.RotationDays = req.Form.Get("rotacion")
+	entry.Renewed = req.Form.Get("renovada")
+	entry.Rules = req.Form.Get("reglas")
+	if entry.Type == "" {
+		return entry, errors.New("invalid fields")
+	}
+	if version := req.Form.Get("version"); version != "" {
+		var errVersion error
+		if entry.Version, errVersion = strconv.Atoi(version); errVersion != nil {
+			return entry, errors.New("invalid fields")
+		}
+	}
+	if errJSON := json.Unmarshal([]byte(req.Form.Get("campos")), &entry.Fields); errJSON != nil {
+		return entry, errors.New("invalid fields")
+	}
+	if custom := req.Form.Get("camposPersonalizados"); custom != "" {
+		if errJSON := json.Unmarshal([]byte(custom), &entry.CustomFields); errJSON != nil {
+			return entry, errors.New("invalid fields")
+		}
+	}
+	if etiquetas := req.Form.Get("etiquetas"); etiquetas != "" {
+		if errJSON := json.Unmarshal([]byte(etiquetas), &entry.Tags); errJSON != nil {
+			return entry, errors.New("invalid fields")
+		}
+	}
+	if urls := req.Form.Get("urls"); urls != "" {
+		if errJSON := json.Unmarshal([]byte(urls), &entry.URLs); errJSON != nil {
+			return entry, errors.New("invalid fields")
+		}
+	}
+	if recordatorio := req.Form.Get("recordatorio"); recordatorio != "" {
+		if errJSON := json.Unmarshal([]byte(recordatorio), &entry.Reminder); errJSON != nil || entry.Reminder == nil || entry.Reminder.Vence.IsZero() {
+			return entry, errors.New("invalid fields")
+		}
+	}
+	return entry, nil
+}
+
 // Recupera los detalles de una entrada concreta
 func detallesEntrada(w http.ResponseWriter, req *http.Request) {
 	// Parseamos el formulario
@@ -233,10 +547,10 @@ func detallesEntrada(w http.ResponseWriter, req *http.Request) {
 
 	// Recuperamos los datos
 	token := req.Form.Get("token")
-	tituloEntrada := req.Form.Get("tituloEntrada")
+	entryID := entryIDFromForm(req)
 
 	// Logs
-	utils.AddLog("detallesEntrada: [" + token + ", " + tituloEntrada + "]")
+	utils.LogInfo("detallesEntrada", "user", peekUserFromSession(token), "entry", entryID)
 
 	// Cabecera estándar
 	w.Header().Set("Content-Type", "text/plain")
@@ -245,7 +559,7 @@ func detallesEntrada(w http.ResponseWriter, req *http.Request) {
 	if email, errSession := GetUserFromSession(token); errSession != nil {
 		// La sesión ha caducado o no es valida
 		response(w, 401, "") // (401 - Unauthorized)
-	} else if entry, errRead := database.ReadVaultEntry(email, tituloEntrada); errRead != nil {
+	} else if entry, errRead := database.ReadVaultEntry(email, entryID); errRead != nil {
 
 		// Si ha ocurrido un error al insetar, comprobamos
 		// el error y respondemos con el código http adecuado
@@ -260,6 +574,7 @@ func detallesEntrada(w http.ResponseWriter, req *http.Request) {
 
 	} else {
 		// Devolvemos la información
+		registrarEvento(req, utils.AuditEntryRead, email, map[string]string{"entry": entryID})
 		if entryJSON, errJSON := json.Marshal(entry); errJSON != nil {
 			response(w, 500, "") // (500 - Internal Server Error)
 		} else {
@@ -276,10 +591,10 @@ func eliminarEntrada(w http.ResponseWriter, req *http.Request) {
 
 	// Recuperamos los datos
 	token := req.Form.Get("token")
-	tituloEntrada := req.Form.Get("tituloEntrada")
+	entryID := entryIDFromForm(req)
 
 	// Logs
-	utils.AddLog("eliminarEntrada: [" + token + ", " + tituloEntrada + "]")
+	utils.LogInfo("eliminarEntrada", "user", peekUserFromSession(token), "entry", entryID)
 
 	// Cabecera estándar
 	w.Header().Set("Content-Type", "text/plain")
@@ -288,7 +603,7 @@ func eliminarEntrada(w http.ResponseWriter, req *http.Request) {
 	if email, errSession := GetUserFromSession(token); errSession != nil {
 		// La sesión ha caducado o no es valida
 		response(w, 401, "") // (401 - Unauthorized)
-	} else if errDelete := database.DeleteVaultEntry(email, tituloEntrada); errDelete != nil {
+	} else if errDelete := database.DeleteVaultEntry(email, entryID); errDelete != nil {
 
 		// Si ha ocurrido un error al borrar, comprobamos
 		// el error y respondemos con el código http adecuado
@@ -303,10 +618,55 @@ func eliminarEntrada(w http.ResponseWriter, req *http.Request) {
 
 	} else {
 		// Devolvemos la información
+		registrarEvento(req, utils.AuditEntryDeleted, email, map[string]string{"entry": entryID})
 		response(w, 200, "")
 	}
 }
 
+// Sustituye una entrada antigua (identificada por el título) por su versión
+// actual, cifrada por el cliente, y devuelve su nuevo identificador
+func migrarEntrada(w http.ResponseWriter, req *http.Request) {
+
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	entryID := entryIDFromForm(req)
+
+	// Logs
+	utils.LogInfo("migrarEntrada", "user", peekUserFromSession(token))
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if entry, errForm := leerEntradaConTipo(req); errForm != nil {
+		response(w, 400, "") // (400 - Bad Request)
+	} else if newID, errMigrate := database.MigrateVaultEntry(email, entryID, entry); errMigrate != nil {
+
+		// Si ha ocurrido un error al migrar, comprobamos
+		// el error y respondemos con el código http adecuado
+		switch errMigrate.Error() {
+		case "user not found":
+			response(w, 404, "") // (404 - Not found)
+		case "entry not found":
+			response(w, 404, "") // (404 - Not found)
+		case "entry not migrated":
+			response(w, 409, "") // (409 - Conflict)
+		default:
+			response(w, 500, "") // (500 - Internal Server Error)
+		}
+
+	} else {
+		registrarEvento(req, utils.AuditEntryUpdated, email, map[string]string{"entry": newID})
+		response(w, 201, newID)
+	}
+}
+
 // Recupera los detalles del usuario
 func detallesUsuario(w http.ResponseWriter, req *http.Request) {
 
@@ -317,7 +677,7 @@ func detallesUsuario(w http.ResponseWriter, req *http.Request) {
 	token := req.Form.Get("token")
 
 	// Logs
-	utils.AddLog("detallesUsuario: [" + token + "]")
+	utils.LogInfo("detallesUsuario", "user", peekUserFromSession(token))
 
 	// Cabecera estándar
 	w.Header().Set("Content-Type", "text/plain")
@@ -343,6 +703,7 @@ func detallesUsuario(w http.ResponseWriter, req *http.Request) {
 			Email:      email,
 			A2FEnabled: user.A2FEnabled,
 			NumEntries: len(user.Vault),
+			Idioma:     utils.NormalizeLanguage(user.Idioma),
 		}
 
 		if userJSON, errJSON := json.Marshal(details); errJSON != nil {
@@ -363,7 +724,7 @@ func activarA2F(w http.ResponseWriter, req *http.Request) {
 	token := req.Form.Get("token")
 
 	// Logs
-	utils.AddLog("activarA2F: [" + token + "]")
+	utils.LogInfo("activarA2F", "user", peekUserFromSession(token))
 
 	// Cabecera estándar
 	w.Header().Set("Content-Type", "text/plain")
@@ -385,6 +746,8 @@ func activarA2F(w http.ResponseWriter, req *http.Request) {
 
 	} else {
 		// Devolvemos la confirmación
+		registrarEvento(req, utils.AuditA2FEnabled, email, nil)
+		notificarEvento(req, email, userLanguage(email), utils.Email2FAEnabled, nil)
 		response(w, 200, "")
 	}
 }
@@ -398,7 +761,7 @@ func desactivarA2F(w http.ResponseWriter, req *http.Request) {
 	token := req.Form.Get("token")
 
 	// Logs
-	utils.AddLog("desactivarA2F: [" + token + "]")
+	utils.LogInfo("desactivarA2F", "user", peekUserFromSession(token))
 
 	// Cabecera estándar
 	w.Header().Set("Content-Type", "text/plain")
@@ -420,6 +783,48 @@ func desactivarA2F(w http.ResponseWriter, req *http.Request) {
 
 	} else {
 		// Devolvemos la confirmación
+		registrarEvento(req, utils.AuditA2FDisabled, email, nil)
+		notificarEvento(req, email, userLanguage(email), utils.Email2FADisabled, nil)
+		response(w, 200, "")
+	}
+}
+
+// Cambia el idioma de las notificaciones del usuario
+func idiomaUsuario(w http.ResponseWriter, req *http.Request) {
+
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	idioma := req.Form.Get("idioma")
+
+	// Logs
+	utils.LogInfo("idiomaUsuario", "user", peekUserFromSession(token), "language", idioma)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if errUpdate := database.UpdateLanguage(email, idioma); errUpdate != nil {
+
+		// Si ha ocurrido un error al cambiar el valor, comprobamos
+		// el error y respondemos con el código http adecuado
+		switch errUpdate.Error() {
+		case "user not found":
+			response(w, 404, "") // (404 - Not found)
+		case "unsupported language":
+			response(w, 400, "") // (400 - Bad Request)
+		default:
+			response(w, 500, "") // (500 - Internal Server Error)
+		}
+
+	} else {
+		// Devolvemos la confirmación
+		registrarEvento(req, utils.AuditLanguageChanged, email, map[string]string{"language": idioma})
 		response(w, 200, "")
 	}
 }
@@ -434,13 +839,15 @@ func eliminarUsuario(w http.ResponseWriter, req *http.Request) {
 	token := req.Form.Get("token")
 
 	// Logs
-	utils.AddLog("eliminarUsuario: [" + token + "]")
+	utils.LogInfo("eliminarUsuario", "user", peekUserFromSession(token))
 
 	// Cabecera estándar
 	w.Header().Set("Content-Type", "text/plain")
 
 	// Respondemos
-	if email, errSession := GetUserFromSession(token); errSession != nil {
+	email, errSession := GetUserFromSession(token)
+	idioma := userLanguage(email)
+	if errSession != nil {
 		// La sesión ha caducado o no es valida
 		response(w, 401, "") // (401 - Unauthorized)
 	} else if errDelete := database.DeleteUser(email); errDelete != nil {
@@ -456,6 +863,55 @@ func eliminarUsuario(w http.ResponseWriter, req *http.Request) {
 
 	} else {
 		// Devolvemos la confirmación
+		utils.AddAudit(utils.AuditAccountDelete, email, clientIP(req), nil)
+		RevokeUserSessions(email)
+		notificarEvento(req, email, idioma, utils.EmailAccountDeleted, nil)
 		response(w, 200, "")
 	}
 }
+
+// Recupera una página del historial de actividad del usuario
+func actividadUsuario(w http.ResponseWriter, req *http.Request) {
+
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	pagina, errPagina := strconv.Atoi(req.Form.Get("pagina"))
+	if errPagina != nil {
+		pagina = 1
+	}
+
+	// Logs
+	utils.LogInfo("actividadUsuario", "user", peekUserFromSession(token), "page", pagina)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if page, errRead := database.ReadActivity(email, pagina, config.ActivityPageSize); errRead != nil {
+
+		// Si ha ocurrido un error al leer, comprobamos
+		// el error y respondemos con el código http adecuado
+		switch errRead.Error() {
+		case "user not found":
+			response(w, 404, "") // (404 - Not found)
+		case "invalid page":
+			response(w, 400, "") // (400 - Bad Request)
+		default:
+			response(w, 500, "") // (500 - Internal Server Error)
+		}
+
+	} else {
+		// Devolvemos la información
+		if pageJSON, errJSON := json.Marshal(page); errJSON != nil {
+			response(w, 500, "") // (500 - Internal Server Error)
+		} else {
+			response(w, 200, string(pageJSON))
+		}
+	}
+}
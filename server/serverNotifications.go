@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/server/database"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// notificarEvento envía al propietario de la cuenta el correo de un
+// evento de seguridad, siempre que la regla correspondiente esté activa
+func notificarEvento(req *http.Request, email string, idioma string, plantilla string, datos map[string]string) {
+	if !config.NotificationRules[plantilla] {
+		return
+	}
+	if datos == nil {
+		datos = make(map[string]string)
+	}
+	datos["Date"] = time.Now().Format("2006-01-02 15:04:05 MST")
+	datos["IP"] = clientIP(req)
+	datos["Device"] = req.UserAgent()
+	utils.SendTemplateEmail(email, idioma, plantilla, datos)
+}
+
+// comprobarDispositivo anota el dispositivo desde el que se ha iniciado
+// sesión y, si es nuevo, avisa al usuario con un enlace para cerrar
+// todas sus sesiones en caso de no haber sido él
+func comprobarDispositivo(req *http.Request, email string, idioma string) {
+	isNew, err := database.RegisterDevice(email, clientIP(req), req.UserAgent())
+	if err != nil || !isNew {
+		return
+	}
+
+	registrarEvento(req, utils.AuditNewDevice, email, map[string]string{"device": req.UserAgent()})
+
+	if !config.NotificationRules[utils.EmailNewDeviceLogin] {
+		return
+	}
+
+	datos := make(map[string]string)
+	codeRaw, errCode := utils.GenerateRandomBytes(32)
+	if errCode == nil {
+		code := utils.EncodeBase64(codeRaw)
+		expiration := time.Now().Add(time.Second * time.Duration(config.RevokeLinkTime))
+		if database.AddRevokeCode(email, revokeCodeHash(code), expiration) == nil {
+			datos["RevokeURL"] = strings.TrimRight(config.PublicURL, "/") + "/usuario/revocar?codigo=" + url.QueryEscape(code)
+		}
+	}
+	notificarEvento(req, email, idioma, utils.EmailNewDeviceLogin, datos)
+}
+
+// revokeCodeHash devuelve el hash con el que se guarda el código de revocación
+func revokeCodeHash(code string) string {
+	hash := utils.HashSha512([]byte(code))
+	return utils.EncodeBase64(hash[:])
+}
+
+// paginaRevocar es la página de confirmación del enlace "no he sido yo": el
+// enlace (GET) solo la muestra, las sesiones se cierran al enviar el formulario
+// (POST). Así no las cierra cualquiera que abra el enlace sin querer (p. ej. el
+// antivirus o la vista previa del correo)
+const paginaRevocar = `<!DOCTYPE html>
+<html lang="es">
+<head><meta charset="utf-8"><title>%s</title></head>
+<body>
+<h1>¿No has sido tú?</h1>
+<p>Si no has iniciado sesión desde un dispositivo nuevo, cierra todas las sesiones abiertas de tu cuenta y cambia tu contraseña.</p>
+<form method="post" action="/usuario/revocar">
+<input type="hidden" name="codigo" value="%s">
+<button type="submit">Cerrar todas las sesiones</button>
+</form>
+</body>
+</html>
+`
+
+// Cierra todas las sesiones del usuario desde el enlace "no he sido yo"
+// del aviso de inicio de sesión (se abre desde el navegador). El enlace
+// muestra la confirmación (GET) y el formulario las cierra (POST)
+func revocarSesiones(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	code := req.Form.Get("codigo")
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	switch req.Method {
+	case http.MethodGet:
+		if err := database.CheckRevokeCode(revokeCodeHash(code)); err != nil {
+			utils.LogWarn("revocarSesiones", "error", err.Error())
+			responseRevocarError(w, err)
+		} else {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			response(w, 200, fmt.Sprintf(paginaRevocar, html.EscapeString(config.AppName), html.EscapeString(code)))
+		}
+
+	case http.MethodPost:
+		if email, err := database.UseRevokeCode(revokeCodeHash(code)); err != nil {
+			utils.LogWarn("revocarSesiones", "error", err.Error())
+			responseRevocarError(w, err)
+		} else {
+			count := RevokeUserSessions(email)
+			utils.LogInfo("revocarSesiones", "user", email, "sessions", count)
+			registrarEvento(req, utils.AuditRevoked, email, nil)
+			response(w, 200, "Se han cerrado todas las sesiones de tu cuenta. Te recomendamos cambiar tu contraseña.\n")
+		}
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		response(w, 405, "") // (405 - Method Not Allowed)
+	}
+}
+
+// responseRevocarError responde con el código http adecuado si el código
+// del enlace "no he sido yo" no es válido
+func responseRevocarError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "code not found":
+		response(w, 404, "El enlace no es válido o ya se ha usado.\n") // (404 - Not found)
+	case "code expired":
+		response(w, 410, "El enlace ha caducado.\n") // (410 - Gone)
+	default:
+		response(w, 500, "") // (500 - Internal Server Error)
+	}
+}
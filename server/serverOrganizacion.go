@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bertus193/gestorSDS/model"
+	"github.com/bertus193/gestorSDS/server/database"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// Recupera las carpetas y etiquetas del usuario (con los nombres cifrados)
+func organizacionUsuario(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+
+	// Logs
+	utils.LogInfo("organizacionUsuario", "user", peekUserFromSession(token))
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if user, errUser := database.ReadUser(email); errUser != nil {
+		response(w, 404, "") // (404 - Not found)
+	} else {
+		result := model.Organizacion{Carpetas: user.Carpetas, Etiquetas: user.Etiquetas}
+		if resultJSON, errJSON := json.Marshal(result); errJSON != nil {
+			response(w, 500, "") // (500 - Internal Server Error)
+		} else {
+			response(w, 200, string(resultJSON))
+		}
+	}
+}
+
+// Crea una carpeta, dentro de otra si se indica "padre"
+func crearCarpeta(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	nombre := req.Form.Get("nombre")
+	padre := req.Form.Get("padre")
+
+	// Logs
+	utils.LogInfo("crearCarpeta", "user", peekUserFromSession(token), "parent", padre)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if folderID, errCreate := database.CreateFolder(email, nombre, padre); errCreate != nil {
+		responseOrganizacionError(w, errCreate)
+	} else {
+		response(w, 201, folderID)
+	}
+}
+
+// Cambia el nombre de una carpeta y la carpeta que la contiene
+func editarCarpeta(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	folderID := req.Form.Get("id")
+	nombre := req.Form.Get("nombre")
+	padre := req.Form.Get("padre")
+
+	// Logs
+	utils.LogInfo("editarCarpeta", "user", peekUserFromSession(token), "folder", folderID, "parent", padre)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if errUpdate := database.UpdateFolder(email, folderID, nombre, padre); errUpdate != nil {
+		responseOrganizacionError(w, errUpdate)
+	} else {
+		response(w, 200, "")
+	}
+}
+
+// Elimina una carpeta, su contenido pasa a la carpeta superior
+func eliminarCarpeta(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	folderID := req.Form.Get("id")
+
+	// Logs
+	utils.LogInfo("eliminarCarpeta", "user", peekUserFromSession(token), "folder", folderID)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if errDelete := database.DeleteFolder(email, folderID); errDelete != nil {
+		responseOrganizacionError(w, errDelete)
+	} else {
+		response(w, 200, "")
+	}
+}
+
+// Crea una etiqueta
+func crearEtiqueta(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	nombre := req.Form.Get("nombre")
+
+	// Logs
+	utils.LogInfo("crearEtiqueta", "user", peekUserFromSession(token))
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if tagID, errCreate := database.CreateTag(email, nombre); errCreate != nil {
+		responseOrganizacionError(w, errCreate)
+	} else {
+		response(w, 201, tagID)
+	}
+}
+
+// Cambia el nombre de una etiqueta
+func renombrarEtiqueta(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	tagID := req.Form.Get("id")
+	nombre := req.Form.Get("nombre")
+
+	// Logs
+	utils.LogInfo("renombrarEtiqueta", "user", peekUserFromSession(token), "tag", tagID)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if errUpdate := database.RenameTag(email, tagID, nombre); errUpdate != nil {
+		responseOrganizacionError(w, errUpdate)
+	} else {
+		response(w, 200, "")
+	}
+}
+
+// Elimina una etiqueta y la quita de las entradas que la tenían
+func eliminarEtiqueta(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	tagID := req.Form.Get("id")
+
+	// Logs
+	utils.LogInfo("eliminarEtiqueta", "user", peekUserFromSession(token), "tag", tagID)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if errDelete := database.DeleteTag(email, tagID); errDelete != nil {
+		responseOrganizacionError(w, errDelete)
+	} else {
+		response(w, 200, "")
+	}
+}
+
+// responseOrganizacionError responde con el código http adecuado
+// a los errores de carpetas y etiquetas
+func responseOrganizacionError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "user not found", "folder not found", "tag not found":
+		response(w, 404, "") // (404 - Not found)
+	case "invalid parent":
+		response(w, 409, "") // (409 - Conflict)
+	default:
+		response(w, 500, "") // (500 - Internal Server Error)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+	"github.com/bertus193/gestorSDS/server/database"
+	"github.com/bertus193/gestorSDS/utils"
+)
+
+// purgarPapelera elimina las entradas caducadas de todas las papeleras
+func purgarPapelera() {
+	limite := time.Now().AddDate(0, 0, -config.TrashRetentionDays)
+	for email, count := range database.PurgeTrash(limite) {
+		detalles := map[string]string{"entries": strconv.Itoa(count)}
+		utils.LogInfo("purgarPapelera", "user", email, "entries", count)
+		utils.AddAudit(utils.AuditTrashPurged, email, "", detalles)
+		database.AddActivity(email, utils.AuditTrashPurged, "", detalles)
+	}
+}
+
+// Recupera las entradas (cifradas) de la papelera del usuario
+func papeleraUsuario(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+
+	// Logs
+	utils.LogInfo("papeleraUsuario", "user", peekUserFromSession(token))
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if papelera, errRead := database.ReadTrash(email); errRead != nil {
+		response(w, 404, "") // (404 - Not found)
+	} else if papeleraJSON, errJSON := json.Marshal(papelera); errJSON != nil {
+		response(w, 500, "") // (500 - Internal Server Error)
+	} else {
+		response(w, 200, string(papeleraJSON))
+	}
+}
+
+// Devuelve una entrada de la papelera a la bóveda
+func restaurarDePapelera(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+	entryID := req.Form.Get("id")
+
+	// Logs
+	utils.LogInfo("restaurarDePapelera", "user", peekUserFromSession(token), "entry", entryID)
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if errRestore := database.RestoreTrashEntry(email, entryID); errRestore != nil {
+
+		// Si ha ocurrido un error al restaurar, comprobamos
+		// el error y respondemos con el código http adecuado
+		switch errRestore.Error() {
+		case "user not found":
+			response(w, 404, "") // (404 - Not found)
+		case "entry not found":
+			response(w, 404, "") // (404 - Not found)
+		case "entry already exists":
+			response(w, 409, "") // (409 - Conflict)
+		default:
+			response(w, 500, "") // (500 - Internal Server Error)
+		}
+
+	} else {
+		registrarEvento(req, utils.AuditTrashRestored, email, map[string]string{"entry": entryID})
+		response(w, 200, "")
+	}
+}
+
+// Elimina definitivamente todas las entradas de la papelera del usuario
+func vaciarPapelera(w http.ResponseWriter, req *http.Request) {
+	// Parseamos el formulario
+	req.ParseForm()
+
+	// Recuperamos los datos
+	token := req.Form.Get("token")
+
+	// Logs
+	utils.LogInfo("vaciarPapelera", "user", peekUserFromSession(token))
+
+	// Cabecera estándar
+	w.Header().Set("Content-Type", "text/plain")
+
+	// Respondemos
+	if email, errSession := GetUserFromSession(token); errSession != nil {
+		// La sesión ha caducado o no es valida
+		response(w, 401, "") // (401 - Unauthorized)
+	} else if count, errEmpty := database.EmptyTrash(email); errEmpty != nil {
+		response(w, 404, "") // (404 - Not found)
+	} else {
+		registrarEvento(req, utils.AuditTrashEmptied, email, map[string]string{"entries": strconv.Itoa(count)})
+		response(w, 200, strconv.Itoa(count))
+	}
+}
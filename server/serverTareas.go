@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+)
+
+// Las tareas periódicas (purga de la papelera, avisos de caducidad...) se
+// ejecutan en segundo plano y no deben coincidir con ninguna petición (las
+// peticiones pueden seguir atendiéndose a la vez)
+var tareasMutex sync.RWMutex
+var tareasStop chan struct{}
+
+// bloqueoTareas atiende las peticiones mientras no se está ejecutando ninguna tarea
+func bloqueoTareas(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tareasMutex.RLock()
+		defer tareasMutex.RUnlock()
+		h.ServeHTTP(w, req)
+	})
+}
+
+// startTareas lanza las tareas periódicas del servidor:
+//   - purga de las entradas que llevan más de config.TrashRetentionDays en la papelera
+//   - correo con las entradas a punto de caducar (solo los avisos compartidos)
+//   - copia de seguridad de la base de datos en config.BackupDir
+func startTareas() {
+	tareasStop = make(chan struct{})
+	programarTarea(time.Duration(config.TrashPurgeInterval)*time.Second, purgarPapelera)
+	programarTarea(time.Duration(config.ExpiryDigestCheckInterval)*time.Second, enviarResumenCaducidad)
+	programarTarea(time.Duration(config.BackupInterval)*time.Second, copiaSeguridadProgramada)
+}
+
+// stopTareas detiene las tareas en segundo plano
+func stopTareas() {
+	if tareasStop != nil {
+		close(tareasStop)
+		tareasStop = nil
+	}
+}
+
+// programarTarea ejecuta la tarea al arrancar y después cada intervalo
+func programarTarea(intervalo time.Duration, tarea func()) {
+	ejecutar := func() {
+		tareasMutex.Lock()
+		defer tareasMutex.Unlock()
+		tarea()
+	}
+	ejecutar()
+
+	stop := tareasStop
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ejecutar()
+			}
+		}
+	}()
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+)
+
+// Tipos de evento registrados en el log de auditoría
+const (
+	AuditRegister          = "register"
+	AuditLogin             = "login"
+	AuditLoginFailed       = "login_failed"
+	AuditA2FResolved       = "2fa_resolved"
+	AuditA2FFailed         = "2fa_failed"
+	AuditA2FEnabled        = "2fa_enabled"
+	AuditA2FDisabled       = "2fa_disabled"
+	AuditLanguageChanged   = "language_changed"
+	AuditEntryCreated      = "entry_created"
+	AuditEntryRead         = "entry_read"
+	AuditEntryDeleted      = "entry_deleted"
+	AuditEntryUpdated      = "entry_updated"
+	AuditVaultRead         = "vault_read"
+	AuditEntryRestored     = "entry_restored"
+	AuditTrashRestored     = "trash_restored"
+	AuditTrashEmptied      = "trash_emptied"
+	AuditTrashPurged       = "trash_purged"
+	AuditAttachmentAdded   = "attachment_added"
+	AuditAttachmentRead    = "attachment_read"
+	AuditAttachmentDeleted = "attachment_deleted"
+	AuditExpiryDigest      = "expiry_digest_sent"
+	AuditAccountDelete     = "account_deleted"
+	AuditNewDevice         = "new_device"
+	AuditRevoked           = "sessions_revoked"
+	AuditBackupCreated     = "backup_created"
+	AuditBackupRestored    = "backup_restored"
+	AuditDBMigrated        = "db_migrated"
+)
+
+// AuditRecord es cada uno de los registros del log de auditoría.
+// Prev contiene el HMAC del registro anterior, de forma que cualquier
+// modificación o eliminación rompe la cadena.
+type AuditRecord struct {
+	Seq     int
+	Time    time.Time
+	Event   string
+	User    string
+	IP      string
+	Details map[string]string `json:",omitempty"`
+	Prev    string
+	HMAC    string
+}
+
+// auditHead guarda el último eslabón de la cadena para detectar truncados
+type auditHead struct {
+	Seq  int
+	HMAC string
+	Mac  string
+}
+
+var auditMutex sync.Mutex
+var auditLast *auditHead
+
+// auditFile es el fichero del log de auditoría (una línea JSON por registro)
+func auditFile() string {
+	return config.AuditDir + "audit.log"
+}
+
+// auditHeadFile es el fichero con el último eslabón de la cadena
+func auditHeadFile() string {
+	return config.AuditDir + "audit.head"
+}
+
+// AddAudit añade un evento de seguridad al log de auditoría
+func AddAudit(event string, user string, ip string, details map[string]string) {
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	if auditLast == nil {
+		if head, err := readAuditHead(); err == nil {
+			auditLast = head
+		} else {
+			auditLast = &auditHead{}
+		}
+	}
+
+	record := AuditRecord{
+		Seq:     auditLast.Seq + 1,
+		Time:    time.Now().UTC(),
+		Event:   event,
+		User:    user,
+		IP:      ip,
+		Details: details,
+		Prev:    auditLast.HMAC,
+	}
+	record.HMAC = auditRecordMAC(record)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		LogError("audit", "error", err.Error())
+		return
+	}
+
+	if _, err := os.Stat(config.AuditDir); os.IsNotExist(err) {
+		os.MkdirAll(config.AuditDir, 0700)
+	}
+	file, err := os.OpenFile(auditFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		LogError("audit", "error", err.Error())
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		LogError("audit", "error", err.Error())
+		return
+	}
+	file.Sync()
+
+	auditLast = &auditHead{Seq: record.Seq, HMAC: record.HMAC}
+	writeAuditHead(auditLast)
+}
+
+// VerifyAudit recorre el log de auditoría comprobando la cadena de HMAC.
+// Devuelve el número de registros válidos y el primer error encontrado.
+func VerifyAudit() (int, error) {
+	file, err := os.Open(auditFile())
+	if os.IsNotExist(err) {
+		if _, errHead := os.Stat(auditHeadFile()); errHead == nil {
+			return 0, errors.New("audit log missing")
+		}
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	prev := ""
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record AuditRecord
+		if errJSON := json.Unmarshal(scanner.Bytes(), &record); errJSON != nil {
+			return count, errors.New("record " + strconv.Itoa(count+1) + ": unreadable")
+		}
+		if record.Seq != count+1 {
+			return count, errors.New("record " + strconv.Itoa(count+1) + ": unexpected sequence " + strconv.Itoa(record.Seq))
+		}
+		if record.Prev != prev {
+			return count, errors.New("record " + strconv.Itoa(record.Seq) + ": broken chain")
+		}
+		if !hmac.Equal([]byte(record.HMAC), []byte(auditRecordMAC(record))) {
+			return count, errors.New("record " + strconv.Itoa(record.Seq) + ": modified")
+		}
+		prev = record.HMAC
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, err
+	}
+
+	// El último registro debe coincidir con la cabecera (detecta truncados)
+	head, errHead := readAuditHead()
+	if errHead != nil {
+		return count, errors.New("audit head: " + errHead.Error())
+	}
+	if head.Seq != count || head.HMAC != prev {
+		return count, errors.New("truncated: expected " + strconv.Itoa(head.Seq) + " records")
+	}
+	return count, nil
+}
+
+// auditRecordMAC calcula el HMAC de un registro (sin el propio campo HMAC)
+func auditRecordMAC(record AuditRecord) string {
+	record.HMAC = ""
+	data, _ := json.Marshal(record)
+	return auditMAC(data)
+}
+
+func auditMAC(data []byte) string {
+	mac := hmac.New(sha256.New, config.PassAudit)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func readAuditHead() (*auditHead, error) {
+	var head auditHead
+	data, err := ioutil.ReadFile(auditHeadFile())
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(head.Mac), []byte(auditMAC([]byte(strconv.Itoa(head.Seq)+":"+head.HMAC)))) {
+		return nil, errors.New("invalid head")
+	}
+	return &head, nil
+}
+
+func writeAuditHead(head *auditHead) {
+	head.Mac = auditMAC([]byte(strconv.Itoa(head.Seq) + ":" + head.HMAC))
+	if data, err := json.Marshal(head); err == nil {
+		tmp := auditHeadFile() + ".tmp"
+		if ioutil.WriteFile(tmp, data, 0600) == nil {
+			os.Rename(tmp, auditHeadFile())
+		}
+	}
+}
@@ -1,69 +1,91 @@
 package utils
 
 import (
-	"log"
-	"net/smtp"
+	"bytes"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
 
 	"github.com/bertus193/gestorSDS/config"
 )
 
 // SendWelcome envía un correo electrónico de bienvenida
 // a la dirección indicada (sin uso).
-func SendWelcome(sendTo string) {
-
-	subject := "Te damos la bienvenida a " + config.AppName
-	body := "Gracias por crear una cuenta de " + config.AppName + ".\n" +
-		"Ya puedes empezar a utilizar la aplicación usando tu correo y contraseña para iniciar sesión.\n\n" +
-		"Gracias, \n" +
-		"El equipo de cuentas de " + config.AppName + "."
-
-	sendEmail(sendTo, subject, body)
+func SendWelcome(sendTo string, lang string) {
+	SendTemplateEmail(sendTo, lang, EmailWelcome, nil)
 }
 
 // Send2FACode envía un correo electrónico a la dirección indicada
 // con la información necesaria para iniciar sesión usando 2FA
-func Send2FACode(sendTo string, authCode string) {
-
-	subject := "Código de seguridad de inicio de sesión en " + config.AppName
-	body := "Se ha realizado un inicio de sesión en su cuenta. \n\n" +
-		"Use el siguiente código de seguridad para continuar. \n" +
-		"Código de seguridad: " + authCode + "\n\n" +
-		"Si no has iniciado sesión recientemente, es posible que su contraseña haya sido comprometida. \n" +
-		"Pongase en contacto con nosotros lo antes posible para solucionarlo. \n\n" +
-		"Gracias, \n" +
-		"El equipo de cuentas de " + config.AppName + "."
-
-	sendEmail(sendTo, subject, body)
+func Send2FACode(sendTo string, lang string, authCode string) {
+	SendTemplateEmail(sendTo, lang, Email2FACode, map[string]string{"Code": authCode})
 }
 
-func sendEmail(sendTo string, subject string, body string) {
+// NewEmailMessage crea un correo con fecha e identificador propios
+func NewEmailMessage(sendTo string, subject string, text string, html string) EmailMessage {
+	idRaw, _ := GenerateRandomBytes(16)
+	domain := "localhost"
+	if at := strings.LastIndex(config.Account2FA["email"], "@"); at >= 0 {
+		domain = config.Account2FA["email"][at+1:]
+	}
+	return EmailMessage{
+		To:        sendTo,
+		Subject:   subject,
+		Text:      text,
+		HTML:      html,
+		Date:      time.Now(),
+		MessageID: "<" + strings.TrimRight(strings.NewReplacer("+", "-", "/", "_").Replace(EncodeBase64(idRaw)), "=") + "@" + domain + ">",
+	}
+}
 
-	from := config.Account2FA["email"]
-	pass := config.Account2FA["passw"]
-	smtpServer := config.Account2FA["smtpServer"]
-	smtpPort := config.Account2FA["smtpPort"]
+// BuildMIMEMessage construye el mensaje completo (cabeceras y cuerpo) en
+// formato MIME, con una parte HTML alternativa si el correo la incluye
+func BuildMIMEMessage(from string, msg EmailMessage) []byte {
+	var b bytes.Buffer
 
-	msg := "From: " + from + "\n" +
-		"To: " + sendTo + "\n" +
-		"Subject: " + subject + "\n\n" +
-		body
+	fromAddr := mail.Address{Name: loadBranding().AppName, Address: from}
+	toAddr := mail.Address{Address: msg.To}
+	b.WriteString("From: " + fromAddr.String() + "\r\n")
+	b.WriteString("To: " + toAddr.String() + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + msg.Date.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("Message-ID: " + msg.MessageID + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
 
-	if config.EmailDebug == true {
-		// Mostramos en terminal
-		log.Println(sendTo)
-		log.Println(subject)
-		log.Println(body)
-	} else {
-		// Enviamos el correo
-		err := smtp.SendMail(smtpServer+":"+smtpPort,
-			smtp.PlainAuth("", from, pass, smtpServer),
-			from, []string{sendTo}, []byte(msg))
+	if msg.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writeQuotedPrintable(&b, msg.Text)
+		return b.Bytes()
+	}
 
-		if err != nil {
-			log.Printf("smtp error: %s", err)
-			return
-		}
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	b.WriteString("Content-Type: multipart/alternative; boundary=\"" + parts.Boundary() + "\"\r\n\r\n")
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		w, _ := parts.CreatePart(header)
+		var encoded bytes.Buffer
+		writeQuotedPrintable(&encoded, part.content)
+		w.Write(encoded.Bytes())
 	}
+	parts.Close()
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
 
-	log.Print("email sent")
+// writeQuotedPrintable codifica el texto con saltos de línea CRLF
+func writeQuotedPrintable(b *bytes.Buffer, text string) {
+	qp := quotedprintable.NewWriter(b)
+	qp.Write([]byte(strings.Replace(strings.Replace(text, "\r\n", "\n", -1), "\n", "\r\n", -1)))
+	qp.Close()
 }
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/bertus193/gestorSDS/config"
+)
+
+// Plantillas de correo incluidas en el ejecutable, se pueden sustituir
+// sin recompilar dejando un fichero con la misma ruta en config.EmailTemplatesDir
+//
+//go:embed templates/email
+var embeddedTemplates embed.FS
+
+// Plantillas de correo disponibles
+const (
+	EmailWelcome        = "welcome"
+	Email2FACode        = "2fa_code"
+	EmailNewDeviceLogin = "new_device_login"
+	Email2FAEnabled     = "2fa_enabled"
+	Email2FADisabled    = "2fa_disabled"
+	EmailAccountDeleted = "account_deleted"
+	EmailExpiryDigest   = "expiry_digest"
+)
+
+// SupportedLanguages son los idiomas de las plantillas de correo
+var SupportedLanguages = []string{"es", "en"}
+
+// Branding contiene los datos de la marca que se muestran en los correos
+type Branding struct {
+	AppName      string
+	SupportEmail string
+	Color        string
+	LogoURL      string
+}
+
+// emailTemplateData son los datos disponibles en las plantillas
+type emailTemplateData struct {
+	Lang       string
+	Brand      Branding
+	Data       map[string]string
+	Subject    string
+	Paragraphs [][]string
+}
+
+// SendTemplateEmail genera el correo a partir de la plantilla indicada, en el
+// idioma del usuario, y lo deja en la bandeja de salida
+func SendTemplateEmail(sendTo string, lang string, name string, data map[string]string) {
+	if msg, err := RenderEmail(sendTo, lang, name, data); err != nil {
+		LogError("sendTemplateEmail", "user", sendTo, "template", name, "error", err.Error())
+	} else if err := QueueEmail(msg); err != nil {
+		LogError("sendTemplateEmail", "user", sendTo, "template", name, "error", err.Error())
+	}
+}
+
+// RenderEmail construye el correo (asunto, texto y HTML) de una plantilla
+func RenderEmail(sendTo string, lang string, name string, data map[string]string) (EmailMessage, error) {
+	lang = NormalizeLanguage(lang)
+	tplData := emailTemplateData{Lang: lang, Brand: loadBranding(), Data: data}
+
+	// Asunto y texto plano
+	textTpl := template.New(name)
+	for _, file := range []string{lang + "/base.txt", lang + "/" + name + ".txt"} {
+		content, err := readEmailTemplate(file)
+		if err != nil {
+			return EmailMessage{}, err
+		}
+		if _, err := textTpl.Parse(content); err != nil {
+			return EmailMessage{}, err
+		}
+	}
+	var subject, text bytes.Buffer
+	if err := textTpl.ExecuteTemplate(&subject, "subject", tplData); err != nil {
+		return EmailMessage{}, err
+	}
+	if err := textTpl.ExecuteTemplate(&text, "text", tplData); err != nil {
+		return EmailMessage{}, err
+	}
+	tplData.Subject = strings.TrimSpace(subject.String())
+
+	// HTML: plantilla propia si existe o el diseño común con los párrafos del texto
+	htmlContent, err := readEmailTemplate(lang + "/" + name + ".html")
+	if err != nil {
+		if htmlContent, err = readEmailTemplate("layout.html"); err != nil {
+			return EmailMessage{}, err
+		}
+	}
+	for _, paragraph := range strings.Split(strings.TrimSpace(text.String()), "\n\n") {
+		tplData.Paragraphs = append(tplData.Paragraphs, strings.Split(strings.TrimSpace(paragraph), "\n"))
+	}
+	htmlTpl, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap{
+		"isURL": func(s string) bool { return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://") },
+	}).Parse(htmlContent)
+	if err != nil {
+		return EmailMessage{}, err
+	}
+	var html bytes.Buffer
+	if err := htmlTpl.Execute(&html, tplData); err != nil {
+		return EmailMessage{}, err
+	}
+
+	return NewEmailMessage(sendTo, tplData.Subject, strings.TrimSpace(text.String()), html.String()), nil
+}
+
+// NormalizeLanguage devuelve el idioma indicado si hay plantillas para él,
+// o el idioma por defecto en caso contrario
+func NormalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	for _, l := range SupportedLanguages {
+		if l == lang {
+			return l
+		}
+	}
+	return config.DefaultLanguage
+}
+
+// readEmailTemplate lee una plantilla, dando prioridad a la carpeta del operador
+func readEmailTemplate(file string) (string, error) {
+	if content, err := ioutil.ReadFile(config.EmailTemplatesDir + file); err == nil {
+		return string(content), nil
+	}
+	content, err := embeddedTemplates.ReadFile("templates/email/" + file)
+	return string(content), err
+}
+
+// loadBranding recupera la marca de "branding.json" (del operador si existe)
+func loadBranding() Branding {
+	brand := Branding{}
+	if content, err := readEmailTemplate("branding.json"); err == nil {
+		json.Unmarshal([]byte(content), &brand)
+	}
+	if brand.AppName == "" {
+		brand.AppName = config.AppName
+	}
+	if brand.Color == "" {
+		brand.Color = "#1565c0"
+	}
+	return brand
+}
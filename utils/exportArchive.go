@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Identificación y parámetros de los ficheros de exportación cifrados
+const (
+	formatoExportacion = "gestorSDS-export"
+	versionExportacion = 1
+	exportScryptN      = 1 << 15
+	exportScryptR      = 8
+	exportScryptP      = 1
+)
+
+// cabeceraExportacion es la parte en claro de una exportación cifrada: lo
+// necesario para derivar la clave de la contraseña (scrypt) y descifrar el
+// contenido (AES-256-GCM). Va autenticada como datos adicionales del AEAD,
+// así que no se puede cambiar sin que falle el descifrado
+type cabeceraExportacion struct {
+	Formato string `json:"format"`
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Cifrado string `json:"cipher"`
+	Nonce   []byte `json:"nonce"`
+}
+
+// ficheroExportacion es el fichero completo: la cabecera y el contenido cifrado
+type ficheroExportacion struct {
+	cabeceraExportacion
+	Datos []byte `json:"data"`
+}
+
+// SealExportArchive cifra el contenido de una exportación con una clave
+// derivada de la contraseña, independiente de la de la cuenta
+func SealExportArchive(password string, contenido []byte) ([]byte, error) {
+	salt, err := GenerateRandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	cabecera := cabeceraExportacion{
+		Formato: formatoExportacion,
+		Version: versionExportacion,
+		KDF:     "scrypt",
+		N:       exportScryptN,
+		R:       exportScryptR,
+		P:       exportScryptP,
+		Salt:    salt,
+		Cifrado: "AES-256-GCM",
+	}
+	aead, err := aeadExportacion(password, cabecera)
+	if err != nil {
+		return nil, err
+	}
+	if cabecera.Nonce, err = GenerateRandomBytes(aead.NonceSize()); err != nil {
+		return nil, err
+	}
+	adicionales, _ := json.Marshal(cabecera)
+
+	fichero := ficheroExportacion{cabecera, aead.Seal(nil, cabecera.Nonce, contenido, adicionales)}
+	return json.MarshalIndent(fichero, "", "  ")
+}
+
+// OpenExportArchive descifra una exportación cifrada con SealExportArchive
+func OpenExportArchive(password string, datos []byte) ([]byte, error) {
+	var fichero ficheroExportacion
+	if err := json.Unmarshal(datos, &fichero); err != nil || fichero.Formato != formatoExportacion {
+		return nil, errors.New("invalid file")
+	}
+	cabecera := fichero.cabeceraExportacion
+	if cabecera.Version != versionExportacion || cabecera.KDF != "scrypt" || cabecera.Cifrado != "AES-256-GCM" {
+		return nil, errors.New("unsupported version")
+	}
+	aead, err := aeadExportacion(password, cabecera)
+	if err != nil || len(cabecera.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid file")
+	}
+	adicionales, _ := json.Marshal(cabecera)
+
+	contenido, err := aead.Open(nil, cabecera.Nonce, fichero.Datos, adicionales)
+	if err != nil {
+		// Contraseña incorrecta o fichero modificado
+		return nil, errors.New("wrong password")
+	}
+	return contenido, nil
+}
+
+// aeadExportacion deriva la clave de la contraseña con los parámetros de la
+// cabecera y devuelve el cifrador
+func aeadExportacion(password string, cabecera cabeceraExportacion) (cipher.AEAD, error) {
+	// Límites para que un fichero manipulado no pueda pedir una derivación
+	// desproporcionada (memoria = 128 * N * r bytes, tiempo proporcional a
+	// N * r * p): como mucho cuatro veces lo que escribe SealExportArchive
+	if cabecera.N < 2 || cabecera.N > exportScryptN<<2 || cabecera.R < 1 || cabecera.R > exportScryptR ||
+		cabecera.P < 1 || cabecera.P > 4 {
+		return nil, errors.New("invalid file")
+	}
+	clave, err := scrypt.Key([]byte(password), cabecera.Salt, cabecera.N, cabecera.R, cabecera.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	bloque, err := aes.NewCipher(clave)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(bloque)
+}
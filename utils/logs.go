@@ -1,126 +1,350 @@
 package utils
 
 import (
+	"bufio"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bertus193/gestorSDS/config"
 )
 
-var logFile *os.File
-var logSlice []string
-var path string
+// LogsDir carpeta donde se guardan los ficheros de log del servidor
+const LogsDir = "./server/logs/"
 
-var firstLog = false
+var logWriter *rotatingWriter
+var logger *slog.Logger
 
-//init iniciar servidor (automaticamente llama a init)
+// init iniciar servidor (automaticamente llama a init)
 func init() {
-	logFile = newLogFile()
+	logWriter = &rotatingWriter{}
+	logger = slog.New(&logHandler{
+		level:   parseLogLevel(config.LogLevel),
+		file:    slog.NewJSONHandler(logWriter, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		console: slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	})
 }
 
-//AddLog Nueva linea al log
+// AddLog Nueva linea al log (nivel INFO)
 func AddLog(logMessage string) {
-	log.Println(logMessage)
+	LogInfo(logMessage)
+}
+
+// LogDebug guarda un mensaje de depuración junto a sus atributos (clave, valor)
+func LogDebug(msg string, args ...interface{}) {
+	logger.Debug(msg, args...)
+}
+
+// LogInfo guarda un mensaje informativo junto a sus atributos (clave, valor)
+func LogInfo(msg string, args ...interface{}) {
+	logger.Info(msg, args...)
+}
+
+// LogWarn guarda un aviso junto a sus atributos (clave, valor)
+func LogWarn(msg string, args ...interface{}) {
+	logger.Warn(msg, args...)
+}
 
-	date := time.Now().Format("2006-01-02 15:04:05")
-	if firstLog == false {
-		logSlice = append(logSlice, "\n"+date+" log:")
-		firstLog = true
+// LogError guarda un error junto a sus atributos (clave, valor)
+func LogError(msg string, args ...interface{}) {
+	logger.Error(msg, args...)
+}
+
+// parseLogLevel traduce el nivel indicado en la configuración
+func parseLogLevel(level string) slog.Level {
+	var result slog.Level
+	if err := result.UnmarshalText([]byte(level)); err != nil {
+		result = slog.LevelInfo
 	}
-	logMessage = date + " " + logMessage
-	logSlice = append(logSlice, logMessage)
+	return result
+}
 
+// logHandler envía cada registro al fichero (JSON) y a la terminal (texto)
+type logHandler struct {
+	level   slog.Level
+	file    slog.Handler
+	console slog.Handler
 }
 
-//NewLogFile Nuevo fichero log
-func newLogFile() *os.File {
-	var result []string
-	currentDay := time.Now().Local().Format("2006-01-02")
+func (h *logHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
 
-	//Crear carpeta logs si no existe
-	if _, err := os.Stat("./server/logs"); os.IsNotExist(err) {
-		os.Mkdir("./server/logs", 0777)
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	err := h.file.Handle(ctx, r)
+	h.console.Handle(ctx, r)
+	return err
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{h.level, h.file.WithAttrs(attrs), h.console.WithAttrs(attrs)}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{h.level, h.file.WithGroup(name), h.console.WithGroup(name)}
+}
+
+// rotatingWriter escribe las líneas de log en el fichero del día,
+// rotándolo cuando cambia la fecha o se supera el tamaño máximo
+type rotatingWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	day  string
+	size int64
+}
+
+// Write añade una línea (un registro JSON) al fichero actual, cifrándola si procede
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line := p
+	if config.EncryptLogs == true {
+		line = []byte(EncodeBase64(EncryptAES([]byte(strings.TrimRight(string(p), "\n")), config.PassEncryptLogs)) + "\n")
+	}
+
+	currentDay := time.Now().Local().Format("2006-01-02")
+	if w.file == nil || w.day != currentDay {
+		w.open(currentDay)
+	} else if w.size+int64(len(line)) > config.LogMaxSize {
+		w.rotate()
+	}
+	if w.file == nil {
+		return 0, os.ErrInvalid
 	}
 
-	path = "./server/logs/" + currentDay + ".log"
-	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+	n, err := w.file.Write(line)
+	w.size += int64(n)
 	if err != nil {
-		log.Printf("error opening file: %v", err)
-	} else {
-		bytesEntrada, err := ioutil.ReadFile(path)
-		if err != nil {
-			log.Println("Error lectura fichero logs")
-		} else if len(string(bytesEntrada)) > 0 {
+		return 0, err
+	}
+	return len(p), nil
+}
 
-			if config.EncryptLogs == true {
+// open cierra el fichero actual y abre (en modo append) el del día indicado
+func (w *rotatingWriter) open(day string) {
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file = newLogFile(day)
+	w.day = day
+	w.size = 0
+	if w.file != nil {
+		if info, err := w.file.Stat(); err == nil {
+			w.size = info.Size()
+		}
+	}
+	cleanOldLogs()
+}
 
-			}
-			if err := json.Unmarshal(bytesEntrada, &result); err != nil {
-				bytesEntrada = DecryptAES(bytesEntrada, config.PassEncryptLogs)
-				if err := json.Unmarshal(bytesEntrada, &result); err != nil {
-					panic(err)
-				}
-			}
-			logSlice = result
+// rotate renombra el fichero del día a "<fecha>.<n>.log" y empieza uno nuevo
+func (w *rotatingWriter) rotate() {
+	w.file.Close()
+	w.file = nil
+	os.Rename(LogsDir+w.day+".log", rotatedLogPath(w.day))
+	w.open(w.day)
+}
+
+// rotatedLogPath devuelve el primer "<fecha>.<n>.log" libre del día
+func rotatedLogPath(day string) string {
+	for n := 1; ; n++ {
+		rotated := LogsDir + day + "." + strconv.Itoa(n) + ".log"
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			return rotated
 		}
 	}
+}
+
+// close cierra el fichero actual
+func (w *rotatingWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		w.file.Sync()
+		w.file.Close()
+		w.file = nil
+	}
+}
+
+// NewLogFile Nuevo fichero log del día indicado. Si ya existe un fichero del
+// día con el formato anterior (un array JSON), se aparta como una rotación
+// para no mezclar los dos formatos en el mismo fichero
+func newLogFile(day string) *os.File {
+	//Crear carpeta logs si no existe
+	if _, err := os.Stat(LogsDir); os.IsNotExist(err) {
+		os.MkdirAll(LogsDir, 0777)
+	}
 
+	path := LogsDir + day + ".log"
+	if !isLineLogFile(path) {
+		os.Rename(path, rotatedLogPath(day))
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		log.Printf("error opening file: %v", err)
+		return nil
+	}
 	return file
 }
 
-//LaunchLogger Iniciar Desencriptación logs
-func LaunchLogger(inputFile string, outputFile string) {
+// isLineLogFile indica si el fichero (si existe) tiene el formato actual,
+// un registro por línea: basta con comprobar la primera
+func isLineLogFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		// Fichero vacío
+		return true
+	}
+	_, ok := ReadLogLine(line)
+	return ok
+}
+
+// ListLogFiles devuelve los ficheros de log diarios (y sus rotaciones)
+// ordenados de más antiguo a más reciente
+func ListLogFiles() []string {
 	var result []string
-	log.Println("Desencriptando fichero...")
+	files, _ := filepath.Glob(LogsDir + "????-??-??*.log")
+	for _, f := range files {
+		if _, err := time.Parse("2006-01-02", logFileDay(f)); err == nil {
+			result = append(result, f)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		di, dj := logFileDay(result[i]), logFileDay(result[j])
+		if di != dj {
+			return di < dj
+		}
+		// Dentro del mismo día, las rotaciones (.1, .2...) van antes que el fichero activo
+		return logFileIndex(result[i]) < logFileIndex(result[j])
+	})
+	return result
+}
 
-	//Crear carpeta logs si no existe
-	if _, err := os.Stat("./server/logs/"); os.IsNotExist(err) {
-		os.Mkdir("./server/logs/", 644)
+// logFileDay extrae la fecha del nombre de un fichero de log
+func logFileDay(path string) string {
+	name := filepath.Base(path)
+	if len(name) < 10 {
+		return ""
 	}
+	return name[:10]
+}
 
-	input, err := ioutil.ReadFile("./server/logs/" + inputFile)
-	if err != nil {
-		log.Println("El fichero introducido no existe")
-	} else {
+// logFileIndex devuelve el número de rotación de un fichero de log,
+// el fichero activo del día se considera el último
+func logFileIndex(path string) int {
+	parts := strings.Split(filepath.Base(path), ".")
+	if len(parts) == 3 {
+		if n, err := strconv.Atoi(parts[1]); err == nil {
+			return n
+		}
+	}
+	return int(^uint(0) >> 1)
+}
 
-		if err := json.Unmarshal(input, &result); err != nil {
-			input = DecryptAES(input, config.PassEncryptLogs)
-			if err := json.Unmarshal(input, &result); err != nil {
-				panic(err)
-			}
+// cleanOldLogs elimina los ficheros que superan los límites de retención
+func cleanOldLogs() {
+	files := ListLogFiles()
+	limit := time.Now().AddDate(0, 0, -config.LogMaxAgeDays).Format("2006-01-02")
+	for i, f := range files {
+		if logFileDay(f) < limit || len(files)-i > config.LogMaxFiles {
+			os.Remove(f)
 		}
+	}
+}
 
-		output, err := os.Create("./server/logs/" + outputFile)
-		if err != nil {
-			log.Println("error opening file: %v", err)
-		} else {
-			for i := 0; i < len(result); i++ {
-				output.Write([]byte(result[i] + "\n"))
-			}
-			log.Println("El fichero \"/server/logs/" + outputFile + "\" ha sido creado correctamente")
+// ReadLogLine recupera el registro JSON de una línea de log,
+// descifrándola si es necesario
+func ReadLogLine(line string) (map[string]interface{}, bool) {
+	var result map[string]interface{}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, false
+	}
+	if err := json.Unmarshal([]byte(line), &result); err == nil {
+		return result, true
+	}
+	data, err := base64.StdEncoding.DecodeString(line)
+	if err != nil || len(data) < 16 {
+		return nil, false
+	}
+	if err := json.Unmarshal(DecryptAES(data, config.PassEncryptLogs), &result); err != nil {
+		return nil, false
+	}
+	return result, true
+}
+
+// readLegacyLogFile recupera los mensajes de un fichero con el formato
+// anterior (un único array JSON, cifrado o no, escrito al apagar el servidor)
+func readLegacyLogFile(input []byte) ([]string, bool) {
+	var result []string
+	if err := json.Unmarshal(input, &result); err != nil {
+		if len(input) < 16 {
+			return nil, false
+		}
+		if err := json.Unmarshal(DecryptAES(input, config.PassEncryptLogs), &result); err != nil {
+			return nil, false
 		}
 	}
+	return result, true
 }
 
-//AfterLogs guardar logs
-func AfterLogs() {
+// LaunchLogger Iniciar Desencriptación logs
+func LaunchLogger(inputFile string, outputFile string) {
+	log.Println("Desencriptando fichero...")
 
-	logFile, err := os.Create(path)
-	if err != nil {
-		panic(0)
+	//Crear carpeta logs si no existe
+	if _, err := os.Stat(LogsDir); os.IsNotExist(err) {
+		os.MkdirAll(LogsDir, 0777)
 	}
 
-	j, err := json.Marshal(logSlice)
+	input, err := ioutil.ReadFile(LogsDir + inputFile)
+	if err != nil {
+		log.Println("El fichero introducido no existe")
+		return
+	}
 
+	output, err := os.Create(LogsDir + outputFile)
 	if err != nil {
-		log.Println(err)
-	} else if config.EncryptLogs == true {
-		bytesSalida := EncryptAES(j, config.PassEncryptLogs)
-		logFile.Write(bytesSalida)
+		log.Printf("error opening file: %v", err)
+		return
+	}
+	defer output.Close()
+
+	if legacy, ok := readLegacyLogFile(input); ok {
+		for i := 0; i < len(legacy); i++ {
+			output.Write([]byte(legacy[i] + "\n"))
+		}
 	} else {
-		logFile.Write(j)
+		scanner := bufio.NewScanner(strings.NewReader(string(input)))
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if record, ok := ReadLogLine(scanner.Text()); ok {
+				j, _ := json.Marshal(record)
+				output.Write(append(j, '\n'))
+			}
+		}
 	}
+	log.Println("El fichero \"/server/logs/" + outputFile + "\" ha sido creado correctamente")
+}
+
+// AfterLogs cierra el fichero de log actual
+func AfterLogs() {
+	logWriter.close()
 }
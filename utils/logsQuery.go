@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// logQuery contiene los filtros del comando "logs"
+type logQuery struct {
+	from   string
+	to     string
+	user   string
+	event  string
+	level  slog.Level
+	format string
+}
+
+// LaunchLogs muestra los registros de log que cumplen los filtros indicados,
+// recorriendo varios ficheros diarios (cifrados o no) y, opcionalmente,
+// siguiendo el fichero actual a medida que crece (tail -f)
+func LaunchLogs(args []string) {
+	var query logQuery
+	var level string
+	var follow bool
+
+	today := time.Now().Local().Format("2006-01-02")
+	flags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	flags.StringVar(&query.from, "from", today, "fecha inicial (AAAA-MM-DD)")
+	flags.StringVar(&query.to, "to", today, "fecha final (AAAA-MM-DD)")
+	flags.StringVar(&query.user, "user", "", "mostrar solo los registros de este usuario")
+	flags.StringVar(&query.event, "event", "", "mostrar solo este tipo de evento")
+	flags.StringVar(&level, "level", "DEBUG", "nivel mínimo (DEBUG, INFO, WARN, ERROR)")
+	flags.StringVar(&query.format, "format", "text", "formato de salida (text, json)")
+	flags.BoolVar(&follow, "f", false, "seguir el fichero actual a medida que crece (sin -to)")
+	if err := flags.Parse(args); err != nil {
+		return
+	}
+
+	// Con -f se muestran los registros hasta que se detiene, no hay fecha final
+	toSet := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "to" {
+			toSet = true
+		}
+	})
+	if follow && toSet {
+		fmt.Printf("La fecha final (-to) no se puede indicar junto con -f.\n")
+		return
+	}
+
+	if err := query.level.UnmarshalText([]byte(level)); err != nil {
+		fmt.Printf("El nivel indicado no es válido.\n")
+		return
+	}
+	if _, err := time.Parse("2006-01-02", query.from); err != nil {
+		fmt.Printf("La fecha inicial indicada no es válida.\n")
+		return
+	}
+	if _, err := time.Parse("2006-01-02", query.to); err != nil {
+		fmt.Printf("La fecha final indicada no es válida.\n")
+		return
+	}
+	if query.format != "text" && query.format != "json" {
+		fmt.Printf("El formato indicado no es válido.\n")
+		return
+	}
+
+	for _, file := range logFilesBetween(query.from, query.to) {
+		query.printFile(file)
+	}
+
+	if follow {
+		query.follow()
+	}
+}
+
+// printFile muestra los registros de un fichero completo
+func (q *logQuery) printFile(path string) {
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if legacy, ok := readLegacyLogFile(input); ok {
+		for _, line := range legacy {
+			q.print(legacyLogRecord(line))
+		}
+		return
+	}
+	q.printLines(strings.NewReader(string(input)))
+}
+
+// printLines muestra los registros de cada línea leída
+func (q *logQuery) printLines(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if record, ok := ReadLogLine(scanner.Text()); ok {
+			q.print(record)
+		}
+	}
+}
+
+// follow espera nuevas líneas en el fichero del día, teniendo en cuenta
+// las rotaciones por tamaño y el cambio de fecha. El fichero se mantiene
+// abierto: al rotarse (se renombra) o cambiar el día, se termina de leer lo
+// que se escribió en él antes de pasar al nuevo
+func (q *logQuery) follow() {
+	path := LogsDir + time.Now().Local().Format("2006-01-02") + ".log"
+	file, err := os.Open(path)
+	if err == nil {
+		file.Seek(0, io.SeekEnd)
+	} else {
+		file = nil
+	}
+	var pending string
+
+	for {
+		time.Sleep(time.Second)
+
+		currentPath := LogsDir + time.Now().Local().Format("2006-01-02") + ".log"
+		if file != nil && (currentPath != path || !sameLogFile(file, currentPath)) {
+			// Nuevo día o fichero rotado: lo que queda del anterior y se cierra
+			q.followRead(file, pending)
+			file.Close()
+			file, pending = nil, ""
+		}
+		path = currentPath
+
+		if file == nil {
+			// El nuevo fichero se lee desde el principio
+			if file, err = os.Open(path); err != nil {
+				file = nil
+				continue
+			}
+		}
+		pending = q.followRead(file, pending)
+	}
+}
+
+// followRead muestra las líneas completas escritas desde la última lectura y
+// devuelve lo que queda de la última línea, todavía sin terminar
+func (q *logQuery) followRead(file *os.File, pending string) string {
+	data, _ := ioutil.ReadAll(file)
+	pending += string(data)
+	if end := strings.LastIndex(pending, "\n"); end >= 0 {
+		q.printLines(strings.NewReader(pending[:end+1]))
+		pending = pending[end+1:]
+	}
+	return pending
+}
+
+// sameLogFile indica si la ruta sigue siendo el fichero abierto (si todavía
+// no existe el nuevo fichero tras rotar, se sigue leyendo el abierto)
+func sameLogFile(file *os.File, path string) bool {
+	openInfo, errOpen := file.Stat()
+	pathInfo, errPath := os.Stat(path)
+	if errOpen != nil || errPath != nil {
+		return errPath != nil
+	}
+	return os.SameFile(openInfo, pathInfo)
+}
+
+// print muestra un registro si cumple los filtros
+func (q *logQuery) print(record map[string]interface{}) {
+	var level slog.Level
+	levelStr, _ := record[slog.LevelKey].(string)
+	if level.UnmarshalText([]byte(levelStr)) == nil && level < q.level {
+		return
+	}
+	if q.user != "" && fmt.Sprint(record["user"]) != q.user {
+		return
+	}
+	if q.event != "" && fmt.Sprint(record[slog.MessageKey]) != q.event {
+		return
+	}
+
+	if q.format == "json" {
+		j, _ := json.Marshal(record)
+		fmt.Println(string(j))
+		return
+	}
+
+	line := fmt.Sprint(record[slog.TimeKey])
+	if t, err := time.Parse(time.RFC3339Nano, line); err == nil {
+		line = t.Local().Format("2006-01-02 15:04:05")
+	}
+	line += " " + levelStr + " " + fmt.Sprint(record[slog.MessageKey])
+	var keys []string
+	for k := range record {
+		if k != slog.TimeKey && k != slog.LevelKey && k != slog.MessageKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		line += " " + k + "=" + fmt.Sprint(record[k])
+	}
+	fmt.Println(line)
+}
+
+// legacyLogRecord convierte una línea del formato anterior ("fecha mensaje")
+// en un registro equivalente a los actuales
+func legacyLogRecord(line string) map[string]interface{} {
+	record := map[string]interface{}{
+		slog.LevelKey:   "INFO",
+		slog.MessageKey: strings.TrimSpace(line),
+	}
+	if len(line) >= 19 {
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", line[:19], time.Local); err == nil {
+			record[slog.TimeKey] = t.Format(time.RFC3339Nano)
+			record[slog.MessageKey] = strings.TrimSpace(line[19:])
+		}
+	}
+	return record
+}
+
+// logFilesBetween devuelve los ficheros de log de un rango de fechas
+func logFilesBetween(from string, to string) []string {
+	var result []string
+	for _, file := range ListLogFiles() {
+		if day := logFileDay(file); day >= from && day <= to {
+			result = append(result, file)
+		}
+	}
+	return result
+}
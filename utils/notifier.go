@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+)
+
+// EmailMessage es un correo electrónico pendiente de enviar
+type EmailMessage struct {
+	To        string
+	Subject   string
+	Text      string
+	HTML      string `json:",omitempty"`
+	Date      time.Time
+	MessageID string
+}
+
+// Notifier es cualquier medio capaz de entregar un correo electrónico
+type Notifier interface {
+	Send(msg EmailMessage) error
+}
+
+// NewNotifier crea el notificador indicado en la configuración
+func NewNotifier() Notifier {
+	var result Notifier
+	mode := config.EmailNotifier
+	if config.EmailDebug == true {
+		mode = "console"
+	}
+	switch mode {
+	case "file":
+		result = &FileNotifier{Dir: config.EmailDropDir}
+	case "console":
+		result = &ConsoleNotifier{}
+	default:
+		result = &SMTPNotifier{
+			Host:     config.Account2FA["smtpServer"],
+			Port:     config.Account2FA["smtpPort"],
+			User:     config.Account2FA["email"],
+			Pass:     config.Account2FA["passw"],
+			From:     config.Account2FA["email"],
+			Security: config.Account2FA["smtpSecurity"],
+		}
+	}
+	return result
+}
+
+/* ----------- SMTP ----------- */
+
+// SMTPNotifier envía los correos a través de un servidor SMTP.
+// Security puede ser "starttls" (por defecto), "tls" (TLS implícito) o "none".
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	User     string
+	Pass     string
+	From     string
+	Security string
+
+	// TLSConfig permite sustituir la configuración TLS (certificados propios)
+	TLSConfig *tls.Config
+}
+
+// Send entrega el correo al servidor SMTP
+func (n *SMTPNotifier) Send(msg EmailMessage) error {
+	addr := net.JoinHostPort(n.Host, n.Port)
+	tlsConfig := n.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: n.Host}
+	}
+
+	var conn net.Conn
+	var err error
+	if n.Security == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, 30*time.Second)
+	}
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if n.Security != "tls" && n.Security != "none" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if n.User != "" {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(smtp.PlainAuth("", n.User, n.Pass, n.Host)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := c.Mail(n.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(BuildMIMEMessage(n.From, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+/* ----------- FICHERO ----------- */
+
+// FileNotifier deja cada correo como un fichero .eml en una carpeta
+type FileNotifier struct {
+	Dir string
+}
+
+// Send guarda el correo en la carpeta indicada
+func (n *FileNotifier) Send(msg EmailMessage) error {
+	if _, err := os.Stat(n.Dir); os.IsNotExist(err) {
+		os.MkdirAll(n.Dir, 0700)
+	}
+	name := msg.Date.UTC().Format("20060102T150405") + "-" + strings.Trim(msg.MessageID, "<>") + ".eml"
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '@' {
+			return '_'
+		}
+		return r
+	}, name)
+	return ioutil.WriteFile(strings.TrimRight(n.Dir, "/")+"/"+name, BuildMIMEMessage(config.Account2FA["email"], msg), 0600)
+}
+
+/* ----------- TERMINAL ----------- */
+
+// ConsoleNotifier muestra los correos por la salida estándar sin enviarlos
+type ConsoleNotifier struct{}
+
+// Send muestra el correo en la terminal
+func (n *ConsoleNotifier) Send(msg EmailMessage) error {
+	fmt.Printf("---- email ----\nTo: %s\nSubject: %s\n\n%s\n---------------\n", msg.To, msg.Subject, msg.Text)
+	return nil
+}
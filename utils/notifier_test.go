@@ -0,0 +1,326 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+)
+
+// TestMain ejecuta las pruebas en una carpeta temporal, para que los logs
+// (LogsDir) no se escriban dentro del código
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "gestorSDS-utils")
+	if err != nil {
+		panic(err)
+	}
+	os.Chdir(dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// smtpStub es un servidor SMTP mínimo en el propio proceso. Admite STARTTLS
+// (starttls), TLS implícito (implicitTLS) o rechazar todos los correos (reject)
+type smtpStub struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	starttls    bool
+	implicitTLS bool
+	reject      bool
+
+	// Por cada correo recibido: el mensaje y si la conexión estaba cifrada
+	received chan smtpStubMessage
+}
+
+type smtpStubMessage struct {
+	Data string
+	TLS  bool
+}
+
+// newSMTPStub arranca el servidor con un certificado autofirmado para
+// 127.0.0.1 y devuelve la configuración TLS del cliente que confía en él
+func newSMTPStub(t *testing.T, starttls bool, implicitTLS bool, reject bool) (*smtpStub, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plantilla := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, plantilla, plantilla, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	stub := &smtpStub{
+		tlsConfig:   &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		starttls:    starttls,
+		implicitTLS: implicitTLS,
+		reject:      reject,
+		received:    make(chan smtpStubMessage, 16),
+	}
+	if implicitTLS {
+		stub.listener, err = tls.Listen("tcp", "127.0.0.1:0", stub.tlsConfig)
+	} else {
+		stub.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stub.listener.Close() })
+
+	go func() {
+		for {
+			conn, err := stub.listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub, &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+}
+
+// notifier devuelve un SMTPNotifier que envía al servidor de pruebas
+func (s *smtpStub) notifier(security string, clientTLS *tls.Config) *SMTPNotifier {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return &SMTPNotifier{Host: host, Port: port, From: "gestor@example.com", Security: security, TLSConfig: clientTLS}
+}
+
+// serve atiende una conexión SMTP
+func (s *smtpStub) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	cifrada := s.implicitTLS
+	reader := bufio.NewReader(conn)
+	responder := func(lineas ...string) {
+		conn.Write([]byte(strings.Join(lineas, "\r\n") + "\r\n"))
+	}
+
+	responder("220 stub ESMTP")
+	for {
+		linea, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		comando := strings.ToUpper(strings.Fields(linea + " x")[0])
+		switch comando {
+		case "EHLO", "HELO":
+			if s.starttls && !cifrada {
+				responder("250-stub", "250-STARTTLS", "250 8BITMIME")
+			} else {
+				responder("250-stub", "250 8BITMIME")
+			}
+		case "STARTTLS":
+			responder("220 ready to start TLS")
+			conexionTLS := tls.Server(conn, s.tlsConfig)
+			if conexionTLS.Handshake() != nil {
+				return
+			}
+			conn, reader, cifrada = conexionTLS, bufio.NewReader(conexionTLS), true
+		case "MAIL":
+			if s.reject {
+				responder("550 mailbox unavailable")
+			} else {
+				responder("250 OK")
+			}
+		case "RCPT":
+			responder("250 OK")
+		case "DATA":
+			responder("354 end data with <CR><LF>.<CR><LF>")
+			var datos strings.Builder
+			for {
+				linea, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if linea == ".\r\n" {
+					break
+				}
+				datos.WriteString(linea)
+			}
+			s.received <- smtpStubMessage{Data: datos.String(), TLS: cifrada}
+			responder("250 OK queued")
+		case "QUIT":
+			responder("221 bye")
+			return
+		default:
+			responder("250 OK")
+		}
+	}
+}
+
+// mensajePrueba es el correo que se envía en las pruebas
+func mensajePrueba() EmailMessage {
+	return EmailMessage{
+		To:        "usuario@example.com",
+		Subject:   "Código de acceso",
+		Text:      "Tu código es 123456",
+		Date:      time.Now(),
+		MessageID: "<prueba@gestorSDS>",
+	}
+}
+
+// esperarCorreo devuelve el correo recibido por el servidor de pruebas
+func esperarCorreo(t *testing.T, stub *smtpStub) smtpStubMessage {
+	select {
+	case recibido := <-stub.received:
+		return recibido
+	case <-time.After(5 * time.Second):
+		t.Fatal("el servidor SMTP no ha recibido el correo")
+	}
+	return smtpStubMessage{}
+}
+
+func TestSMTPNotifierStartTLS(t *testing.T) {
+	stub, clientTLS := newSMTPStub(t, true, false, false)
+	if err := stub.notifier("starttls", clientTLS).Send(mensajePrueba()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	recibido := esperarCorreo(t, stub)
+	if !recibido.TLS {
+		t.Error("el correo se ha enviado sin cifrar")
+	}
+	if !strings.Contains(recibido.Data, "To: <usuario@example.com>") || !strings.Contains(recibido.Data, "Message-ID: <prueba@gestorSDS>") {
+		t.Errorf("cabeceras inesperadas:\n%s", recibido.Data)
+	}
+}
+
+func TestSMTPNotifierStartTLSRequired(t *testing.T) {
+	// Sin STARTTLS en el servidor no se envía en claro
+	stub, clientTLS := newSMTPStub(t, false, false, false)
+	if err := stub.notifier("starttls", clientTLS).Send(mensajePrueba()); err == nil {
+		t.Fatal("Send sin STARTTLS no ha fallado")
+	}
+}
+
+func TestSMTPNotifierImplicitTLS(t *testing.T) {
+	stub, clientTLS := newSMTPStub(t, false, true, false)
+	if err := stub.notifier("tls", clientTLS).Send(mensajePrueba()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if recibido := esperarCorreo(t, stub); !recibido.TLS || !strings.Contains(recibido.Data, "To: <usuario@example.com>") {
+		t.Errorf("correo inesperado (TLS %v):\n%s", recibido.TLS, recibido.Data)
+	}
+}
+
+// usarBandejaTemporal cambia la bandeja de salida y sus límites durante la prueba
+func usarBandejaTemporal(t *testing.T, maxAttempts int, retryBase int) {
+	dir, oldDir := t.TempDir()+"/", config.OutboxDir
+	oldMax, oldBase := config.OutboxMaxAttempts, config.OutboxRetryBase
+	config.OutboxDir, config.OutboxMaxAttempts, config.OutboxRetryBase = dir, maxAttempts, retryBase
+	t.Cleanup(func() {
+		config.OutboxDir, config.OutboxMaxAttempts, config.OutboxRetryBase = oldDir, oldMax, oldBase
+	})
+}
+
+func TestOutboxSend(t *testing.T) {
+	usarBandejaTemporal(t, 3, 30)
+	stub, clientTLS := newSMTPStub(t, true, false, false)
+
+	msg := mensajePrueba()
+	if err := QueueEmail(msg); err != nil {
+		t.Fatal(err)
+	}
+	processOutbox(stub.notifier("starttls", clientTLS))
+	esperarCorreo(t, stub)
+	if _, err := os.Stat(outboxItemPath(msg)); !os.IsNotExist(err) {
+		t.Error("el correo enviado sigue en la bandeja de salida")
+	}
+}
+
+func TestOutboxRetryBackoff(t *testing.T) {
+	usarBandejaTemporal(t, 3, 30)
+	stub, clientTLS := newSMTPStub(t, true, false, true)
+	notifier := stub.notifier("starttls", clientTLS)
+
+	msg := mensajePrueba()
+	if err := QueueEmail(msg); err != nil {
+		t.Fatal(err)
+	}
+	path := outboxItemPath(msg)
+
+	// Cada intento fallido dobla la espera: 30s, 60s...
+	for intento, espera := range []time.Duration{30 * time.Second, 60 * time.Second} {
+		antes := time.Now()
+		next := processOutbox(notifier)
+		item, err := readOutboxItem(path)
+		if err != nil {
+			t.Fatalf("intento %d: %v", intento+1, err)
+		}
+		if item.Attempts != intento+1 {
+			t.Errorf("intento %d: Attempts = %d", intento+1, item.Attempts)
+		}
+		if item.LastError == "" {
+			t.Errorf("intento %d: no se ha guardado el error", intento+1)
+		}
+		if retraso := item.NextAttempt.Sub(antes); retraso < espera || retraso > espera+5*time.Second {
+			t.Errorf("intento %d: NextAttempt dentro de %v, se esperaba %v", intento+1, retraso, espera)
+		}
+		if next > espera {
+			t.Errorf("intento %d: siguiente pasada dentro de %v, se esperaba como mucho %v", intento+1, next, espera)
+		}
+
+		// Sin esperar: el reintento no ha vencido y no se vuelve a enviar
+		processOutbox(notifier)
+		if sinCambios, _ := readOutboxItem(path); sinCambios.Attempts != item.Attempts {
+			t.Errorf("intento %d: se ha reintentado antes de tiempo", intento+1)
+		}
+
+		item.NextAttempt = time.Now().Add(-time.Second)
+		writeOutboxItem(path, &item)
+	}
+
+	// Tras config.OutboxMaxAttempts intentos pasa a failed/
+	processOutbox(notifier)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("el correo sigue en la bandeja de salida tras el máximo de intentos")
+	}
+	item, err := readOutboxItem(filepath.Join(config.OutboxDir, "failed", filepath.Base(path)))
+	if err != nil {
+		t.Fatalf("el correo no está en failed/: %v", err)
+	}
+	if item.Attempts != config.OutboxMaxAttempts {
+		t.Errorf("Attempts = %d, se esperaba %d", item.Attempts, config.OutboxMaxAttempts)
+	}
+}
+
+func TestOutboxUnreadableItem(t *testing.T) {
+	usarBandejaTemporal(t, 3, 30)
+	os.MkdirAll(config.OutboxDir, 0700)
+	path := filepath.Join(config.OutboxDir, "danado.json")
+	if err := ioutil.WriteFile(path, []byte("no es un correo cifrado de la bandeja"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stub, clientTLS := newSMTPStub(t, true, false, false)
+	processOutbox(stub.notifier("starttls", clientTLS))
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("el correo dañado sigue en la bandeja de salida")
+	}
+	if _, err := os.Stat(filepath.Join(config.OutboxDir, "failed", "danado.json")); err != nil {
+		t.Errorf("el correo dañado no está en failed/: %v", err)
+	}
+}
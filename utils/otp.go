@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTP es una semilla de códigos de un solo uso de otro servicio, HOTP
+// (RFC 4226) o TOTP (RFC 6238), tal y como la describe una URI otpauth://
+type OTP struct {
+	Tipo      string // "totp" o "hotp"
+	Emisor    string
+	Cuenta    string
+	Secreto   []byte
+	Algoritmo string // "SHA1", "SHA256" o "SHA512"
+	Digitos   int
+	Periodo   int    // Segundos de validez de cada código (TOTP)
+	Contador  uint64 // Siguiente contador a usar (HOTP)
+}
+
+// ParseOTPAuthURI lee una URI otpauth://totp/... u otpauth://hotp/...
+// (la que muestran los servicios como código QR al activar el 2FA)
+func ParseOTPAuthURI(uri string) (OTP, error) {
+	invalid := errors.New("invalid otpauth uri")
+
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || u.Scheme != "otpauth" {
+		return OTP{}, invalid
+	}
+	otp := OTP{Tipo: strings.ToLower(u.Host), Algoritmo: "SHA1", Digitos: 6, Periodo: 30}
+	if otp.Tipo != "totp" && otp.Tipo != "hotp" {
+		return OTP{}, invalid
+	}
+
+	// La etiqueta es "emisor:cuenta" o solo "cuenta"
+	etiqueta := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(etiqueta, ":"); i != -1 {
+		otp.Emisor, otp.Cuenta = strings.TrimSpace(etiqueta[:i]), strings.TrimSpace(etiqueta[i+1:])
+	} else {
+		otp.Cuenta = etiqueta
+	}
+
+	query := u.Query()
+	if emisor := query.Get("issuer"); emisor != "" {
+		otp.Emisor = emisor
+	}
+	secreto := strings.ToUpper(strings.Replace(query.Get("secret"), " ", "", -1))
+	if otp.Secreto, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secreto, "=")); err != nil || len(otp.Secreto) == 0 {
+		return OTP{}, invalid
+	}
+	if algoritmo := strings.ToUpper(query.Get("algorithm")); algoritmo != "" {
+		if algoritmo != "SHA1" && algoritmo != "SHA256" && algoritmo != "SHA512" {
+			return OTP{}, invalid
+		}
+		otp.Algoritmo = algoritmo
+	}
+	if digitos := query.Get("digits"); digitos != "" {
+		if otp.Digitos, err = strconv.Atoi(digitos); err != nil || otp.Digitos < 6 || otp.Digitos > 8 {
+			return OTP{}, invalid
+		}
+	}
+	if periodo := query.Get("period"); periodo != "" {
+		if otp.Periodo, err = strconv.Atoi(periodo); err != nil || otp.Periodo < 1 {
+			return OTP{}, invalid
+		}
+	}
+	if contador := query.Get("counter"); contador != "" {
+		if otp.Contador, err = strconv.ParseUint(contador, 10, 64); err != nil {
+			return OTP{}, invalid
+		}
+	} else if otp.Tipo == "hotp" {
+		return OTP{}, invalid
+	}
+
+	return otp, nil
+}
+
+// URI devuelve la URI otpauth:// de la semilla (con el contador actualizado)
+func (o OTP) URI() string {
+	query := url.Values{}
+	query.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(o.Secreto))
+	if o.Emisor != "" {
+		query.Set("issuer", o.Emisor)
+	}
+	query.Set("algorithm", o.Algoritmo)
+	query.Set("digits", strconv.Itoa(o.Digitos))
+	if o.Tipo == "hotp" {
+		query.Set("counter", strconv.FormatUint(o.Contador, 10))
+	} else {
+		query.Set("period", strconv.Itoa(o.Periodo))
+	}
+
+	etiqueta := o.Cuenta
+	if o.Emisor != "" {
+		etiqueta = o.Emisor + ":" + o.Cuenta
+	}
+	u := url.URL{Scheme: "otpauth", Host: o.Tipo, Path: "/" + etiqueta, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// CodigoHOTP calcula el código correspondiente al contador indicado
+func (o OTP) CodigoHOTP(contador uint64) string {
+	var nuevoHash func() hash.Hash
+	switch o.Algoritmo {
+	case "SHA256":
+		nuevoHash = sha256.New
+	case "SHA512":
+		nuevoHash = sha512.New
+	default:
+		nuevoHash = sha1.New
+	}
+
+	mensaje := make([]byte, 8)
+	binary.BigEndian.PutUint64(mensaje, contador)
+	mac := hmac.New(nuevoHash, o.Secreto)
+	mac.Write(mensaje)
+	sum := mac.Sum(nil)
+
+	// Truncado dinámico (RFC 4226, sección 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	valor := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < o.Digitos; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", o.Digitos, valor%modulo)
+}
+
+// CodigoTOTP calcula el código válido en el instante indicado y los
+// segundos que le quedan de validez
+func (o OTP) CodigoTOTP(t time.Time) (string, int) {
+	segundos := t.Unix()
+	periodo := int64(o.Periodo)
+	return o.CodigoHOTP(uint64(segundos / periodo)), int(periodo - segundos%periodo)
+}
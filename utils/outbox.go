@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bertus193/gestorSDS/config"
+)
+
+// outboxItem es un correo guardado en la bandeja de salida
+type outboxItem struct {
+	Message     EmailMessage
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string `json:",omitempty"`
+}
+
+var outboxMutex sync.Mutex
+var outboxWake = make(chan struct{}, 1)
+var outboxStop chan struct{}
+var outboxDone chan struct{}
+
+// QueueEmail guarda el correo en la bandeja de salida (persistente)
+// y avisa al proceso de envío si está en marcha
+func QueueEmail(msg EmailMessage) error {
+	outboxMutex.Lock()
+	defer outboxMutex.Unlock()
+
+	if _, err := os.Stat(config.OutboxDir); os.IsNotExist(err) {
+		os.MkdirAll(config.OutboxDir, 0700)
+	}
+
+	item := outboxItem{Message: msg, NextAttempt: time.Now()}
+	if err := writeOutboxItem(outboxItemPath(msg), &item); err != nil {
+		return err
+	}
+
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// StartOutbox lanza el proceso que envía los correos pendientes con el
+// notificador indicado, reintentando los fallidos con espera exponencial
+func StartOutbox(n Notifier) {
+	outboxStop = make(chan struct{})
+	outboxDone = make(chan struct{})
+
+	go func() {
+		defer close(outboxDone)
+		for {
+			wait := processOutbox(n)
+			select {
+			case <-outboxStop:
+				return
+			case <-outboxWake:
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// StopOutbox detiene el proceso de envío (los pendientes se conservan)
+func StopOutbox() {
+	if outboxStop != nil {
+		close(outboxStop)
+		<-outboxDone
+		outboxStop = nil
+	}
+}
+
+// processOutbox intenta enviar los correos cuyo reintento ha vencido y
+// devuelve el tiempo que falta hasta el siguiente
+func processOutbox(n Notifier) time.Duration {
+	next := time.Minute
+
+	files, _ := filepath.Glob(strings.TrimRight(config.OutboxDir, "/") + "/*.json")
+	sort.Strings(files)
+	for _, path := range files {
+		item, err := readOutboxItem(path)
+		if err != nil {
+			// Un correo dañado o que no se puede descifrar no se enviará nunca:
+			// se aparta para no volver a leerlo en cada pasada
+			outboxMutex.Lock()
+			moveOutboxFailed(path)
+			outboxMutex.Unlock()
+			LogError("email unreadable", "file", filepath.Base(path), "error", err.Error())
+			continue
+		}
+
+		if wait := time.Until(item.NextAttempt); wait > 0 {
+			if wait < next {
+				next = wait
+			}
+			continue
+		}
+
+		errSend := n.Send(item.Message)
+		if errSend == nil {
+			os.Remove(path)
+			LogInfo("email sent", "user", item.Message.To, "attempts", item.Attempts+1)
+			continue
+		}
+
+		item.LastError = errSend.Error()
+		item.Attempts++
+		outboxMutex.Lock()
+		if item.Attempts >= config.OutboxMaxAttempts {
+			// Se descarta tras el número máximo de intentos, guardándolo aparte
+			writeOutboxItem(path, &item)
+			moveOutboxFailed(path)
+			LogError("email failed", "user", item.Message.To, "attempts", item.Attempts, "error", item.LastError)
+		} else {
+			backoff := outboxBackoff(item.Attempts)
+			item.NextAttempt = time.Now().Add(backoff)
+			writeOutboxItem(path, &item)
+			LogWarn("email retry", "user", item.Message.To, "attempts", item.Attempts, "error", item.LastError, "retry_in", backoff.String())
+			if backoff < next {
+				next = backoff
+			}
+		}
+		outboxMutex.Unlock()
+	}
+
+	return next
+}
+
+// outboxBackoff devuelve la espera antes del reintento indicado (base * 2^(n-1), con límite)
+func outboxBackoff(attempts int) time.Duration {
+	backoff := time.Duration(config.OutboxRetryBase) * time.Second
+	for i := 1; i < attempts && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+	if backoff > time.Hour {
+		backoff = time.Hour
+	}
+	return backoff
+}
+
+// moveOutboxFailed aparta un correo de la bandeja de salida a failed/
+func moveOutboxFailed(path string) {
+	failedDir := strings.TrimRight(config.OutboxDir, "/") + "/failed/"
+	os.MkdirAll(failedDir, 0700)
+	os.Rename(path, failedDir+filepath.Base(path))
+}
+
+// outboxItemPath devuelve el fichero de la bandeja de salida de un correo
+func outboxItemPath(msg EmailMessage) string {
+	id := strings.Map(func(r rune) rune {
+		if r == '<' || r == '>' || r == '/' || r == '\\' || r == '@' {
+			return '_'
+		}
+		return r
+	}, msg.MessageID)
+	return strings.TrimRight(config.OutboxDir, "/") + "/" + msg.Date.UTC().Format("20060102T150405.000000000") + "-" + id + ".json"
+}
+
+// readOutboxItem recupera (y descifra) un correo de la bandeja de salida
+func readOutboxItem(path string) (outboxItem, error) {
+	var item outboxItem
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return item, err
+	}
+	if len(data) < 16 {
+		return item, os.ErrInvalid
+	}
+	err = json.Unmarshal(DecryptAES(data, config.PassDBEncrypt), &item)
+	return item, err
+}
+
+// writeOutboxItem guarda un correo cifrado de forma atómica (fichero temporal + rename),
+// los correos pueden contener códigos de acceso
+func writeOutboxItem(path string, item *outboxItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, EncryptAES(data, config.PassDBEncrypt), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,317 @@
+package utils
+
+import (
+	_ "embed" // Lista de palabras para las frases de contraseña
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Lista larga de la EFF para diceware (7776 palabras, 5 dados por palabra):
+// https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases
+//
+//go:embed wordlists/eff_large_wordlist.txt
+var palabrasDicewareTxt string
+
+var palabrasDiceware = strings.Fields(palabrasDicewareTxt)
+
+// Conjuntos de caracteres de cada clase
+const (
+	CaracteresMinusculas = "abcdefghijklmnopqrstuvwxyz"
+	CaracteresMayusculas = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	CaracteresNumeros    = "0123456789"
+	CaracteresSimbolos   = "!#$%&*+-./:;<=>?@^_~"
+	CaracteresAmbiguos   = "0Oo1lI|"
+)
+
+// Letras del modo pronunciable (se alternan consonantes y vocales)
+const (
+	consonantesPronunciables = "bcdfghjklmnprstvz"
+	vocalesPronunciables     = "aeiou"
+)
+
+// PasswordOptions son las opciones de las contraseñas aleatorias. Un mínimo
+// negativo excluye la clase de caracteres; 0 permite que aparezca sin exigirlo
+type PasswordOptions struct {
+	Longitud      int
+	MinMinusculas int
+	MinMayusculas int
+	MinNumeros    int
+	MinSimbolos   int
+	Simbolos      string // Conjunto de símbolos (vacío: CaracteresSimbolos)
+	Adicionales   string // Caracteres personalizados que también pueden aparecer
+	Excluidos     string // Caracteres que no deben aparecer
+	SinAmbiguos   bool   // Excluye los caracteres que se confunden (0/O, 1/l...)
+	Pronunciable  bool   // Alterna consonantes y vocales; números y símbolos al final
+}
+
+// PassphraseOptions son las opciones de las frases de contraseña (diceware)
+type PassphraseOptions struct {
+	Palabras   int
+	Separador  string
+	Mayusculas bool // Primera letra de cada palabra en mayúsculas
+	Digitos    int  // Cifras añadidas al final de una palabra al azar
+}
+
+// DefaultPasswordOptions son las opciones por defecto: todas las clases, al
+// menos un carácter de cada una
+func DefaultPasswordOptions(longitud int) PasswordOptions {
+	return PasswordOptions{Longitud: longitud, MinMinusculas: 1, MinMayusculas: 1, MinNumeros: 1, MinSimbolos: 1}
+}
+
+// claseCaracteres es un conjunto de caracteres (sin repetir) con el mínimo que
+// debe aparecer en la contraseña
+type claseCaracteres struct {
+	caracteres []rune
+	minimo     int
+}
+
+// GeneratePasswordWithOptions genera una contraseña con las opciones indicadas
+// y devuelve también su entropía (log2 de las contraseñas posibles). Todas las
+// contraseñas que cumplen los mínimos son igual de probables
+func GeneratePasswordWithOptions(opciones PasswordOptions) (string, float64, error) {
+	if opciones.Longitud <= 0 {
+		return "", 0, errors.New("invalid length")
+	}
+	excluidos := opciones.Excluidos
+	if opciones.SinAmbiguos {
+		excluidos += CaracteresAmbiguos
+	}
+	simbolos := opciones.Simbolos
+	if simbolos == "" {
+		simbolos = CaracteresSimbolos
+	}
+
+	if opciones.Pronunciable {
+		return generarPronunciable(opciones, simbolos, excluidos)
+	}
+
+	// Clases disjuntas: los adicionales que ya están en otra clase se ignoran
+	var clases []claseCaracteres
+	usados := ""
+	for _, clase := range []struct {
+		caracteres string
+		minimo     int
+	}{
+		{CaracteresMinusculas, opciones.MinMinusculas},
+		{CaracteresMayusculas, opciones.MinMayusculas},
+		{CaracteresNumeros, opciones.MinNumeros},
+		{simbolos, opciones.MinSimbolos},
+		{opciones.Adicionales, 0},
+	} {
+		if clase.minimo < 0 {
+			continue
+		}
+		caracteres := filtrarCaracteres(clase.caracteres, usados+excluidos)
+		usados += string(caracteres)
+		if len(caracteres) == 0 {
+			if clase.minimo > 0 {
+				return "", 0, errors.New("empty character class")
+			}
+			continue
+		}
+		clases = append(clases, claseCaracteres{caracteres, clase.minimo})
+	}
+	if len(clases) == 0 {
+		return "", 0, errors.New("no characters")
+	}
+
+	// formas[i][r]: log de las formas de rellenar r posiciones con las clases
+	// i en adelante, respetando sus mínimos (sin contar el orden)
+	n := opciones.Longitud
+	formas := make([][]float64, len(clases)+1)
+	for i := range formas {
+		formas[i] = make([]float64, n+1)
+		for r := range formas[i] {
+			formas[i][r] = math.Inf(-1)
+		}
+	}
+	formas[len(clases)][0] = 0
+	peso := func(clase claseCaracteres, k int) float64 {
+		lgamma, _ := math.Lgamma(float64(k + 1))
+		return float64(k)*math.Log(float64(len(clase.caracteres))) - lgamma
+	}
+	for i := len(clases) - 1; i >= 0; i-- {
+		for r := 0; r <= n; r++ {
+			for k := clases[i].minimo; k <= r; k++ {
+				formas[i][r] = sumaLogaritmos(formas[i][r], peso(clases[i], k)+formas[i+1][r-k])
+			}
+		}
+	}
+	if math.IsInf(formas[0][n], -1) {
+		return "", 0, errors.New("minimums exceed length")
+	}
+
+	// Cuántos caracteres de cada clase, con probabilidad proporcional al
+	// número de contraseñas que hay con ese reparto
+	var posiciones []int
+	restantes := n
+	for i, clase := range clases {
+		azar := math.Log(aleatorioUniforme()) + formas[i][restantes]
+		k, acumulado := clase.minimo, math.Inf(-1)
+		for j := clase.minimo; j <= restantes; j++ {
+			if math.IsInf(formas[i+1][restantes-j], -1) {
+				continue
+			}
+			k, acumulado = j, sumaLogaritmos(acumulado, peso(clase, j)+formas[i+1][restantes-j])
+			if azar < acumulado {
+				break
+			}
+		}
+		for j := 0; j < k; j++ {
+			posiciones = append(posiciones, i)
+		}
+		restantes -= k
+	}
+
+	// Orden al azar y un carácter al azar de su clase en cada posición
+	barajar(len(posiciones), func(i, j int) { posiciones[i], posiciones[j] = posiciones[j], posiciones[i] })
+	salida := make([]rune, n)
+	for i, clase := range posiciones {
+		caracteres := clases[clase].caracteres
+		salida[i] = caracteres[CryptoRandSecure(int64(len(caracteres)))]
+	}
+
+	lgamma, _ := math.Lgamma(float64(n + 1))
+	return string(salida), (lgamma + formas[0][n]) / math.Ln2, nil
+}
+
+// generarPronunciable genera una contraseña que alterna consonantes y vocales
+// (empezando por una u otra al azar), con el mínimo de mayúsculas en letras al
+// azar y los números y símbolos mínimos al final, en orden aleatorio
+func generarPronunciable(opciones PasswordOptions, simbolos string, excluidos string) (string, float64, error) {
+	if opciones.MinMinusculas < 0 {
+		return "", 0, errors.New("empty character class")
+	}
+	consonantes := filtrarCaracteres(consonantesPronunciables, excluidos)
+	vocales := filtrarCaracteres(vocalesPronunciables, excluidos)
+	numeros := filtrarCaracteres(CaracteresNumeros, excluidos)
+	caracteresSimbolos := filtrarCaracteres(simbolos, excluidos)
+	minNumeros, minSimbolos := maximo(opciones.MinNumeros, 0), maximo(opciones.MinSimbolos, 0)
+	letras := opciones.Longitud - minNumeros - minSimbolos
+	minMayusculas := maximo(opciones.MinMayusculas, 0)
+
+	switch {
+	case len(consonantes) == 0 || len(vocales) == 0 ||
+		(minNumeros > 0 && len(numeros) == 0) || (minSimbolos > 0 && len(caracteresSimbolos) == 0):
+		return "", 0, errors.New("empty character class")
+	case letras < 1 || minMayusculas > letras:
+		return "", 0, errors.New("minimums exceed length")
+	}
+
+	entropia := 1.0
+	var salida []rune
+	vocal := CryptoRandSecure(2) == 0
+	for i := 0; i < letras; i++ {
+		conjunto := consonantes
+		if vocal {
+			conjunto = vocales
+		}
+		salida = append(salida, conjunto[CryptoRandSecure(int64(len(conjunto)))])
+		entropia += math.Log2(float64(len(conjunto)))
+		vocal = !vocal
+	}
+
+	// Mayúsculas en letras distintas al azar
+	indices := make([]int, letras)
+	for i := range indices {
+		indices[i] = i
+	}
+	barajar(letras, func(i, j int) { indices[i], indices[j] = indices[j], indices[i] })
+	for _, i := range indices[:minMayusculas] {
+		salida[i] = unicode.ToUpper(salida[i])
+	}
+	entropia += math.Log2(binomial(letras, minMayusculas))
+
+	// Números y símbolos al final, mezclados
+	var final []rune
+	for i := 0; i < minNumeros; i++ {
+		final = append(final, numeros[CryptoRandSecure(int64(len(numeros)))])
+	}
+	for i := 0; i < minSimbolos; i++ {
+		final = append(final, caracteresSimbolos[CryptoRandSecure(int64(len(caracteresSimbolos)))])
+	}
+	barajar(len(final), func(i, j int) { final[i], final[j] = final[j], final[i] })
+	if minNumeros > 0 {
+		entropia += float64(minNumeros) * math.Log2(float64(len(numeros)))
+	}
+	if minSimbolos > 0 {
+		entropia += float64(minSimbolos) * math.Log2(float64(len(caracteresSimbolos)))
+	}
+	entropia += math.Log2(binomial(minNumeros+minSimbolos, minNumeros))
+
+	return string(append(salida, final...)), entropia, nil
+}
+
+// GeneratePassphrase genera una frase de contraseña con palabras al azar de
+// la lista de la EFF y devuelve también su entropía
+func GeneratePassphrase(opciones PassphraseOptions) (string, float64, error) {
+	if opciones.Palabras <= 0 || opciones.Digitos < 0 {
+		return "", 0, errors.New("invalid length")
+	}
+
+	palabras := make([]string, opciones.Palabras)
+	for i := range palabras {
+		palabras[i] = palabrasDiceware[CryptoRandSecure(int64(len(palabrasDiceware)))]
+		if opciones.Mayusculas {
+			palabras[i] = strings.ToUpper(palabras[i][:1]) + palabras[i][1:]
+		}
+	}
+	entropia := float64(opciones.Palabras) * math.Log2(float64(len(palabrasDiceware)))
+
+	if opciones.Digitos > 0 {
+		palabra := CryptoRandSecure(int64(len(palabras)))
+		for i := 0; i < opciones.Digitos; i++ {
+			palabras[palabra] += string(CaracteresNumeros[CryptoRandSecure(10)])
+		}
+		entropia += math.Log2(float64(len(palabras))) + float64(opciones.Digitos)*math.Log2(10)
+	}
+
+	return strings.Join(palabras, opciones.Separador), entropia, nil
+}
+
+// filtrarCaracteres quita los caracteres excluidos y los repetidos
+func filtrarCaracteres(caracteres string, excluidos string) []rune {
+	var result []rune
+	for _, r := range caracteres {
+		if !strings.ContainsRune(excluidos, r) && !strings.ContainsRune(string(result), r) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// sumaLogaritmos calcula log(e^a + e^b) sin desbordar
+func sumaLogaritmos(a float64, b float64) float64 {
+	if math.IsInf(a, -1) {
+		return b
+	}
+	if math.IsInf(b, -1) {
+		return a
+	}
+	if a < b {
+		a, b = b, a
+	}
+	return a + math.Log1p(math.Exp(b-a))
+}
+
+// aleatorioUniforme devuelve un número aleatorio en (0, 1]
+func aleatorioUniforme() float64 {
+	return float64(CryptoRandSecure(1<<53)+1) / (1 << 53)
+}
+
+// barajar desordena n elementos (Fisher-Yates) con números aleatorios seguros
+func barajar(n int, intercambiar func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		intercambiar(i, CryptoRandSecure(int64(i+1)))
+	}
+}
+
+// maximo devuelve el mayor de dos enteros
+func maximo(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Clases de caracteres de las reglas de contraseña
+const (
+	ClaseMinusculas = "lower"
+	ClaseMayusculas = "upper"
+	ClaseNumeros    = "digits"
+	ClaseSimbolos   = "symbols"
+)
+
+// ClasesCaracteres son todas las clases, en el orden en el que se muestran
+var ClasesCaracteres = []string{ClaseMinusculas, ClaseMayusculas, ClaseNumeros, ClaseSimbolos}
+
+// PasswordRules son las restricciones que un sistema impone a sus
+// contraseñas. Las clases son las de ClasesCaracteres (cualquier carácter que
+// no sea una letra sin acentos o un número cuenta como símbolo)
+type PasswordRules struct {
+	Permitidas     []string `json:",omitempty"` // Clases que pueden aparecer (vacío: todas)
+	Obligatorias   []string `json:",omitempty"` // Clases que deben aparecer
+	LongitudMaxima int      `json:",omitempty"` // 0: sin límite
+	Prohibidos     string   `json:",omitempty"` // Caracteres que no pueden aparecer
+}
+
+// Empty indica si las reglas no imponen nada
+func (r PasswordRules) Empty() bool {
+	return len(r.Permitidas) == 0 && len(r.Obligatorias) == 0 && r.LongitudMaxima == 0 && r.Prohibidos == ""
+}
+
+// Validate comprueba que las clases existen y que las reglas se pueden cumplir
+func (r PasswordRules) Validate() error {
+	for _, clase := range append(append([]string{}, r.Permitidas...), r.Obligatorias...) {
+		if !contieneClase(ClasesCaracteres, clase) {
+			return errors.New("invalid class")
+		}
+	}
+	for _, clase := range r.Obligatorias {
+		if !r.permitida(clase) {
+			return errors.New("required class not allowed")
+		}
+	}
+	if r.LongitudMaxima < 0 || (r.LongitudMaxima > 0 && r.LongitudMaxima < len(r.Obligatorias)) {
+		return errors.New("invalid length")
+	}
+	return nil
+}
+
+// Apply ajusta las opciones del generador para que la contraseña cumpla las
+// reglas: excluye las clases no permitidas y los caracteres prohibidos, exige
+// al menos un carácter de las obligatorias y recorta la longitud
+func (r PasswordRules) Apply(opciones PasswordOptions) PasswordOptions {
+	minimos := map[string]*int{
+		ClaseMinusculas: &opciones.MinMinusculas,
+		ClaseMayusculas: &opciones.MinMayusculas,
+		ClaseNumeros:    &opciones.MinNumeros,
+		ClaseSimbolos:   &opciones.MinSimbolos,
+	}
+	for clase, minimo := range minimos {
+		switch {
+		case !r.permitida(clase):
+			*minimo = -1
+		case contieneClase(r.Obligatorias, clase) && *minimo < 1:
+			*minimo = 1
+		}
+	}
+
+	// Los caracteres adicionales también tienen que ser de una clase permitida
+	adicionales := ""
+	for _, c := range opciones.Adicionales {
+		if r.permitida(claseCaracter(c)) {
+			adicionales += string(c)
+		}
+	}
+	opciones.Adicionales = adicionales
+	opciones.Excluidos += r.Prohibidos
+
+	if r.LongitudMaxima > 0 && opciones.Longitud > r.LongitudMaxima {
+		opciones.Longitud = r.LongitudMaxima
+	}
+	return opciones
+}
+
+// Check devuelve las reglas que incumple la contraseña (vacío si las cumple)
+func (r PasswordRules) Check(password string) []string {
+	var result []string
+	if longitud := len([]rune(password)); r.LongitudMaxima > 0 && longitud > r.LongitudMaxima {
+		result = append(result, "tiene "+strconv.Itoa(longitud)+" caracteres y el máximo es "+strconv.Itoa(r.LongitudMaxima))
+	}
+
+	presentes := make(map[string]bool)
+	prohibidos := ""
+	for _, c := range password {
+		presentes[claseCaracter(c)] = true
+		if strings.ContainsRune(r.Prohibidos, c) && !strings.ContainsRune(prohibidos, c) {
+			prohibidos += string(c)
+		}
+	}
+	if prohibidos != "" {
+		result = append(result, "contiene caracteres prohibidos ("+prohibidos+")")
+	}
+	for _, clase := range ClasesCaracteres {
+		if presentes[clase] && !r.permitida(clase) {
+			result = append(result, "contiene "+NombreClase(clase)+", que no están permitidos")
+		}
+		if !presentes[clase] && contieneClase(r.Obligatorias, clase) {
+			result = append(result, "no contiene "+NombreClase(clase))
+		}
+	}
+	return result
+}
+
+// String describe las reglas en una línea
+func (r PasswordRules) String() string {
+	if r.Empty() {
+		return "sin reglas"
+	}
+	var partes []string
+	if len(r.Permitidas) != 0 {
+		partes = append(partes, "solo "+nombresClases(r.Permitidas))
+	}
+	if len(r.Obligatorias) != 0 {
+		partes = append(partes, "al menos un carácter de "+nombresClases(r.Obligatorias))
+	}
+	if r.LongitudMaxima > 0 {
+		partes = append(partes, "como máximo "+strconv.Itoa(r.LongitudMaxima)+" caracteres")
+	}
+	if r.Prohibidos != "" {
+		partes = append(partes, "sin "+r.Prohibidos)
+	}
+	return strings.Join(partes, ", ")
+}
+
+// ParseClasses convierte una lista de clases separadas por comas ("lower,digits")
+func ParseClasses(lista string) ([]string, error) {
+	var result []string
+	for _, clase := range strings.Split(lista, ",") {
+		if clase = strings.TrimSpace(clase); clase == "" {
+			continue
+		}
+		if !contieneClase(ClasesCaracteres, clase) {
+			return nil, errors.New("invalid class")
+		}
+		if !contieneClase(result, clase) {
+			result = append(result, clase)
+		}
+	}
+	return result, nil
+}
+
+// NombreClase es el nombre de una clase de caracteres para mostrarlo
+func NombreClase(clase string) string {
+	switch clase {
+	case ClaseMinusculas:
+		return "minúsculas"
+	case ClaseMayusculas:
+		return "mayúsculas"
+	case ClaseNumeros:
+		return "números"
+	case ClaseSimbolos:
+		return "símbolos"
+	}
+	return clase
+}
+
+// nombresClases une los nombres de varias clases
+func nombresClases(clases []string) string {
+	nombres := make([]string, len(clases))
+	for i, clase := range clases {
+		nombres[i] = NombreClase(clase)
+	}
+	return strings.Join(nombres, ", ")
+}
+
+// permitida indica si las reglas permiten la clase
+func (r PasswordRules) permitida(clase string) bool {
+	return len(r.Permitidas) == 0 || contieneClase(r.Permitidas, clase)
+}
+
+// claseCaracter devuelve la clase de un carácter
+func claseCaracter(c rune) string {
+	switch {
+	case strings.ContainsRune(CaracteresMinusculas, c):
+		return ClaseMinusculas
+	case strings.ContainsRune(CaracteresMayusculas, c):
+		return ClaseMayusculas
+	case strings.ContainsRune(CaracteresNumeros, c):
+		return ClaseNumeros
+	}
+	return ClaseSimbolos
+}
+
+// contieneClase indica si la lista contiene la clase
+func contieneClase(clases []string, clase string) bool {
+	for _, c := range clases {
+		if c == clase {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,295 @@
+package utils
+
+import (
+	_ "embed" // Lista de contraseñas comunes
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Contraseñas y palabras más habituales, de la más a la menos usada
+//
+//go:embed wordlists/contrasenas_comunes.txt
+var contrasenasComunesTxt string
+
+var contrasenasComunes = cargarRanking(contrasenasComunesTxt)
+
+// Filas del teclado en las que se buscan patrones (qwerty, asdf...)
+var filasTeclado = []string{"1234567890", "qwertyuiop", "asdfghjklñ", "zxcvbnm"}
+
+// Sustituciones habituales de letras por números y símbolos (p4ssw0rd)
+var sustitucionesLeet = map[rune]rune{'4': 'a', '@': 'a', '3': 'e', '1': 'i', '!': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't'}
+
+// PasswordStrength es la estimación de la fortaleza de una contraseña, al
+// estilo de zxcvbn: se busca la forma más barata de adivinarla combinando
+// patrones conocidos (palabras comunes, secuencias, repeticiones, filas del
+// teclado, años) y fuerza bruta para el resto
+type PasswordStrength struct {
+	Entropia   float64  // log2 del número de intentos estimados para adivinarla
+	Puntuacion int      // De 0 (muy débil) a 4 (muy fuerte)
+	Avisos     []string // Patrones encontrados que la hacen más débil
+}
+
+// patronContrasena es un fragmento de la contraseña [inicio, fin) que sigue un patrón
+type patronContrasena struct {
+	inicio, fin int
+	intentos    float64 // log2 de los intentos para adivinar el fragmento
+	aviso       string
+}
+
+// EstimatePasswordStrength estima lo difícil que es adivinar una contraseña
+func EstimatePasswordStrength(password string) PasswordStrength {
+	runas := []rune(password)
+	n := len(runas)
+	if n == 0 {
+		return PasswordStrength{Avisos: []string{"está vacía"}}
+	}
+
+	// Patrones que terminan en cada posición
+	patrones := make([][]patronContrasena, n+1)
+	for _, patron := range buscarPatrones(runas) {
+		patrones[patron.fin] = append(patrones[patron.fin], patron)
+	}
+
+	// Programación dinámica: mínimo de intentos hasta cada posición, bien con
+	// fuerza bruta para el último carácter o con un patrón que termine en ella
+	porCaracter := math.Log2(float64(cardinalidad(runas)))
+	mejor := make([]float64, n+1)
+	elegido := make([]*patronContrasena, n+1)
+	for fin := 1; fin <= n; fin++ {
+		mejor[fin] = mejor[fin-1] + porCaracter
+		elegido[fin] = nil
+		for i := range patrones[fin] {
+			patron := &patrones[fin][i]
+			if coste := mejor[patron.inicio] + patron.intentos; coste < mejor[fin] {
+				mejor[fin], elegido[fin] = coste, patron
+			}
+		}
+	}
+
+	result := PasswordStrength{Entropia: mejor[n]}
+	for fin := n; fin > 0; {
+		if patron := elegido[fin]; patron != nil {
+			result.Avisos = append([]string{patron.aviso}, result.Avisos...)
+			fin = patron.inicio
+		} else {
+			fin--
+		}
+	}
+	if n < 8 {
+		result.Avisos = append(result.Avisos, "es demasiado corta")
+	}
+
+	result.Puntuacion = StrengthScore(result.Entropia)
+	return result
+}
+
+// StrengthScore convierte la entropía (log2 de los intentos) en la puntuación
+// de 0 a 4, con los mismos umbrales que zxcvbn: 10^3, 10^6, 10^8 y 10^10 intentos
+func StrengthScore(entropia float64) int {
+	switch {
+	case entropia < 3*math.Log2(10):
+		return 0
+	case entropia < 6*math.Log2(10):
+		return 1
+	case entropia < 8*math.Log2(10):
+		return 2
+	case entropia < 10*math.Log2(10):
+		return 3
+	}
+	return 4
+}
+
+// buscarPatrones devuelve todos los fragmentos de la contraseña que siguen
+// algún patrón conocido
+func buscarPatrones(runas []rune) []patronContrasena {
+	var patrones []patronContrasena
+	n := len(runas)
+
+	// Palabras comunes (sin distinguir mayúsculas y deshaciendo el leet)
+	for inicio := 0; inicio < n; inicio++ {
+		for fin := inicio + 3; fin <= n; fin++ {
+			fragmento := runas[inicio:fin]
+			palabra, leet := strings.ToLower(string(fragmento)), false
+			if _, ok := contrasenasComunes[palabra]; !ok {
+				palabra, leet = normalizarLeet(fragmento)
+			}
+			if rango, ok := contrasenasComunes[palabra]; ok {
+				intentos := math.Log2(float64(rango)) + variacionesMayusculas(fragmento)
+				if leet {
+					intentos++
+				}
+				patrones = append(patrones, patronContrasena{inicio, fin, intentos, "contiene una contraseña o palabra muy común (" + string(fragmento) + ")"})
+			}
+		}
+	}
+
+	// Repeticiones del mismo carácter (aaa, 1111)
+	for inicio := 0; inicio < n; {
+		fin := inicio + 1
+		for fin < n && runas[fin] == runas[inicio] {
+			fin++
+		}
+		if fin-inicio >= 3 {
+			intentos := math.Log2(float64(cardinalidad(runas[inicio:inicio+1]) * (fin - inicio)))
+			patrones = append(patrones, patronContrasena{inicio, fin, intentos, "repite caracteres (" + string(runas[inicio:fin]) + ")"})
+		}
+		inicio = fin
+	}
+
+	// Secuencias (abc, 123, 987)
+	for inicio := 0; inicio < n-2; {
+		delta := runas[inicio+1] - runas[inicio]
+		fin := inicio + 1
+		for (delta == 1 || delta == -1) && fin < n && runas[fin]-runas[fin-1] == delta {
+			fin++
+		}
+		if fin-inicio >= 3 {
+			base := 26.0
+			switch {
+			case strings.ContainsRune("aAzZ019", runas[inicio]):
+				base = 4
+			case unicode.IsDigit(runas[inicio]):
+				base = 10
+			}
+			intentos := math.Log2(base * float64(fin-inicio))
+			if delta < 0 {
+				intentos++
+			}
+			patrones = append(patrones, patronContrasena{inicio, fin, intentos, "contiene una secuencia (" + string(runas[inicio:fin]) + ")"})
+			inicio = fin
+		} else {
+			inicio++
+		}
+	}
+
+	// Filas del teclado (qwerty, asdf, 7890), en cualquier sentido
+	for inicio := 0; inicio < n-3; {
+		fin := inicio + 1
+		for fin < n && teclasVecinas(unicode.ToLower(runas[fin-1]), unicode.ToLower(runas[fin])) {
+			fin++
+		}
+		if fin-inicio >= 4 {
+			intentos := math.Log2(float64(len(filasTeclado)*2*(fin-inicio))) + variacionesMayusculas(runas[inicio:fin])
+			patrones = append(patrones, patronContrasena{inicio, fin, intentos, "sigue una fila del teclado (" + string(runas[inicio:fin]) + ")"})
+			inicio = fin
+		} else {
+			inicio++
+		}
+	}
+
+	// Años (1900-2039)
+	for inicio := 0; inicio+4 <= n; inicio++ {
+		anyo := string(runas[inicio : inicio+4])
+		if (strings.HasPrefix(anyo, "19") || strings.HasPrefix(anyo, "20")) && strings.Trim(anyo, "0123456789") == "" && anyo < "2040" {
+			patrones = append(patrones, patronContrasena{inicio, inicio + 4, math.Log2(140), "contiene un año (" + anyo + ")"})
+		}
+	}
+
+	return patrones
+}
+
+// cargarRanking convierte una lista (una palabra por línea) en su posición
+func cargarRanking(lista string) map[string]int {
+	ranking := make(map[string]int)
+	for i, palabra := range strings.Split(lista, "\n") {
+		if palabra = strings.TrimSpace(palabra); palabra != "" {
+			if _, ok := ranking[palabra]; !ok {
+				ranking[palabra] = i + 1
+			}
+		}
+	}
+	return ranking
+}
+
+// normalizarLeet pasa el fragmento a minúsculas deshaciendo las sustituciones
+// leet. Indica si se ha deshecho alguna
+func normalizarLeet(fragmento []rune) (string, bool) {
+	leet := false
+	result := make([]rune, len(fragmento))
+	for i, r := range fragmento {
+		if letra, ok := sustitucionesLeet[r]; ok {
+			result[i], leet = letra, true
+		} else {
+			result[i] = unicode.ToLower(r)
+		}
+	}
+	return string(result), leet
+}
+
+// variacionesMayusculas es el log2 de las formas de poner mayúsculas en una
+// palabra: todo en minúsculas, la primera o todas en mayúsculas son las
+// más probables, el resto depende de cuántas letras haya de cada tipo
+func variacionesMayusculas(palabra []rune) float64 {
+	var mayusculas, minusculas int
+	for _, r := range palabra {
+		if unicode.IsUpper(r) {
+			mayusculas++
+		} else if unicode.IsLower(r) {
+			minusculas++
+		}
+	}
+	switch {
+	case mayusculas == 0:
+		return 0
+	case minusculas == 0 || (mayusculas == 1 && unicode.IsUpper(palabra[0])):
+		return 1
+	}
+	combinaciones := 0.0
+	for i := 1; i <= mayusculas && i <= minusculas; i++ {
+		combinaciones += binomial(mayusculas+minusculas, i)
+	}
+	return math.Log2(combinaciones)
+}
+
+// binomial calcula n sobre k
+func binomial(n int, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+// teclasVecinas indica si dos teclas están juntas en la misma fila
+func teclasVecinas(a rune, b rune) bool {
+	for _, fila := range filasTeclado {
+		teclas := []rune(fila)
+		for i := 0; i < len(teclas)-1; i++ {
+			if (teclas[i] == a && teclas[i+1] == b) || (teclas[i] == b && teclas[i+1] == a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cardinalidad es el número de caracteres distintos entre los que se
+// elegiría cada carácter al adivinar la contraseña por fuerza bruta
+func cardinalidad(runas []rune) int {
+	var minusculas, mayusculas, digitos, simbolos, otros bool
+	for _, r := range runas {
+		switch {
+		case r >= 'a' && r <= 'z':
+			minusculas = true
+		case r >= 'A' && r <= 'Z':
+			mayusculas = true
+		case r >= '0' && r <= '9':
+			digitos = true
+		case r < 128:
+			simbolos = true
+		default:
+			otros = true
+		}
+	}
+	result := 0
+	for _, clase := range []struct {
+		presente bool
+		tamano   int
+	}{{minusculas, 26}, {mayusculas, 26}, {digitos, 10}, {simbolos, 33}, {otros, 100}} {
+		if clase.presente {
+			result += clase.tamano
+		}
+	}
+	return result
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// longitudMaximaLinea es lo máximo que puede ocupar una línea de la lista
+// ("HASH:VECES", 40 caracteres del hash y el número de apariciones)
+const longitudMaximaLinea = 128
+
+// PwnedList es una lista local de contraseñas filtradas en el formato de
+// Pwned Passwords de HIBP ("ordered by hash"): una línea "HASH:VECES" por
+// contraseña, con el SHA-1 en hexadecimal en mayúsculas y ordenada por hash.
+// Se busca directamente en el fichero (búsqueda binaria), sin cargarlo
+type PwnedList struct {
+	fichero *os.File
+	tamano  int64
+}
+
+// PwnedHash devuelve el SHA-1 de la contraseña tal y como aparece en la lista
+func PwnedHash(password string) string {
+	hash := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+// OpenPwnedList abre una lista de contraseñas filtradas
+func OpenPwnedList(ruta string) (*PwnedList, error) {
+	fichero, err := os.Open(ruta)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fichero.Stat()
+	if err != nil {
+		fichero.Close()
+		return nil, err
+	}
+	return &PwnedList{fichero: fichero, tamano: info.Size()}, nil
+}
+
+// Close cierra el fichero de la lista
+func (l *PwnedList) Close() error {
+	return l.fichero.Close()
+}
+
+// Count devuelve cuántas veces aparece la contraseña en la lista (0 si no está)
+func (l *PwnedList) Count(password string) (int, error) {
+	hash := PwnedHash(password)
+	inicio, err := l.buscar(hash)
+	if err != nil {
+		return 0, err
+	}
+	_, linea, err := l.lineaDesde(inicio)
+	if err != nil || !strings.HasPrefix(linea, hash+":") {
+		return 0, err
+	}
+	return vecesLinea(linea), nil
+}
+
+// Range devuelve las líneas cuyo hash empieza por el prefijo indicado (5
+// caracteres hexadecimales), sin el prefijo ("SUFIJO:VECES"), como la API de
+// rangos de HIBP. Permite comprobar una contraseña sin revelarla (k-anonimato)
+func (l *PwnedList) Range(prefijo string) ([]string, error) {
+	prefijo = strings.ToUpper(prefijo)
+	if len(prefijo) != 5 || strings.Trim(prefijo, "0123456789ABCDEF") != "" {
+		return nil, errors.New("invalid prefix")
+	}
+	pos, err := l.buscar(prefijo)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for pos < l.tamano {
+		fin, linea, errLinea := l.lineaDesde(pos)
+		if errLinea != nil {
+			return nil, errLinea
+		}
+		if !strings.HasPrefix(linea, prefijo) {
+			break
+		}
+		result = append(result, linea[len(prefijo):])
+		pos = fin
+	}
+	return result, nil
+}
+
+// buscar devuelve dónde empieza la primera línea cuyo hash es mayor o igual
+// que el indicado. Las líneas tienen longitud variable, así que en cada paso
+// se busca el inicio de la primera línea a partir del punto medio
+func (l *PwnedList) buscar(hash string) (int64, error) {
+	bajo, alto := int64(0), l.tamano
+	for bajo < alto {
+		medio := bajo + (alto-bajo)/2
+		inicio, err := l.inicioLinea(medio)
+		if err != nil {
+			return 0, err
+		}
+		if inicio >= alto {
+			// No empieza ninguna línea en [medio, alto)
+			alto = medio
+			continue
+		}
+		fin, linea, err := l.lineaDesde(inicio)
+		if err != nil {
+			return 0, err
+		}
+		if hashLinea(linea) < hash {
+			bajo = fin
+		} else {
+			alto = inicio
+		}
+	}
+	return bajo, nil
+}
+
+// inicioLinea devuelve dónde empieza la primera línea en pos o después
+func (l *PwnedList) inicioLinea(pos int64) (int64, error) {
+	if pos == 0 {
+		return 0, nil
+	}
+	buffer := make([]byte, longitudMaximaLinea+1)
+	n, err := l.fichero.ReadAt(buffer, pos-1)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	salto := bytes.IndexByte(buffer[:n], '\n')
+	if salto == -1 {
+		return l.tamano, nil
+	}
+	return pos + int64(salto), nil
+}
+
+// lineaDesde lee la línea que empieza en pos y devuelve dónde empieza la siguiente
+func (l *PwnedList) lineaDesde(pos int64) (int64, string, error) {
+	buffer := make([]byte, longitudMaximaLinea)
+	n, err := l.fichero.ReadAt(buffer, pos)
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	linea := buffer[:n]
+	fin := pos + int64(n)
+	if salto := bytes.IndexByte(linea, '\n'); salto != -1 {
+		linea, fin = linea[:salto], pos+int64(salto)+1
+	}
+	return fin, strings.ToUpper(strings.TrimSpace(string(linea))), nil
+}
+
+// hashLinea devuelve el hash de una línea "HASH:VECES"
+func hashLinea(linea string) string {
+	if i := strings.IndexByte(linea, ':'); i != -1 {
+		return linea[:i]
+	}
+	return linea
+}
+
+// vecesLinea devuelve el número de apariciones de una línea "HASH:VECES"
+func vecesLinea(linea string) int {
+	if i := strings.IndexByte(linea, ':'); i != -1 {
+		if veces, err := strconv.Atoi(linea[i+1:]); err == nil {
+			return veces
+		}
+	}
+	return 1
+}
+
+// PwnedRangeCount busca una contraseña en la respuesta de una consulta de
+// rango ("SUFIJO:VECES" por línea) y devuelve cuántas veces aparece
+func PwnedRangeCount(password string, rango []string) int {
+	sufijo := PwnedHash(password)[5:]
+	for _, linea := range rango {
+		if hashLinea(strings.ToUpper(strings.TrimSpace(linea))) == sufijo {
+			return vecesLinea(linea)
+		}
+	}
+	return 0
+}
@@ -3,7 +3,9 @@ package utils
 import (
 	"bufio"
 	"os"
+	"strings"
 	"syscall"
+	"unicode"
 
 	"golang.org/x/crypto/ssh/terminal"
 )
@@ -20,7 +22,7 @@ func CustomScanf() string {
 }
 
 // GetPassw permite leer entradas de texto por terminal
-// sin que se muestre el texto introducido en pantalla (sin uso).
+// sin que se muestre el texto introducido en pantalla
 func GetPassw() string {
 	passwordStr := ""
 	password, err := terminal.ReadPassword(int(syscall.Stdin))
@@ -29,3 +31,68 @@ func GetPassw() string {
 	}
 	return passwordStr
 }
+
+// CustomScanfMultiline lee varias líneas de texto hasta
+// encontrar una línea vacía (claves, notas largas, etc)
+func CustomScanfMultiline() string {
+	var lines []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Teclas especiales que devuelve LeerTecla
+const (
+	TeclaEnter     = "enter"
+	TeclaBorrar    = "backspace"
+	TeclaArriba    = "up"
+	TeclaAbajo     = "down"
+	TeclaEscape    = "esc"
+	TeclaCancelar  = "ctrl-c"
+	TeclaDesconoce = ""
+)
+
+// ModoTeclaPorTecla pone el terminal en modo "raw" para leer las pulsaciones
+// una a una (búsqueda incremental). Devuelve la función que lo restaura y
+// false si la entrada estándar no es un terminal
+func ModoTeclaPorTecla() (func(), bool) {
+	fd := int(syscall.Stdin)
+	if !terminal.IsTerminal(fd) {
+		return nil, false
+	}
+	estado, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return nil, false
+	}
+	return func() { terminal.Restore(fd, estado) }, true
+}
+
+// LeerTecla lee una pulsación en modo "raw" y devuelve una de las teclas
+// especiales o el texto escrito (puede ser más de un carácter si se pega)
+func LeerTecla() string {
+	buf := make([]byte, 64)
+	n, err := os.Stdin.Read(buf)
+	if err != nil || n == 0 {
+		return TeclaCancelar
+	}
+	key := string(buf[:n])
+	switch {
+	case key == "\r" || key == "\n":
+		return TeclaEnter
+	case key == "\x7f" || key == "\b":
+		return TeclaBorrar
+	case key == "\x03" || key == "\x04":
+		return TeclaCancelar
+	case key == "\x1b":
+		return TeclaEscape
+	case key == "\x1b[A" || key == "\x1bOA":
+		return TeclaArriba
+	case key == "\x1b[B" || key == "\x1bOB":
+		return TeclaAbajo
+	case strings.IndexFunc(key, unicode.IsControl) != -1:
+		return TeclaDesconoce
+	}
+	return key
+}
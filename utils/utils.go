@@ -54,34 +54,25 @@ func CryptoRandSecure(max int64) int {
 	return int(nBig.Int64())
 }
 
-// GeneratePassword generador de contraseñas
+// GeneratePassword generador de contraseñas (con al menos un carácter de
+// cada clase elegida)
 func GeneratePassword(tamano int, letras bool, numeros bool, simbolos bool) string {
-	arrayLetras := "AaBbCcDdEeFfGgHhIiJjKkLlMmNnOoPpQqRrSsTtUuVvWwXxYyZz"
-	arrayNumeros := "0123456789"
-	arraySimbolos := "+-/&<%#@*{!"
-
-	arrayBase := ""
-	salida := ""
-
-	if letras == true {
-		arrayBase = arrayBase + arrayLetras
+	opciones := DefaultPasswordOptions(tamano)
+	if !letras {
+		opciones.MinMinusculas, opciones.MinMayusculas = -1, -1
 	}
-	if numeros == true {
-		arrayBase = arrayBase + arrayNumeros
+	if !numeros {
+		opciones.MinNumeros = -1
 	}
-	if simbolos == true {
-		arrayBase = arrayBase + arraySimbolos
+	if !simbolos {
+		opciones.MinSimbolos = -1
 	}
 
-	if arrayBase != "" {
-		for i := 0; i < tamano; i++ {
-			salida += string(arrayBase[CryptoRandSecure(int64(len(arrayBase)))])
-		}
-	} else {
+	salida, _, err := GeneratePasswordWithOptions(opciones)
+	if err != nil {
 		return "error"
 	}
-
-	return string(salida)
+	return salida
 }
 
 // EncodeBase64 función para codificar de []bytes a string (Base64)